@@ -10,16 +10,49 @@ import (
 
 // Config - это основная структура для парсинга xml файла
 type Config struct {
-	HTTP Http     `xml:"http"`
-	Db   DataBase `xml:"DataBase"`
+	HTTP          Http          `xml:"http"`
+	Db            DataBase      `xml:"DataBase"`
+	Notifications Notifications `xml:"notifications"`
+	Calendar      Calendar      `xml:"calendar"`
 }
 
 // Http - это структура для парсинга
-// информации об http из xml файла
+// информации об http из xml файла.
+// Таймауты указываются в секундах, 0 - значение по умолчанию.
 type Http struct {
-	XMLName xml.Name `xml:"http"`
-	Port    int      `xml:"port,attr"`
-	Host    string   `xml:"host,attr"`
+	XMLName           xml.Name `xml:"http"`
+	Port              int      `xml:"port,attr"`
+	Host              string   `xml:"host,attr"`
+	GRPCPort          int      `xml:"grpcport,attr"` // 0 - gRPC сервер не запускается
+	ReadTimeout       int      `xml:"readtimeout,attr"`
+	ReadHeaderTimeout int      `xml:"readheadertimeout,attr"`
+	WriteTimeout      int      `xml:"writetimeout,attr"`
+	IdleTimeout       int      `xml:"idletimeout,attr"`
+	ShutdownTimeout   int      `xml:"shutdowntimeout,attr"` // сколько ждать завершения запросов при остановке
+	MaxHeaderBytes    int      `xml:"maxheaderbytes,attr"`  // 0 - значение по умолчанию
+	TLS               TLS      `xml:"tls"`
+	Metrics           Metrics  `xml:"metrics"`
+}
+
+// TLS - это структура для парсинга
+// информации о сертификатах https из xml файла.
+// Если сертификат не указан, то сервер работает по http.
+type TLS struct {
+	XMLName      xml.Name `xml:"tls"`
+	Cert         string   `xml:"cert,attr"`
+	Key          string   `xml:"key,attr"`
+	MinVersion   string   `xml:"minversion,attr"`   // 1.2 или 1.3, по умолчанию 1.2
+	ClientCA     string   `xml:"clientca,attr"`     // сертификаты УЦ терминалов сотрудников, пусто - без проверки терминалов
+	RedirectPort int      `xml:"redirectport,attr"` // порт http, с которого перенаправлять на https, 0 - не перенаправлять
+}
+
+// Metrics - это структура для парсинга
+// информации о служебном http сервере, с которого Prometheus забирает метрики.
+// Метрики отдаются отдельно от API, чтобы их не было видно снаружи: по умолчанию только на 127.0.0.1.
+type Metrics struct {
+	XMLName xml.Name `xml:"metrics"`
+	Host    string   `xml:"host,attr"` // пусто - 127.0.0.1
+	Port    int      `xml:"port,attr"` // 0 - метрики не отдаются
 }
 
 // DataBase - это структура для парсинга
@@ -35,6 +68,51 @@ type DataBase struct {
 	SSLmode  string   `xml:"sslmode"`
 }
 
+// Notifications - это структура для парсинга
+// информации о каналах уведомлений из xml файла
+type Notifications struct {
+	XMLName  xml.Name `xml:"notifications"`
+	SMTP     SMTP     `xml:"smtp"`
+	SMS      SMS      `xml:"sms"`
+	Telegram Telegram `xml:"telegram"`
+}
+
+// SMTP - это структура для парсинга
+// информации о почтовом сервере из xml файла
+type SMTP struct {
+	XMLName  xml.Name `xml:"smtp"`
+	Host     string   `xml:"host,attr"`
+	Port     int      `xml:"port,attr"`
+	User     string   `xml:"user,attr"`
+	Password string   `xml:"password,attr"`
+	From     string   `xml:"from,attr"`
+}
+
+// SMS - это структура для парсинга
+// информации об http шлюзе для отправки sms из xml файла
+type SMS struct {
+	XMLName xml.Name `xml:"sms"`
+	URL     string   `xml:"url,attr"`
+	APIKey  string   `xml:"apikey,attr"`
+	Sender  string   `xml:"sender,attr"`
+}
+
+// Telegram - это структура для парсинга
+// информации о telegram боте из xml файла
+type Telegram struct {
+	XMLName xml.Name `xml:"telegram"`
+	Token   string   `xml:"token,attr"`
+	APIURL  string   `xml:"apiurl,attr"`
+}
+
+// Calendar - это структура для парсинга
+// информации о сервисе для календарей клиентов из xml файла
+type Calendar struct {
+	XMLName  xml.Name `xml:"calendar"`
+	Name     string   `xml:"name,attr"`
+	Location string   `xml:"location,attr"`
+}
+
 // Get - это функция парсит xml конфиг, находящийся в файле "source"
 // а также проверяет его на правильность
 func Get(source string) Config {
@@ -65,6 +143,41 @@ func validating(config Config) error {
 		return fmt.Errorf("Фатал. Не валидный номер http порта(от 1024 до 65535), а вы ввели %v", config.HTTP.Port)
 	}
 
+	if config.HTTP.GRPCPort != 0 && (config.HTTP.GRPCPort < 1024 || config.HTTP.GRPCPort >= 65535 || config.HTTP.GRPCPort == config.HTTP.Port) {
+		return fmt.Errorf("Фатал. Не валидный номер gRPC порта(от 1024 до 65535, не совпадает с http портом), а вы ввели %v", config.HTTP.GRPCPort)
+	}
+
+	if config.HTTP.ReadTimeout < 0 || config.HTTP.ReadHeaderTimeout < 0 || config.HTTP.WriteTimeout < 0 ||
+		config.HTTP.IdleTimeout < 0 || config.HTTP.ShutdownTimeout < 0 {
+		return fmt.Errorf("Фатал. Таймауты http сервера не могут быть отрицательными")
+	}
+
+	if config.HTTP.MaxHeaderBytes < 0 {
+		return fmt.Errorf("Фатал. Не валидный максимальный размер заголовков http запроса, а вы ввели %v", config.HTTP.MaxHeaderBytes)
+	}
+
+	if (config.HTTP.TLS.Cert == "") != (config.HTTP.TLS.Key == "") {
+		return fmt.Errorf("Фатал. Для https нужно указать и сертификат, и ключ")
+	}
+
+	if config.HTTP.TLS.MinVersion != "" && config.HTTP.TLS.MinVersion != "1.2" && config.HTTP.TLS.MinVersion != "1.3" {
+		return fmt.Errorf("Фатал. Не валидная минимальная версия TLS(1.2 или 1.3), а вы ввели %q", config.HTTP.TLS.MinVersion)
+	}
+
+	if config.HTTP.TLS.Cert == "" && (config.HTTP.TLS.ClientCA != "" || config.HTTP.TLS.RedirectPort != 0) {
+		return fmt.Errorf("Фатал. Проверка терминалов сотрудников и перенаправление на https работают только вместе с сертификатом https")
+	}
+
+	if config.HTTP.TLS.RedirectPort != 0 && (config.HTTP.TLS.RedirectPort < 1 || config.HTTP.TLS.RedirectPort >= 65535 ||
+		config.HTTP.TLS.RedirectPort == config.HTTP.Port || config.HTTP.TLS.RedirectPort == config.HTTP.GRPCPort) {
+		return fmt.Errorf("Фатал. Не валидный номер порта перенаправления на https(от 1 до 65535, не совпадает с другими портами), а вы ввели %v", config.HTTP.TLS.RedirectPort)
+	}
+
+	if config.HTTP.Metrics.Port != 0 && (config.HTTP.Metrics.Port < 1 || config.HTTP.Metrics.Port >= 65535 ||
+		config.HTTP.Metrics.Port == config.HTTP.Port || config.HTTP.Metrics.Port == config.HTTP.GRPCPort || config.HTTP.Metrics.Port == config.HTTP.TLS.RedirectPort) {
+		return fmt.Errorf("Фатал. Не валидный номер порта метрик(от 1 до 65535, не совпадает с другими портами), а вы ввели %v", config.HTTP.Metrics.Port)
+	}
+
 	if strings.ContainsAny(config.Db.DBname, "/\\.\"*<>:|?$,'") {
 		return fmt.Errorf("Фатал. Не валидное имя базы данных(не должно быть символов /, \\, ., \", *, <, >, :, |, ?, $), введено: %q", config.Db.DBname)
 	}
@@ -81,6 +194,14 @@ func validating(config Config) error {
 		return fmt.Errorf("Фатал. Не валидный пароль от базы данных")
 	}
 
+	if config.Notifications.SMTP.Host != "" && (config.Notifications.SMTP.Port < 1 || config.Notifications.SMTP.Port >= 65535) {
+		return fmt.Errorf("Фатал. Не валидный номер smtp порта(от 1 до 65535), а вы ввели %v", config.Notifications.SMTP.Port)
+	}
+
+	if config.Notifications.SMTP.Host != "" && config.Notifications.SMTP.From == "" {
+		return fmt.Errorf("Фатал. Не указан адрес отправителя для smtp")
+	}
+
 	log.Printf("Инфо. Конфиг успешно прошел проверку.")
 	return nil
 }
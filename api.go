@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// apiRoute - маршрут версии API: метод, шаблон пути, уровень доступа и обработчик.
+// Параметры пути записываются в шаблоне в фигурных скобках, например /cars/{id},
+// и передаются обработчику как значения формы с тем же именем.
+type apiRoute struct {
+	method   string
+	pattern  string
+	segments []string
+	access   string
+	handler  http.Handler
+}
+
+// apiRouter - маршрутизатор версии API. Выбирает обработчик по методу и пути,
+// переводит json тело запроса и параметры пути в значения формы,
+// чтобы одни и те же обработчики обслуживали и API, и старые маршруты.
+type apiRouter struct {
+	prefix string
+	routes []*apiRoute
+}
+
+// newAPIRouter - конструктор для маршрутизатора версии API с префиксом prefix.
+func newAPIRouter(prefix string) *apiRouter {
+	return &apiRouter{prefix: prefix}
+}
+
+// handle - добавляет маршрут с уровнем доступа access, см. protect. Маршруты проверяются в порядке добавления.
+func (router *apiRouter) handle(method string, pattern string, access string, handler http.HandlerFunc) {
+	router.routes = append(router.routes, &apiRoute{
+		method:   method,
+		pattern:  router.prefix + pattern,
+		segments: strings.Split(strings.Trim(pattern, "/"), "/"),
+		access:   access,
+		handler:  protect(access, handler),
+	})
+}
+
+// route - маршрут по ключу "МЕТОД шаблон", как в apiOperations. Ключ задается в коде, поэтому
+// неизвестный ключ - ошибка в коде, и сервис с ней не запускается.
+func (router *apiRouter) route(key string) *apiRoute {
+	for _, route := range router.routes {
+		if route.key() == key {
+			return route
+		}
+	}
+
+	log.Fatalln("Фатал. Нет маршрута API " + key)
+	return nil
+}
+
+// key - ключ маршрута "МЕТОД шаблон" без префикса версии API.
+func (route *apiRoute) key() string {
+	return route.method + " /" + strings.Join(route.segments, "/")
+}
+
+// ServeHTTP - находит маршрут для запроса и вызывает его обработчик.
+// Если путь известен, но метод не подходит, то отвечает 405 со списком допустимых методов.
+func (router *apiRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, router.prefix), "/"), "/")
+
+	allowed := make([]string, 0)
+	for _, route := range router.routes {
+		params, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+
+		if route.method != r.Method {
+			allowed = append(allowed, route.method)
+			continue
+		}
+
+		setMetricsRoute(r, route.pattern)
+		if !parseAPIRequest(w, r, params) {
+			return
+		}
+
+		route.handler.ServeHTTP(w, r)
+		return
+	}
+
+	if len(allowed) == 0 {
+		writeError(w, http.StatusNotFound, CodeNotFound)
+		return
+	}
+
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method, r.URL.Path)
+}
+
+// match - проверяет путь запроса на соответствие шаблону маршрута и возвращает параметры пути.
+func (route *apiRoute) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(route.segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range route.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[segment[1:len(segment)-1]] = segments[i]
+			continue
+		}
+		if segment != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// parseAPIRequest - разбирает тело запроса в значения формы: json объект поле за полем,
+// а остальные типы тел так же, как для старых маршрутов. Параметры пути добавляются поверх.
+// Если тело запроса разобрать не удалось, то сам отвечает клиенту и возвращает false.
+func parseAPIRequest(w http.ResponseWriter, r *http.Request, params map[string]string) bool {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if contentType == "application/json" {
+		r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodySize)
+
+		values, err := decodeJSONForm(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidBody, err.Error())
+			return false
+		}
+
+		r.Form = r.URL.Query()
+		r.PostForm = values
+		for key, value := range values {
+			r.Form[key] = append(append([]string{}, value...), r.Form[key]...)
+		}
+	} else {
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+
+		err := r.ParseMultipartForm(maxAttachmentSize)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, maxRequestBodySize>>20)
+			return false
+		}
+		if err != nil && err != http.ErrNotMultipart {
+			writeError(w, http.StatusBadRequest, CodeInvalidBody, err.Error())
+			return false
+		}
+	}
+
+	for key, value := range params {
+		r.Form.Set(key, value)
+	}
+
+	return true
+}
+
+// decodeJSONForm - переводит json объект в значения формы. Строки, числа и логические значения
+// записываются как есть, массивы таких значений - несколькими значениями, null пропускается.
+func decodeJSONForm(body io.Reader) (url.Values, error) {
+	object := make(map[string]interface{})
+
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	err := decoder.Decode(&object)
+	if err == io.EOF {
+		return url.Values{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	for key, value := range object {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+
+		for _, item := range items {
+			switch item := item.(type) {
+			case nil:
+			case string:
+				values.Add(key, item)
+			case json.Number:
+				values.Add(key, item.String())
+			case bool:
+				values.Add(key, fmt.Sprint(item))
+			default:
+				return nil, fmt.Errorf("поле %q должно быть строкой, числом, логическим значением или их массивом", key)
+			}
+		}
+	}
+
+	return values, nil
+}
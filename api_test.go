@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testRouter - маршрутизатор с публичными маршрутами, обработчики которых отвечают своим названием
+// и значениями формы id и q.
+func testRouter() *apiRouter {
+	router := newAPIRouter("/api/v1")
+	for _, route := range []struct{ method, pattern, name string }{
+		{http.MethodGet, "/cars/{id}", "get"},
+		{http.MethodDelete, "/cars/{id}", "delete"},
+		{http.MethodGet, "/cars/{id}/history", "history"},
+		{http.MethodPost, "/cars", "create"},
+	} {
+		name := route.name
+		router.handle(route.method, route.pattern, accessPublic, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + " id=" + r.FormValue("id") + " q=" + strings.Join(r.Form["q"], ",")))
+		})
+	}
+
+	return router
+}
+
+// TestAPIRouterMatch - маршрут выбирается по методу и пути, параметры пути передаются значениями формы,
+// для известного пути с другим методом - 405 со списком методов в Allow.
+func TestAPIRouterMatch(t *testing.T) {
+	router := testRouter()
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/api/v1/cars/7", http.StatusOK, "get id=7 q="},
+		{http.MethodGet, "/api/v1/cars/7/", http.StatusOK, "get id=7 q="},
+		{http.MethodDelete, "/api/v1/cars/7", http.StatusOK, "delete id=7 q="},
+		{http.MethodGet, "/api/v1/cars/7/history?q=1", http.StatusOK, "history id=7 q=1"},
+		{http.MethodGet, "/api/v1/cars/7?id=8", http.StatusOK, "get id=7 q="},
+		{http.MethodGet, "/api/v1/cars//history", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/v1/trucks/7", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(test.method, test.path, nil))
+		if recorder.Code != test.code {
+			t.Errorf("%s %s: код %d, ответ %s", test.method, test.path, recorder.Code, recorder.Body.String())
+			continue
+		}
+		if test.code == http.StatusOK && recorder.Body.String() != test.body {
+			t.Errorf("%s %s: ответ %s, ожидалось %s", test.method, test.path, recorder.Body.String(), test.body)
+		}
+		if test.code == http.StatusNotFound && errorCode(recorder) != CodeNotFound {
+			t.Errorf("%s %s: ответ %s", test.method, test.path, recorder.Body.String())
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/api/v1/cars/7", nil))
+	if recorder.Code != http.StatusMethodNotAllowed || errorCode(recorder) != CodeMethodNotAllowed {
+		t.Errorf("PUT: код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+	if allow := recorder.Header().Get("Allow"); allow != "DELETE, GET" {
+		t.Errorf("Allow: %q", allow)
+	}
+}
+
+// TestAPIRouterJSONBody - json тело переводится в значения формы, значения из тела идут раньше
+// значений из строки запроса, а параметры пути заменяют и те, и другие.
+func TestAPIRouterJSONBody(t *testing.T) {
+	router := testRouter()
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/cars?q=query", strings.NewReader(`{"q": ["a", 2], "id": 5}`))
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Body.String() != "create id=5 q=a,2,query" {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	request = httptest.NewRequest(http.MethodDelete, "/api/v1/cars/7", strings.NewReader(`{"id": 8}`))
+	request.Header.Set("Content-Type", "application/json")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Body.String() != "delete id=7 q=" {
+		t.Errorf("параметр пути: код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	request = httptest.NewRequest(http.MethodPost, "/api/v1/cars", strings.NewReader(`{"id": `))
+	request.Header.Set("Content-Type", "application/json")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusBadRequest || errorCode(recorder) != CodeInvalidBody {
+		t.Errorf("некорректный json: код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+// TestDecodeJSONForm - строки, числа, логические значения и их массивы становятся значениями формы,
+// null пропускается, вложенные объекты не принимаются.
+func TestDecodeJSONForm(t *testing.T) {
+	values, err := decodeJSONForm(strings.NewReader(`{"name": "Lada", "mileage": 12500, "cost": 4500.50,
+		"unanswered": true, "ids": [1, "2"], "plate": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := url.Values{
+		"name":       {"Lada"},
+		"mileage":    {"12500"},
+		"cost":       {"4500.50"},
+		"unanswered": {"true"},
+		"ids":        {"1", "2"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("decodeJSONForm = %v, ожидалось %v", values, expected)
+	}
+
+	values, err = decodeJSONForm(strings.NewReader(""))
+	if err != nil || len(values) != 0 {
+		t.Errorf("пустое тело: %v, %v", values, err)
+	}
+
+	for _, body := range []string{`{"car": {"id": 1}}`, `{"ids": [[1]]}`, `[1, 2]`} {
+		if _, err = decodeJSONForm(strings.NewReader(body)); err == nil {
+			t.Errorf("%s: ожидалась ошибка", body)
+		}
+	}
+}
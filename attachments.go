@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // регистрация декодера gif для миниатюр
+	"image/jpeg"
+	_ "image/png" // регистрация декодера png для миниатюр
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/lib/pq"
+)
+
+// attachmentTypes - допустимые типы вложений, определяемые по содержимому файла.
+// Значение - можно ли построить для вложения миниатюру.
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"audio/mpeg":      false,
+	"audio/wave":      false,
+	"application/ogg": false,
+	"video/mp4":       false,
+	"application/pdf": false,
+}
+
+// getAndCheckAttachments - получает вложения сообщения из multipart формы и проверяет их тип и размер.
+// Возвращает ошибки валидации, если вложения не прошли проверку.
+func getAndCheckAttachments(r *http.Request) ([]*Attachment, ValidationErrors) {
+	result := make([]*Attachment, 0)
+	resultOfValidation := ValidationErrors{}
+
+	err := r.ParseMultipartForm(maxAttachmentSize)
+	if err == http.ErrNotMultipart {
+		return result, resultOfValidation
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		resultOfValidation.add(formAttachmentName, CodeBodyTooLarge, maxRequestBodySize>>20)
+		return nil, resultOfValidation
+	}
+	if err != nil {
+		resultOfValidation.add(formAttachmentName, CodeAttachmentsRead)
+		return nil, resultOfValidation
+	}
+
+	headers := r.MultipartForm.File[formAttachmentName]
+	if len(headers) > maxAttachmentsPerMessage {
+		resultOfValidation.add(formAttachmentName, CodeTooManyFiles, maxAttachmentsPerMessage)
+	}
+
+	for _, header := range headers {
+		attachment, code, args := openAttachment(header)
+		if code != "" {
+			resultOfValidation.add(formAttachmentName, code, args...)
+			continue
+		}
+		result = append(result, attachment)
+	}
+
+	if len(resultOfValidation) != 0 {
+		closeAttachments(result)
+		return nil, resultOfValidation
+	}
+
+	return result, resultOfValidation
+}
+
+// openAttachment - открывает файл вложения и определяет его тип по содержимому.
+// Если вложение не прошло проверку, возвращает код ошибки и подстановки в ее текст.
+func openAttachment(header *multipart.FileHeader) (*Attachment, string, []interface{}) {
+	if header.Size > maxAttachmentSize {
+		return nil, CodeAttachmentSize, []interface{}{header.Filename, maxAttachmentSize >> 20}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		log.Println("Ошибка. При открытии вложения: " + err.Error())
+		return nil, CodeAttachmentsRead, nil
+	}
+
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		log.Println("Ошибка. При чтении вложения: " + err.Error())
+		file.Close()
+		return nil, CodeAttachmentsRead, nil
+	}
+
+	attachment := &Attachment{
+		FileName:    filepath.Base(header.Filename),
+		ContentType: http.DetectContentType(sniff[:n]),
+		Size:        header.Size,
+		file:        file,
+	}
+
+	if _, ok := attachmentTypes[attachment.ContentType]; !ok {
+		file.Close()
+		return nil, CodeAttachmentType, []interface{}{header.Filename}
+	}
+
+	return attachment, "", nil
+}
+
+// saveAttachments - сохраняет вложения сообщения в БД через exec и в хранилище файлов,
+// а для изображений еще и миниатюры. Если миниатюру построить не удалось, то вложение сохраняется без нее.
+// При ошибке уже записанные файлы остаются, их удаляет removeAttachmentFiles после отката транзакции.
+func saveAttachments(exec sqlExecutor, message *Message) error {
+	for _, attachment := range message.Attachments {
+		attachment.MessageID = message.ID
+
+		var thumbnail []byte
+		if attachmentTypes[attachment.ContentType] {
+			var err error
+			thumbnail, err = makeThumbnail(attachment.file)
+			if err != nil {
+				log.Printf("Ошибка. При создании миниатюры вложения %q: %s\n", attachment.FileName, err.Error())
+			}
+		}
+		attachment.HasThumbnail = thumbnail != nil
+
+		err := exec.QueryRow(`INSERT INTO attachments(messageid, filename, contenttype, size, hasthumbnail) VALUES($1, $2, $3, $4, $5) RETURNING id`,
+			attachment.MessageID, attachment.FileName, attachment.ContentType, attachment.Size, attachment.HasThumbnail).Scan(&attachment.ID)
+		if err != nil {
+			return err
+		}
+
+		err = saveFile(attachment.file, attachmentFileName(attachment.ID, false))
+		if err != nil {
+			return err
+		}
+
+		if attachment.HasThumbnail {
+			err = saveFile(bytes.NewReader(thumbnail), attachmentFileName(attachment.ID, true))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeAttachmentFiles - удаляет из хранилища файлы вложений, которые не попали в БД.
+func removeAttachmentFiles(attachments []*Attachment) {
+	for _, attachment := range attachments {
+		if attachment.ID == "" {
+			continue
+		}
+
+		for _, thumbnail := range []bool{false, true} {
+			err := os.Remove(storageDirectory + attachmentFileName(attachment.ID, thumbnail))
+			if err != nil && !os.IsNotExist(err) {
+				log.Println("Ошибка. При удалении файла вложения: " + err.Error())
+			}
+		}
+		attachment.ID = ""
+	}
+}
+
+// closeAttachments - закрывает загруженные файлы вложений.
+func closeAttachments(attachments []*Attachment) {
+	for _, attachment := range attachments {
+		attachment.file.Close()
+	}
+}
+
+// getAttachmentHandler - отдает вложение сообщения или его миниатюру.
+// Доступно только участникам заказа и сотрудникам сервиса.
+func getAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	attachmentID := r.FormValue("id")
+	thumbnail := r.FormValue("thumbnail") == "true"
+
+	attachment := Attachment{}
+	err := db.QueryRow(`SELECT a.id, a.filename, a.contenttype, a.hasthumbnail FROM attachments a
+	JOIN messages m ON m.id = a.messageid JOIN orders ON orders.id = m.orderid
+	WHERE a.id = $2 AND (`+visibleOrdersCondition+` OR EXISTS(SELECT 1 FROM users WHERE id = $1 AND isstaff = TRUE))`, id, attachmentID).
+		Scan(&attachment.ID, &attachment.FileName, &attachment.ContentType, &attachment.HasThumbnail)
+	if err == sql.ErrNoRows {
+		log.Printf("Инфо. Пользователь (ид = %s) запросил недоступное вложение(ид = %s)", id, attachmentID)
+		writeError(w, http.StatusNotFound, CodeAttachmentMissing)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД вложения: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	if thumbnail && !attachment.HasThumbnail {
+		writeError(w, http.StatusBadRequest, CodeNoThumbnail)
+		return
+	}
+
+	fileName := storageDirectory + attachmentFileName(attachment.ID, thumbnail)
+	if _, err = os.Stat(fileName); err != nil {
+		log.Println("Ошибка. Файл вложения не найден в хранилище: " + err.Error())
+		writeError(w, http.StatusNotFound, CodeAttachmentMissing)
+		return
+	}
+
+	if thumbnail {
+		w.Header().Set("Content-Type", "image/jpeg")
+	} else {
+		w.Header().Set("Content-Type", attachment.ContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", attachment.FileName))
+	}
+
+	http.ServeFile(w, r, fileName)
+}
+
+// getMessagesAttachments - заполняет вложения сообщений.
+func getMessagesAttachments(messages []*Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*Message)
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		message.Attachments = make([]*Attachment, 0)
+		byID[message.ID] = message
+		ids = append(ids, message.ID)
+	}
+
+	rows, err := db.Query(`SELECT id, messageid, filename, contenttype, size, hasthumbnail FROM attachments
+	WHERE messageid = ANY($1::int[]) ORDER BY id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		attachment := Attachment{}
+		err = rows.Scan(&attachment.ID, &attachment.MessageID, &attachment.FileName, &attachment.ContentType, &attachment.Size, &attachment.HasThumbnail)
+		if err != nil {
+			return err
+		}
+
+		if message, ok := byID[attachment.MessageID]; ok {
+			message.Attachments = append(message.Attachments, &attachment)
+		}
+	}
+
+	return rows.Err()
+}
+
+// attachmentFileName - имя файла вложения (или его миниатюры) в хранилище.
+func attachmentFileName(id string, thumbnail bool) string {
+	if thumbnail {
+		return "attachment" + id + "_thumb"
+	}
+
+	return "attachment" + id
+}
+
+// makeThumbnail - уменьшает изображение до thumbnailSize точек по большей стороне и кодирует в jpeg.
+// Изображения больше maxThumbnailPixels точек не декодируются.
+func makeThumbnail(readSeeker io.ReadSeeker) ([]byte, error) {
+	_, err := readSeeker.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(readSeeker)
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > maxThumbnailPixels/config.Height {
+		return nil, fmt.Errorf("изображение %dx%d слишком большое для миниатюры", config.Width, config.Height)
+	}
+
+	_, err = readSeeker.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	src, _, err := image.Decode(readSeeker)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > thumbnailSize || height > thumbnailSize {
+		if width > height {
+			width, height = thumbnailSize, height*thumbnailSize/width
+		} else {
+			width, height = width*thumbnailSize/height, thumbnailSize
+		}
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dst.Set(x, y, src.At(bounds.Min.X+x*bounds.Dx()/width, bounds.Min.Y+y*bounds.Dy()/height))
+		}
+	}
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// memoryFile - файл вложения в памяти.
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error { return nil }
+
+// pngHeader - начало png файла, в заголовке которого объявлены размеры width x height.
+// Данных изображения нет, но размеры из заголовка читаются.
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8] = 8 // бит на канал
+	ihdr[9] = 6 // RGBA
+
+	chunk := append([]byte("IHDR"), ihdr...)
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+
+	return buf.Bytes()
+}
+
+// TestMakeThumbnailRejectsHugeImage - изображение с огромными размерами в заголовке не декодируется.
+func TestMakeThumbnailRejectsHugeImage(t *testing.T) {
+	_, err := makeThumbnail(bytes.NewReader(pngHeader(50000, 50000)))
+	if err == nil || !strings.Contains(err.Error(), "50000x50000") {
+		t.Fatalf("ожидалась ошибка о размере изображения, получено: %v", err)
+	}
+}
+
+// TestMakeThumbnail - миниатюра уменьшается до thumbnailSize по большей стороне с сохранением пропорций.
+func TestMakeThumbnail(t *testing.T) {
+	var source bytes.Buffer
+	err := png.Encode(&source, image.NewRGBA(image.Rect(0, 0, 400, 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thumbnail, err := makeThumbnail(bytes.NewReader(source.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(thumbnail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || config.Width != thumbnailSize || config.Height != thumbnailSize/4 {
+		t.Errorf("миниатюра %s %dx%d", format, config.Width, config.Height)
+	}
+}
+
+// TestInsertMessageRollsBack - если одно из вложений не сохранилось, то транзакция откатывается,
+// а файлы уже сохраненных вложений удаляются из хранилища.
+func TestInsertMessageRollsBack(t *testing.T) {
+	t.Chdir(t.TempDir())
+	err := os.Mkdir(storageDirectory, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock := useMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO messages`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("7"))
+	mock.ExpectExec(`INSERT INTO messagereads`).WithArgs("1", "5", "7").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO attachments`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("3"))
+	mock.ExpectQuery(`INSERT INTO attachments`).WillReturnError(errors.New("disk full"))
+	mock.ExpectRollback()
+
+	message := &Message{OrderID: "1", Date: time.Now(), Text: "Фото", Attachments: []*Attachment{
+		{FileName: "a.pdf", ContentType: "application/pdf", file: memoryFile{bytes.NewReader([]byte("%PDF-a"))}},
+		{FileName: "b.pdf", ContentType: "application/pdf", file: memoryFile{bytes.NewReader([]byte("%PDF-b"))}},
+	}}
+
+	err = insertMessage(message, "5")
+	if err == nil {
+		t.Fatal("ожидалась ошибка сохранения вложения")
+	}
+	if message.ID != "" {
+		t.Errorf("у несохраненного сообщения остался ид %s", message.ID)
+	}
+	if _, err = os.Stat(storageDirectory + attachmentFileName("3", false)); !os.IsNotExist(err) {
+		t.Errorf("файл вложения не удален: %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// endlessReader - бесконечный поток байт.
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+	}
+	return len(p), nil
+}
+
+// TestParseAPIRequestBodyLimit - multipart тело больше maxRequestBodySize не дочитывается, клиент получает 413.
+func TestParseAPIRequestBodyLimit(t *testing.T) {
+	body := io.MultiReader(strings.NewReader("--b\r\nContent-Disposition: form-data; name=\"attachment\"; filename=\"a.pdf\"\r\n\r\n"), endlessReader{})
+	request := httptest.NewRequest(http.MethodPost, apiPrefix+"/orders/1/messages", body)
+	request.Header.Set("Content-Type", "multipart/form-data; boundary=b")
+	recorder := httptest.NewRecorder()
+
+	if parseAPIRequest(recorder, request, nil) {
+		t.Fatal("запрос без ограничения размера разобран")
+	}
+	if recorder.Code != http.StatusRequestEntityTooLarge || errorCode(recorder) != CodeBodyTooLarge {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -1,3 +1,6 @@
+-- Текущая схема БД целиком, для новой базы. Существующая база обновляется миграциями
+-- из каталога migrations при запуске сервиса. При изменении схемы нужны и новая миграция, и правка этого файла.
+
 CREATE TABLE users (
 id serial PRIMARY KEY,
 login varchar (25) NOT NULL UNIQUE,
@@ -5,7 +8,22 @@ password varchar (50) NOT NULL,
 name varchar(50),
 lastName varchar (50) NOT NULL,
 phone varchar (20) NOT NULL,
-profileImage boolean NOT NULL 
+profileImage boolean NOT NULL,
+isstaff boolean NOT NULL DEFAULT FALSE,
+language varchar(2) NOT NULL DEFAULT ''
+);
+
+
+CREATE TABLE organisations (
+id serial PRIMARY KEY,
+name varchar (100) NOT NULL
+);
+
+CREATE TABLE orgmembers (
+orgID integer REFERENCES organisations(id),
+userID integer REFERENCES users(id),
+role smallint NOT NULL,
+PRIMARY KEY (orgID, userID)
 );
 
 
@@ -16,7 +34,23 @@ model varchar (50) NOT NULL,
 vin varchar(17),
 year varchar (4) NOT NULL,
 userid integer REFERENCES users(id),
-deleted boolean NOT NULL DEFAULT FALSE
+deleted boolean NOT NULL DEFAULT FALSE,
+plate varchar (12) NOT NULL DEFAULT '',
+platecountry varchar (2) NOT NULL DEFAULT '',
+color varchar (30) NOT NULL DEFAULT '',
+engine varchar (50) NOT NULL DEFAULT '',
+transmission varchar (20) NOT NULL DEFAULT '',
+orgID integer REFERENCES organisations(id)
+);
+
+CREATE TABLE caredits (
+id serial PRIMARY KEY,
+carID integer REFERENCES cars(id),
+userID integer REFERENCES users(id),
+date timestamp NOT NULL,
+field varchar (20) NOT NULL,
+oldvalue varchar NOT NULL,
+newvalue varchar NOT NULL
 );
 
 
@@ -28,7 +62,11 @@ cost integer,
 carID integer REFERENCES cars(id),
 userID integer REFERENCES users(id),
 info varchar NOT NULL,
-newmsgforuser boolean NOT NULL DEFAULT FALSE
+mileage integer,
+assigneeID integer REFERENCES users(id),
+appointmentNotified boolean NOT NULL DEFAULT FALSE,
+updated timestamp NOT NULL DEFAULT now(),
+revision integer NOT NULL DEFAULT 0
 );
 
 
@@ -38,8 +76,150 @@ token char(36) NOT NULL UNIQUE
 );
 
 CREATE TABLE messages (
+id serial PRIMARY KEY,
 isadmin boolean NOT NULL DEFAULT FALSE,
 date timestamp  NOT NULL, 
 text varchar NOT NULL,
 orderID integer REFERENCES orders(id)
-);
\ No newline at end of file
+);
+
+CREATE TABLE attachments (
+id serial PRIMARY KEY,
+messageID integer REFERENCES messages(id),
+filename varchar (255) NOT NULL,
+contenttype varchar (50) NOT NULL,
+size integer NOT NULL,
+hasthumbnail boolean NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE messagereads (
+orderID integer REFERENCES orders(id),
+userID integer REFERENCES users(id),
+lastmessageid integer NOT NULL,
+PRIMARY KEY (orderID, userID)
+);
+
+CREATE TABLE maintenanceschedules (
+id serial PRIMARY KEY,
+brand varchar (20),
+name varchar (100) NOT NULL,
+code varchar (50),
+intervalkm integer NOT NULL DEFAULT 0,
+intervalmonths integer NOT NULL DEFAULT 0
+);
+
+INSERT INTO maintenanceschedules(name, code, intervalkm, intervalmonths) VALUES
+('Замена моторного масла и масляного фильтра', 'schedule_oil_change', 10000, 12),
+('Замена воздушного фильтра', 'schedule_air_filter', 20000, 24),
+('Замена салонного фильтра', 'schedule_cabin_filter', 15000, 12),
+('Замена тормозной жидкости', 'schedule_brake_fluid', 0, 24),
+('Замена свечей зажигания', 'schedule_spark_plugs', 30000, 36),
+('Замена охлаждающей жидкости', 'schedule_coolant', 60000, 48);
+
+CREATE TABLE orderitems (
+id serial PRIMARY KEY,
+orderID integer REFERENCES orders(id),
+name varchar (100) NOT NULL,
+quantity integer NOT NULL DEFAULT 1,
+cost integer NOT NULL,
+scheduleID integer REFERENCES maintenanceschedules(id)
+);
+
+CREATE TABLE odometer (
+id serial PRIMARY KEY,
+vin varchar (17) NOT NULL,
+carID integer REFERENCES cars(id),
+date timestamp NOT NULL,
+mileage integer NOT NULL,
+orderID integer REFERENCES orders(id)
+);
+
+CREATE TABLE carnotes (
+id serial PRIMARY KEY,
+vin varchar (17) NOT NULL,
+carID integer REFERENCES cars(id),
+date timestamp NOT NULL,
+text varchar NOT NULL
+);
+
+CREATE TABLE reminders (
+id serial PRIMARY KEY,
+userID integer REFERENCES users(id),
+carID integer REFERENCES cars(id),
+scheduleID integer REFERENCES maintenanceschedules(id),
+text varchar NOT NULL,
+duemileage integer,
+duedate Date NOT NULL,
+created timestamp NOT NULL,
+sent boolean NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE cartransfers (
+id serial PRIMARY KEY,
+carID integer REFERENCES cars(id),
+fromUserID integer REFERENCES users(id),
+toUserID integer REFERENCES users(id),
+status smallint NOT NULL,
+created timestamp NOT NULL,
+resolved timestamp
+);
+
+CREATE TABLE messagetemplates (
+id serial PRIMARY KEY,
+name varchar (100) NOT NULL,
+text varchar NOT NULL
+);
+
+INSERT INTO messagetemplates(name, text) VALUES
+('Машина готова', '{customerName}, ваш автомобиль {carInfo} готов, его можно забрать. Стоимость работ: {cost} руб.'),
+('Согласование доп. работ', '{customerName}, при обслуживании {carInfo} обнаружены неисправности, требующие дополнительных работ. Пожалуйста, подтвердите их выполнение.');
+
+CREATE TABLE notificationprefs (
+userID integer REFERENCES users(id),
+channel varchar (10) NOT NULL,
+address varchar (255) NOT NULL,
+enabled boolean NOT NULL,
+PRIMARY KEY (userID, channel)
+);
+
+CREATE TABLE notifications (
+id serial PRIMARY KEY,
+userID integer REFERENCES users(id),
+channel varchar (10) NOT NULL,
+address varchar (255) NOT NULL,
+orderID integer REFERENCES orders(id),
+subject varchar NOT NULL,
+text varchar NOT NULL,
+created timestamp NOT NULL,
+attempts integer NOT NULL DEFAULT 0,
+nextattempt timestamp NOT NULL,
+sent timestamp,
+lasterror varchar
+);
+
+CREATE INDEX notifications_pending ON notifications(nextattempt) WHERE sent IS NULL;
+
+CREATE TABLE telegramlinks (
+code varchar (36) PRIMARY KEY,
+userID integer REFERENCES users(id),
+created timestamp NOT NULL
+);
+
+CREATE TABLE telegrammessages (
+chatID bigint NOT NULL,
+messageID bigint NOT NULL,
+orderID integer REFERENCES orders(id),
+PRIMARY KEY (chatID, messageID)
+);
+
+CREATE TABLE calendarfeeds (
+userID integer PRIMARY KEY REFERENCES users(id),
+token varchar (36) NOT NULL UNIQUE,
+created timestamp NOT NULL
+);
+
+CREATE TABLE schemaversion (
+version integer NOT NULL
+);
+
+INSERT INTO schemaversion(version) VALUES (17);
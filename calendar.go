@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/STEJLS/ServiceStation/XMLconfig"
+)
+
+// calendarSettings - название и адрес сервиса, которые попадают в события календаря.
+var calendarSettings XMLconfig.Calendar
+
+// orderRevised - изменение заказа, которое видно в календаре. Время изменения и номер ревизии
+// попадают в LAST-MODIFIED и SEQUENCE события, иначе календарные клиенты не обновляют уже загруженное событие.
+const orderRevised = `updated = now(), revision = revision + 1`
+
+// calendarStatuses - статус события календаря по статусу заказа. Закрытый заказ - визит состоялся,
+// событие остается подтвержденным. Отменяются только отмененные заказы и записи по удаленным машинам.
+var calendarStatuses = map[int]string{
+	StatusOpen:      "TENTATIVE",
+	StatusСonfirmed: "CONFIRMED",
+	StatusClosed:    "CONFIRMED",
+	StatusCancelled: "CANCELLED",
+}
+
+// calendarFeedPath - путь, по которому отдаются календари. Следом идет секретный токен и .ics.
+const calendarFeedPath = "/calendar/"
+
+// getCalendarFeedHandler - отдает пользователю секретную ссылку на его календарь записей,
+// создавая ее при первом обращении.
+func getCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	var token string
+	err := db.QueryRow(`SELECT token FROM calendarfeeds WHERE userid = $1`, id).Scan(&token)
+	if err == sql.ErrNoRows {
+		token = generateToken()
+		_, err = db.Exec(`INSERT INTO calendarfeeds(userid, token, created) VALUES($1, $2, $3)`, id, token, time.Now())
+	}
+	if err != nil {
+		log.Printf("Ошибка. При получении ссылки на календарь пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	writeCalendarFeedURL(w, r, token)
+}
+
+// resetCalendarFeedHandler - выдает пользователю новую ссылку на календарь, старая перестает работать.
+func resetCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	token := generateToken()
+	_, err := db.Exec(`INSERT INTO calendarfeeds(userid, token, created) VALUES($1, $2, $3)
+	ON CONFLICT (userid) DO UPDATE SET token = EXCLUDED.token, created = EXCLUDED.created`, id, token, time.Now())
+	if err != nil {
+		log.Printf("Ошибка. При смене ссылки на календарь пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	log.Printf("Инфо. Пользователь (ид = %s) сменил ссылку на календарь", id)
+	writeCalendarFeedURL(w, r, token)
+}
+
+// writeCalendarFeedURL - отдает клиенту полную ссылку на календарь с указанным токеном.
+func writeCalendarFeedURL(w http.ResponseWriter, r *http.Request, token string) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	data, err := json.Marshal(struct{ URL string }{scheme + "://" + r.Host + calendarFeedPath + token + ".ics"})
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// calendarFeedHandler - отдает календарь записей в формате iCalendar по секретной ссылке, без cookie,
+// так как календарные приложения не умеют авторизовываться.
+// В календарь попадают заказы, которые видит пользователь, и заказы, за которые он отвечает как сотрудник.
+// Календарь строится при каждом запросе, поэтому перенос или отмена записи видны при следующей синхронизации.
+func calendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, calendarFeedPath), ".ics")
+
+	var id, lang string
+	err := db.QueryRow(`SELECT f.userid, u.language FROM calendarfeeds f JOIN users u ON u.id = f.userid
+	WHERE f.token = $1`, token).Scan(&id, &lang)
+	if err == sql.ErrNoRows {
+		log.Println("Инфо. Попытка получить календарь по недействительной ссылке.")
+		writeError(w, http.StatusNotFound, CodeCalendarNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД ссылки на календарь: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	rows, err := db.Query(`SELECT orders.id, orders.status, orders.date, orders.info, orders.updated, orders.revision,
+	cars.brand, cars.model, cars.year, cars.plate, cars.deleted
+	FROM orders JOIN cars ON cars.id = orders.carid
+	WHERE (`+visibleOrdersCondition+` OR orders.assigneeid = $1) AND orders.date >= $2 ORDER BY orders.date`,
+		id, time.Now().AddDate(0, -calendarPastMonths, 0))
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД записей для календаря пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	defer rows.Close()
+
+	// Календарные клиенты обычно не присылают Accept-Language, поэтому важнее язык владельца ссылки.
+	if lang != "" {
+		w.Header().Set("Content-Language", lang)
+	}
+	lang = responseLanguage(w)
+
+	var ics bytes.Buffer
+	now := time.Now().UTC().Format(calendarTimeFormat)
+
+	writeCalendarLine(&ics, "BEGIN:VCALENDAR")
+	writeCalendarLine(&ics, "VERSION:2.0")
+	writeCalendarLine(&ics, "PRODID:-//ServiceStation//Orders//"+strings.ToUpper(lang))
+	writeCalendarLine(&ics, "CALSCALE:GREGORIAN")
+	writeCalendarLine(&ics, "X-WR-CALNAME:"+escapeCalendarText(calendarSettings.Name))
+
+	for rows.Next() {
+		order := Order{}
+		car := Car{}
+		var date, updated time.Time
+		var revision int
+		var deleted bool
+		err = rows.Scan(&order.ID, &order.Status, &date, &order.Info, &updated, &revision, &car.Brand, &car.Model, &car.Year, &car.Plate, &deleted)
+		if err != nil {
+			log.Printf("Ошибка. При выборке из БД записей для календаря пользователя(ид =  %s): %s\n", id, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+
+		summary := localize(lang, CalendarSummary, fmt.Sprintf("%s %s(%s)", car.Brand, car.Model, car.Year))
+		if car.Plate != "" {
+			summary += " " + car.Plate
+		}
+
+		status, ok := calendarStatuses[order.Status]
+		if !ok {
+			log.Printf("Ошибка. Нет статуса события календаря для статуса заказа %d(ид заказа = %s)\n", order.Status, order.ID)
+		}
+		if deleted {
+			status = "CANCELLED"
+		}
+
+		writeCalendarLine(&ics, "BEGIN:VEVENT")
+		writeCalendarLine(&ics, "UID:order-"+order.ID+"@servicestation")
+		writeCalendarLine(&ics, "DTSTAMP:"+now)
+		writeCalendarLine(&ics, "LAST-MODIFIED:"+updated.UTC().Format(calendarTimeFormat))
+		writeCalendarLine(&ics, "SEQUENCE:"+strconv.Itoa(revision))
+		writeCalendarLine(&ics, "DTSTART;VALUE=DATE:"+date.Format("20060102"))
+		writeCalendarLine(&ics, "DTEND;VALUE=DATE:"+date.AddDate(0, 0, 1).Format("20060102"))
+		writeCalendarLine(&ics, "SUMMARY:"+escapeCalendarText(summary))
+		writeCalendarLine(&ics, "DESCRIPTION:"+escapeCalendarText(localize(lang, CalendarDescription, order.ID, order.Info)))
+		if calendarSettings.Location != "" {
+			writeCalendarLine(&ics, "LOCATION:"+escapeCalendarText(calendarSettings.Location))
+		}
+		if status != "" {
+			writeCalendarLine(&ics, "STATUS:"+status)
+		}
+		writeCalendarLine(&ics, "END:VEVENT")
+	}
+
+	writeCalendarLine(&ics, "END:VCALENDAR")
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	_, err = w.Write(ics.Bytes())
+	if err != nil {
+		log.Println("Ошибка. При отдачи календаря: " + err.Error())
+	}
+}
+
+// escapeCalendarText - экранирует спецсимволы в текстовом значении iCalendar.
+func escapeCalendarText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// writeCalendarLine - записывает строку iCalendar, перенося ее по calendarLineLimit байт
+// и не разрывая при этом символы utf-8.
+func writeCalendarLine(buf *bytes.Buffer, line string) {
+	limit := calendarLineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		buf.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = calendarLineLimit - 1 // продолжение строки начинается с пробела
+	}
+	buf.WriteString(line + "\r\n")
+}
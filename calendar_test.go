@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// TestCalendarFeedEvents - события календаря отражают статус заказа и номер его ревизии,
+// закрытый заказ остается подтвержденным, отмененный заказ и заказ по удаленной машине отменяются.
+func TestCalendarFeedEvents(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery(`FROM calendarfeeds`).WithArgs("feed-token").
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "language"}).AddRow("5", LangEN))
+
+	date := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)
+	updated := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	columns := []string{"id", "status", "date", "info", "updated", "revision", "brand", "model", "year", "plate", "deleted"}
+	mock.ExpectQuery(`FROM orders JOIN cars`).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow("1", StatusOpen, date, "", updated, 0, "Lada", "Vesta", "2020", "", false).
+		AddRow("2", StatusСonfirmed, date, "", updated, 1, "Lada", "Vesta", "2020", "", false).
+		AddRow("3", StatusClosed, date, "", updated, 2, "Lada", "Vesta", "2020", "", false).
+		AddRow("4", StatusСonfirmed, date, "", updated, 3, "Lada", "Vesta", "2020", "", true).
+		AddRow("5", StatusCancelled, date, "", updated, 4, "Lada", "Vesta", "2020", "", false))
+
+	recorder := httptest.NewRecorder()
+	withLanguage(http.HandlerFunc(calendarFeedHandler)).
+		ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, calendarFeedPath+"feed-token.ics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	events := strings.Split(recorder.Body.String(), "BEGIN:VEVENT")[1:]
+	expected := []struct {
+		status   string
+		sequence string
+	}{
+		{"STATUS:TENTATIVE", "SEQUENCE:0"},
+		{"STATUS:CONFIRMED", "SEQUENCE:1"},
+		{"STATUS:CONFIRMED", "SEQUENCE:2"},
+		{"STATUS:CANCELLED", "SEQUENCE:3"},
+		{"STATUS:CANCELLED", "SEQUENCE:4"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("событий %d, ожидается %d", len(events), len(expected))
+	}
+	for i, event := range events {
+		for _, line := range []string{expected[i].status, expected[i].sequence, "LAST-MODIFIED:20261018T093000Z"} {
+			if !strings.Contains(event, line+"\r\n") {
+				t.Errorf("в событии %d нет %s:\n%s", i+1, line, event)
+			}
+		}
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestRescheduleOrder - перенос записи меняет дату, увеличивает ревизию для календарей,
+// сбрасывает флаг уведомления о записи и уведомляет участников заказа.
+func TestRescheduleOrder(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectExec(`UPDATE orders SET date = \$1, appointmentnotified = FALSE, updated = now\(\), revision = revision \+ 1`).
+		WithArgs("11-03-2026", "7", StatusOpen, StatusСonfirmed).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT userid FROM orders`).WithArgs("7", RoleFleetManager).
+		WillReturnRows(sqlmock.NewRows([]string{"userid"}).AddRow("5"))
+	mock.ExpectQuery(`SELECT language FROM users`).WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"language"}).AddRow(LangEN))
+	mock.ExpectExec(`INSERT INTO notifications`).
+		WithArgs("5", sqlmock.AnyArg(), "Appointment for order #7 moved",
+			"The service appointment for order #7 has been moved to 03.11.2026.", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	recorder := httptest.NewRecorder()
+	rescheduleAdminOrderHandler(recorder, formRequest("/", url.Values{"orderID": {"7"}, "day": {"3"}, "month": {"11"}, "year": {"2026"}}))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestRescheduleOrderRejected - несуществующая дата не сохраняется, заказ, которого нет, дает 404,
+// а закрытый или отмененный заказ перенести нельзя.
+func TestRescheduleOrderRejected(t *testing.T) {
+	mock := useMockDB(t)
+
+	recorder := httptest.NewRecorder()
+	rescheduleAdminOrderHandler(recorder, formRequest("/", url.Values{"orderID": {"7"}, "day": {"31"}, "month": {"2"}, "year": {"2026"}}))
+	if recorder.Code != http.StatusBadRequest || fieldCodes(recorder)["day"] != CodeInvalidDate {
+		t.Errorf("31 февраля: код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	tests := []struct {
+		status int // 0, если заказа нет
+		code   int
+		error  string
+	}{
+		{0, http.StatusNotFound, CodeOrderNotFound},
+		{StatusClosed, http.StatusBadRequest, CodeOrderFinished},
+		{StatusCancelled, http.StatusBadRequest, CodeOrderFinished},
+	}
+	for _, test := range tests {
+		mock.ExpectExec(`UPDATE orders SET date`).WillReturnResult(sqlmock.NewResult(0, 0))
+		rows := sqlmock.NewRows([]string{"status"})
+		if test.status != 0 {
+			rows.AddRow(test.status)
+		}
+		mock.ExpectQuery(`SELECT status FROM orders`).WithArgs("7").WillReturnRows(rows)
+
+		recorder = httptest.NewRecorder()
+		rescheduleAdminOrderHandler(recorder, formRequest("/", url.Values{"orderID": {"7"}, "day": {"3"}, "month": {"11"}, "year": {"2026"}}))
+		if recorder.Code != test.code || errorCode(recorder) != test.error {
+			t.Errorf("ожидалось %d %s, получено %d %s", test.code, test.error, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestCancelOrder - отменить можно только незакрытый заказ, отмена увеличивает ревизию заказа.
+func TestCancelOrder(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery(`SELECT status FROM orders`).WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(StatusClosed))
+
+	recorder := httptest.NewRecorder()
+	cancelAdminOrderHandler(recorder, formRequest("/", url.Values{"orderID": {"7"}}))
+	if recorder.Code != http.StatusBadRequest || errorCode(recorder) != CodeInvalidTransition {
+		t.Errorf("закрытый заказ: код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	mock.ExpectQuery(`SELECT status FROM orders`).WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(StatusСonfirmed))
+	mock.ExpectExec(`UPDATE orders SET status = \$1, .*revision = revision \+ 1`).
+		WithArgs(StatusCancelled, sqlmock.AnyArg(), "7", StatusСonfirmed).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT userid FROM orders`).WillReturnRows(sqlmock.NewRows([]string{"userid"}))
+
+	recorder = httptest.NewRecorder()
+	cancelAdminOrderHandler(recorder, formRequest("/", url.Values{"orderID": {"7"}}))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
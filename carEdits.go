@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// updateCarHandler - изменяет данные машины пользователя и сохраняет историю изменений.
+func updateCarHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	car := getAndCheckCar(w, r)
+	if car == nil {
+		return
+	}
+	car.ID = r.FormValue("id")
+	if _, err := strconv.Atoi(car.ID); err != nil {
+		writeFieldError(w, "id", CodeInvalidCarID)
+		return
+	}
+
+	if !checkCarAccess(w, id, car.ID, true) {
+		return
+	}
+
+	old := Car{}
+	err := db.QueryRow(`SELECT brand, model, upper(vin), year, plate, platecountry, color, engine, transmission
+	FROM cars WHERE id = $1`, car.ID).
+		Scan(&old.Brand, &old.Model, &old.VIN, &old.Year, &old.Plate, &old.PlateCountry, &old.Color, &old.Engine, &old.Transmission)
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД машины пользователя: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	edits := diffCars(&old, car)
+	if len(edits) == 0 {
+		writeMessage(w, MsgCarUnchanged)
+		return
+	}
+
+	err = saveCarEdits(id, &old, car, edits)
+	if err != nil {
+		log.Printf("Ошибка. При изменении в БД машины(ид = %s): %s\n", car.ID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	log.Printf("Инфо. Пользователь (ид = %s) изменил машину(ид = %s)", id, car.ID)
+	writeMessage(w, MsgCarUpdated)
+}
+
+// getCarEditsHandler - отдает историю изменений машины пользователя.
+func getCarEditsHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	carID := r.FormValue("id")
+	if _, err := strconv.Atoi(carID); err != nil {
+		writeFieldError(w, "id", CodeInvalidCarID)
+		return
+	}
+
+	if !checkCarAccess(w, id, carID, false) {
+		return
+	}
+
+	rows, err := db.Query(`SELECT carid, date, field, oldvalue, newvalue FROM caredits WHERE carid = $1 ORDER BY date`, carID)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД истории изменений машины(ид =  %s): %s\n", carID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	defer rows.Close()
+
+	result := make([]*CarEdit, 0)
+
+	for rows.Next() {
+		edit := CarEdit{}
+		err = rows.Scan(&edit.CarID, &edit.Date, &edit.Field, &edit.OldValue, &edit.NewValue)
+		if err != nil {
+			log.Printf("Ошибка. При выборке из БД истории изменений машины(ид =  %s): %s\n", carID, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+		result = append(result, &edit)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// diffCars - возвращает список изменившихся полей машины.
+func diffCars(old *Car, car *Car) []*CarEdit {
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"brand", old.Brand, car.Brand},
+		{"model", old.Model, car.Model},
+		{"vin", old.VIN, car.VIN},
+		{"year", old.Year, car.Year},
+		{"plate", old.Plate, car.Plate},
+		{"platecountry", old.PlateCountry, car.PlateCountry},
+		{"color", old.Color, car.Color},
+		{"engine", old.Engine, car.Engine},
+		{"transmission", old.Transmission, car.Transmission},
+	}
+
+	edits := make([]*CarEdit, 0)
+	for _, field := range fields {
+		if field.old != field.new {
+			edits = append(edits, &CarEdit{CarID: car.ID, Field: field.name, OldValue: field.old, NewValue: field.new})
+		}
+	}
+
+	return edits
+}
+
+// saveCarEdits - в одной транзакции обновляет машину и записывает историю изменений.
+// При исправлении VIN показания одометра и заметки этой машины переносятся на новый VIN.
+func saveCarEdits(userID string, old *Car, car *Car, edits []*CarEdit) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE cars SET brand = $1, model = $2, vin = $3, year = $4, plate = $5, platecountry = $6, color = $7, engine = $8, transmission = $9
+	WHERE id = $10`, car.Brand, car.Model, car.VIN, car.Year, car.Plate, car.PlateCountry, car.Color, car.Engine, car.Transmission, car.ID)
+	if err == nil {
+		_, err = tx.Exec(`UPDATE orders SET `+orderRevised+` WHERE carid = $1`, car.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if old.VIN != car.VIN {
+		_, err = tx.Exec(`UPDATE odometer SET vin = $1 WHERE carid = $2`, car.VIN, car.ID)
+		if err == nil {
+			_, err = tx.Exec(`UPDATE carnotes SET vin = $1 WHERE carid = $2`, car.VIN, car.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	for _, edit := range edits {
+		_, err = tx.Exec(`INSERT INTO caredits(carid, userid, date, field, oldvalue, newvalue) VALUES($1, $2, $3, $4, $5, $6)`,
+			edit.CarID, userID, now, edit.Field, edit.OldValue, edit.NewValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestDiffCars - в историю попадают только изменившиеся поля со старым и новым значением.
+func TestDiffCars(t *testing.T) {
+	old := &Car{ID: "7", Brand: "Lada", Model: "Vesta", VIN: "XTA210990S1234567", Year: "2020", Plate: "A123BC77", PlateCountry: "RU"}
+	car := *old
+	car.Plate = "B456CE77"
+	car.Color = "white"
+
+	expected := []*CarEdit{
+		{CarID: "7", Field: "plate", OldValue: "A123BC77", NewValue: "B456CE77"},
+		{CarID: "7", Field: "color", OldValue: "", NewValue: "white"},
+	}
+	if edits := diffCars(old, &car); !reflect.DeepEqual(edits, expected) {
+		t.Errorf("diffCars = %+v, ожидалось %+v", edits, expected)
+	}
+
+	if edits := diffCars(old, old); len(edits) != 0 {
+		t.Errorf("изменения у неизмененной машины: %+v", edits)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// pdfFont - шрифт с кириллицей для выгрузки в pdf. Встроен в программу, чтобы выгрузка
+// не зависела от каталога, из которого запущен сервис.
+//
+//go:embed fonts/DejaVuSans.ttf
+var pdfFont []byte
+
+// carHistoryHandler - отдает историю обслуживания машины по VIN в формате json.
+func carHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	history := getCarHistory(w, id, r.FormValue("vin"))
+	if history == nil {
+		return
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+
+	log.Println("Инфо. Отдача истории обслуживания машины(VIN = " + history.VIN + ") пользователю(ид = " + id + ") успешно закончена")
+}
+
+// carHistoryPDFHandler - отдает историю обслуживания машины по VIN в виде pdf файла.
+func carHistoryPDFHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	history := getCarHistory(w, id, r.FormValue("vin"))
+	if history == nil {
+		return
+	}
+
+	data, err := generateCarHistoryPDF(history, responseLanguage(w))
+	if err != nil {
+		log.Println("Ошибка. При формировании pdf с историей обслуживания машины(VIN = " + history.VIN + "): " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/pdf")
+	w.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=%q", history.VIN+".pdf"))
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдаче pdf файла: " + err.Error())
+		return
+	}
+
+	log.Println("Инфо. Выгрузка истории обслуживания машины(VIN = " + history.VIN + ") в pdf успешно закончена")
+}
+
+// addAdminOrderItemHandler - добавляет позицию (работу или запчасть) к заказу. Доступно только сотрудникам сервиса.
+func addAdminOrderItemHandler(w http.ResponseWriter, r *http.Request) {
+	item := &OrderItem{
+		OrderID:    r.FormValue("orderID"),
+		Name:       r.FormValue("name"),
+		Quantity:   r.FormValue("quantity"),
+		Cost:       r.FormValue("cost"),
+		ScheduleID: r.FormValue("scheduleID"),
+	}
+
+	if item.Quantity == "" {
+		item.Quantity = "1"
+	}
+
+	resultOfValidation := ValidateOrderItem(item)
+	if len(resultOfValidation) != 0 {
+		log.Println("Инфо. Попытка добавить позицию заказа с невалидными данными: " + resultOfValidation.String())
+		writeValidationErrors(w, resultOfValidation)
+		return
+	}
+
+	err := db.QueryRow("SELECT id FROM orders WHERE id = $1", item.OrderID).Scan(&item.OrderID)
+	if err == sql.ErrNoRows {
+		log.Println("Инфо. Попытка добавить позицию к несуществующему заказу(ид = " + item.OrderID + ")")
+		writeError(w, http.StatusNotFound, CodeOrderNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске записи в БД о заказе: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	_, err = db.Exec("INSERT INTO orderitems(orderid, name, quantity, cost, scheduleid) VALUES($1, $2, $3, $4, $5)",
+		item.OrderID, item.Name, item.Quantity, item.Cost, sql.NullString{String: item.ScheduleID, Valid: item.ScheduleID != ""})
+	if err != nil {
+		log.Printf("Ошибка. При добавлении позиции к заказу(ид заказа =  %s ): %s\n", item.OrderID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+}
+
+// addAdminCarNoteHandler - добавляет заметку сервиса о машине с указанным VIN. Доступно только сотрудникам сервиса.
+// Заметка привязывается к последней добавленной машине с этим VIN, поэтому ее видит только текущий владелец.
+func addAdminCarNoteHandler(w http.ResponseWriter, r *http.Request) {
+	vin := strings.ToUpper(r.FormValue("vin"))
+	text := r.FormValue("text")
+
+	resultOfValidation := ValidationErrors{}
+	if len(vin) != 17 {
+		resultOfValidation.add("vin", CodeInvalidVIN)
+	}
+	if text == "" {
+		resultOfValidation.add("text", CodeNoteRequired)
+	}
+	if len(resultOfValidation) != 0 {
+		log.Println("Инфо. Попытка добавить заметку о машине с невалидными данными: " + resultOfValidation.String())
+		writeValidationErrors(w, resultOfValidation)
+		return
+	}
+
+	result, err := db.Exec(`INSERT INTO carnotes(vin, carid, date, text)
+	SELECT $1, id, $2, $3 FROM cars WHERE upper(vin) = $1 AND deleted = FALSE ORDER BY id DESC LIMIT 1`, vin, time.Now(), text)
+	if err == nil {
+		if count, _ := result.RowsAffected(); count == 0 {
+			log.Println("Инфо. Попытка добавить заметку о машине, которой нет в БД(VIN = " + vin + ")")
+			writeError(w, http.StatusNotFound, CodeNoteCarNotFound)
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("Ошибка. При добавлении заметки о машине(VIN = %s): %s\n", vin, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+}
+
+// getCarHistory - собирает из БД историю обслуживания машины с указанным VIN.
+// Учитываются все машины пользователя с этим VIN, в том числе удаленные,
+// поэтому история не теряется при удалении и повторном добавлении машины.
+// В случае ошибки сам отвечает клиенту и возвращает nil.
+func getCarHistory(w http.ResponseWriter, userID string, vin string) *CarHistory {
+	history := &CarHistory{
+		VIN:      strings.ToUpper(vin),
+		Orders:   make([]*ServiceRecord, 0),
+		Readings: make([]*OdometerReading, 0),
+		Notes:    make([]*CarNote, 0),
+	}
+
+	if len(history.VIN) != 17 {
+		log.Println("Инфо. Попытка получить историю обслуживания машины с некорректным VIN.")
+		writeFieldError(w, "vin", CodeInvalidVIN)
+		return nil
+	}
+
+	err := db.QueryRow(`SELECT brand, model, year FROM cars WHERE upper(vin) = $1 AND userid = $2 ORDER BY id DESC LIMIT 1`, history.VIN, userID).
+		Scan(&history.Brand, &history.Model, &history.Year)
+	if err == sql.ErrNoRows {
+		log.Println("Инфо. Попытка получить историю машины, которой нет у пользователя(ид = " + userID + "): " + err.Error())
+		writeError(w, http.StatusBadRequest, CodeVINCarNotFound)
+		return nil
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД машины по VIN: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return nil
+	}
+
+	if !fillServiceRecords(w, history, userID) || !fillOdometerReadings(w, history, userID) || !fillCarNotes(w, history, userID) {
+		return nil
+	}
+
+	return history
+}
+
+// fillServiceRecords - заполняет заказы и их позиции в истории обслуживания машины.
+func fillServiceRecords(w http.ResponseWriter, history *CarHistory, userID string) bool {
+	rows, err := db.Query(`SELECT o.id, o.status, o.date, COALESCE(o.cost::text, ''), o.carid, o.userid, o.info, COALESCE(o.mileage::text, '')
+	FROM orders o JOIN cars c ON c.id = o.carid
+	WHERE upper(c.vin) = $1 AND c.userid = $2 ORDER BY o.date`, history.VIN, userID)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД заказов по машине(VIN = %s): %s\n", history.VIN, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return false
+	}
+	defer rows.Close()
+
+	records := make(map[string]*ServiceRecord)
+	var date time.Time
+
+	for rows.Next() {
+		record := &ServiceRecord{Items: make([]*OrderItem, 0)}
+		err = rows.Scan(&record.ID, &record.Status, &date, &record.Cost, &record.CarID, &record.UserID, &record.Info, &record.Mileage)
+		if err != nil {
+			log.Printf("Ошибка. При выборке из БД заказов по машине(VIN = %s): %s\n", history.VIN, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return false
+		}
+
+		record.Month = strconv.Itoa(int(date.Month()))
+		record.Day = strconv.Itoa(date.Day())
+		record.Year = strconv.Itoa(date.Year())
+		record.CarInfo = history.Brand + " " + history.Model + "(" + history.Year + ")"
+
+		records[record.ID] = record
+		history.Orders = append(history.Orders, record)
+	}
+
+	itemRows, err := db.Query(`SELECT i.id, i.orderid, i.name, i.quantity, i.cost
+	FROM orderitems i JOIN orders o ON o.id = i.orderid JOIN cars c ON c.id = o.carid
+	WHERE upper(c.vin) = $1 AND c.userid = $2 ORDER BY i.id`, history.VIN, userID)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД позиций заказов по машине(VIN = %s): %s\n", history.VIN, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return false
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		item := OrderItem{}
+		err = itemRows.Scan(&item.ID, &item.OrderID, &item.Name, &item.Quantity, &item.Cost)
+		if err != nil {
+			log.Printf("Ошибка. При выборке из БД позиций заказов по машине(VIN = %s): %s\n", history.VIN, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return false
+		}
+
+		if record, ok := records[item.OrderID]; ok {
+			record.Items = append(record.Items, &item)
+		}
+	}
+
+	return true
+}
+
+// fillOdometerReadings - заполняет показания одометра в истории обслуживания машины.
+// Берутся только показания машин пользователя, а не все показания по VIN.
+func fillOdometerReadings(w http.ResponseWriter, history *CarHistory, userID string) bool {
+	rows, err := db.Query(`SELECT o.vin, o.date, o.mileage, COALESCE(o.orderid::text, '') FROM odometer o JOIN cars c ON c.id = o.carid
+	WHERE upper(c.vin) = $1 AND c.userid = $2 ORDER BY o.date`, history.VIN, userID)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД показаний одометра(VIN = %s): %s\n", history.VIN, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return false
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		reading := OdometerReading{}
+		err = rows.Scan(&reading.VIN, &reading.Date, &reading.Mileage, &reading.OrderID)
+		if err != nil {
+			log.Printf("Ошибка. При выборке из БД показаний одометра(VIN = %s): %s\n", history.VIN, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return false
+		}
+		history.Readings = append(history.Readings, &reading)
+	}
+
+	return true
+}
+
+// fillCarNotes - заполняет заметки сервиса в истории обслуживания машины.
+// Берутся только заметки о машинах пользователя, заметки о машине предыдущего владельца не видны.
+func fillCarNotes(w http.ResponseWriter, history *CarHistory, userID string) bool {
+	rows, err := db.Query(`SELECT n.vin, n.date, n.text FROM carnotes n JOIN cars c ON c.id = n.carid
+	WHERE upper(c.vin) = $1 AND c.userid = $2 ORDER BY n.date`, history.VIN, userID)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД заметок о машине(VIN = %s): %s\n", history.VIN, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return false
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		note := CarNote{}
+		err = rows.Scan(&note.VIN, &note.Date, &note.Text)
+		if err != nil {
+			log.Printf("Ошибка. При выборке из БД заметок о машине(VIN = %s): %s\n", history.VIN, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return false
+		}
+		history.Notes = append(history.Notes, &note)
+	}
+
+	return true
+}
+
+// generateCarHistoryPDF - формирует pdf документ с историей обслуживания машины на языке lang.
+func generateCarHistoryPDF(history *CarHistory, lang string) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes("DejaVu", "", pdfFont)
+	pdf.AddPage()
+
+	pdf.SetFont("DejaVu", "", 16)
+	pdf.MultiCell(0, 8, localize(lang, PDFTitle), "", "L", false)
+	pdf.SetFont("DejaVu", "", 11)
+	pdf.MultiCell(0, 6, fmt.Sprintf("%s %s (%s), VIN %s", history.Brand, history.Model, history.Year, history.VIN), "", "L", false)
+	pdf.Ln(4)
+
+	for _, record := range history.Orders {
+		pdf.SetFont("DejaVu", "", 12)
+		title := localize(lang, PDFOrder, record.ID, record.GetFormatDate())
+		if record.Mileage != "" {
+			title += localize(lang, PDFOrderMileage, record.Mileage)
+		}
+		pdf.MultiCell(0, 7, title, "", "L", false)
+
+		pdf.SetFont("DejaVu", "", 10)
+		pdf.MultiCell(0, 5, record.Info, "", "L", false)
+		for _, item := range record.Items {
+			pdf.MultiCell(0, 5, localize(lang, PDFOrderItem, item.Name, item.Quantity, item.Cost), "", "L", false)
+		}
+		pdf.Ln(2)
+	}
+
+	if len(history.Readings) != 0 {
+		pdf.SetFont("DejaVu", "", 12)
+		pdf.MultiCell(0, 7, localize(lang, PDFReadings), "", "L", false)
+		pdf.SetFont("DejaVu", "", 10)
+		for _, reading := range history.Readings {
+			pdf.MultiCell(0, 5, localize(lang, PDFReading, reading.Date.Format("02-01-2006"), reading.Mileage), "", "L", false)
+		}
+		pdf.Ln(2)
+	}
+
+	if len(history.Notes) != 0 {
+		pdf.SetFont("DejaVu", "", 12)
+		pdf.MultiCell(0, 7, localize(lang, PDFNotes), "", "L", false)
+		pdf.SetFont("DejaVu", "", 10)
+		for _, note := range history.Notes {
+			pdf.MultiCell(0, 5, note.Date.Format("02-01-2006")+": "+note.Text, "", "L", false)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := pdf.Output(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
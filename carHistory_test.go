@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// formRequest - POST запрос с полями формы.
+func formRequest(path string, form url.Values) *http.Request {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return request
+}
+
+// userRequest - POST запрос с полями формы от авторизованного пользователя с ид userID.
+func userRequest(userID string, form url.Values) *http.Request {
+	request := formRequest("/", form)
+	return request.WithContext(context.WithValue(request.Context(), userIDKey{}, userID))
+}
+
+// TestGenerateCarHistoryPDF - pdf с кириллицей собирается со встроенным шрифтом на каждом языке.
+func TestGenerateCarHistoryPDF(t *testing.T) {
+	history := &CarHistory{
+		VIN:   "XTA210990Y2766389",
+		Brand: "ВАЗ",
+		Model: "21099",
+		Year:  "2000",
+		Orders: []*ServiceRecord{{
+			Order: Order{ID: "1", Month: "3", Day: "7", Year: "2024", Info: "Замена масла", Mileage: "120000"},
+			Items: []*OrderItem{{Name: "Масло 5W-40", Quantity: "4", Cost: "2400"}},
+		}},
+		Readings: []*OdometerReading{{Date: time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC), Mileage: 120000}},
+		Notes:    []*CarNote{{Date: time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC), Text: "Течь сальника"}},
+	}
+
+	for _, lang := range supportedLanguages {
+		data, err := generateCarHistoryPDF(history, lang)
+		if err != nil {
+			t.Fatalf("generateCarHistoryPDF(%s): %v", lang, err)
+		}
+		if !bytes.HasPrefix(data, []byte("%PDF-")) {
+			t.Fatalf("%s: ожидался pdf документ, получено %q", lang, data[:min(len(data), 16)])
+		}
+		if !bytes.Contains(data, []byte("/FontFile2")) {
+			t.Fatalf("%s: в pdf не встроен шрифт", lang)
+		}
+	}
+}
+
+// TestAddOrderItemUnknownOrder - позиция к несуществующему заказу не вставляется, сотрудник получает 404.
+func TestAddOrderItemUnknownOrder(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery(`SELECT id FROM orders WHERE id = \$1`).WithArgs("42").WillReturnError(sql.ErrNoRows)
+
+	recorder := httptest.NewRecorder()
+	addAdminOrderItemHandler(recorder, formRequest("/addAdminOrderItem", url.Values{"orderID": {"42"}, "name": {"Масло"}, "cost": {"2400"}}))
+
+	if recorder.Code != http.StatusNotFound || errorCode(recorder) != CodeOrderNotFound {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestAddCarNoteValidation - некорректный VIN и пустой текст заметки возвращаются разными кодами полей.
+func TestAddCarNoteValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		form   url.Values
+		fields map[string]string
+	}{
+		{"короткий VIN", url.Values{"vin": {"XTA2109"}, "text": {"Течь"}}, map[string]string{"vin": CodeInvalidVIN}},
+		{"пустой текст", url.Values{"vin": {"XTA210990Y2766389"}}, map[string]string{"text": CodeNoteRequired}},
+		{"все поля", url.Values{}, map[string]string{"vin": CodeInvalidVIN, "text": CodeNoteRequired}},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		addAdminCarNoteHandler(recorder, formRequest("/addAdminCarNote", test.form))
+
+		fields := fieldCodes(recorder)
+		if recorder.Code != http.StatusBadRequest || len(fields) != len(test.fields) {
+			t.Errorf("%s: код %d, ответ %s", test.name, recorder.Code, recorder.Body.String())
+			continue
+		}
+		for field, code := range test.fields {
+			if fields[field] != code {
+				t.Errorf("%s: поле %s с кодом %q, ожидался %q", test.name, field, fields[field], code)
+			}
+		}
+	}
+}
+
+// TestAddCarNoteUnknownVIN - заметка о VIN, которого нет ни у одной машины, не сохраняется.
+func TestAddCarNoteUnknownVIN(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectExec(`INSERT INTO carnotes\(vin, carid, date, text\)`).
+		WithArgs("XTA210990Y2766389", sqlmock.AnyArg(), "Течь сальника").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	recorder := httptest.NewRecorder()
+	addAdminCarNoteHandler(recorder, formRequest("/addAdminCarNote", url.Values{"vin": {"xta210990y2766389"}, "text": {"Течь сальника"}}))
+
+	if recorder.Code != http.StatusNotFound || errorCode(recorder) != CodeNoteCarNotFound {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestCarHistoryScopedByOwner - показания одометра и заметки выбираются по машинам пользователя, а не по одному VIN.
+func TestCarHistoryScopedByOwner(t *testing.T) {
+	const vin = "XTA210990Y2766389"
+	mock := useMockDB(t)
+	mock.ExpectQuery(`SELECT brand, model, year FROM cars`).WithArgs(vin, "5").
+		WillReturnRows(sqlmock.NewRows([]string{"brand", "model", "year"}).AddRow("ВАЗ", "21099", "2000"))
+	mock.ExpectQuery(`FROM orders o JOIN cars c`).WithArgs(vin, "5").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "date", "cost", "carid", "userid", "info", "mileage"}))
+	mock.ExpectQuery(`FROM orderitems i`).WithArgs(vin, "5").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "orderid", "name", "quantity", "cost"}))
+	mock.ExpectQuery(`FROM odometer o JOIN cars c ON c.id = o.carid\s+WHERE upper\(c.vin\) = \$1 AND c.userid = \$2`).WithArgs(vin, "5").
+		WillReturnRows(sqlmock.NewRows([]string{"vin", "date", "mileage", "orderid"}).AddRow(vin, time.Now(), 120000, ""))
+	mock.ExpectQuery(`FROM carnotes n JOIN cars c ON c.id = n.carid\s+WHERE upper\(c.vin\) = \$1 AND c.userid = \$2`).WithArgs(vin, "5").
+		WillReturnRows(sqlmock.NewRows([]string{"vin", "date", "text"}))
+
+	history := getCarHistory(httptest.NewRecorder(), "5", strings.ToLower(vin))
+	if history == nil || len(history.Readings) != 1 || len(history.Notes) != 0 {
+		t.Fatalf("история: %+v", history)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
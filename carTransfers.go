@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// transferCarHandler - создает запрос на передачу личной машины другому пользователю.
+// Пока машина ожидает ответа на один запрос передачи, новый создать нельзя.
+func transferCarHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	carID := r.FormValue("carID")
+	if _, err := strconv.Atoi(carID); err != nil {
+		writeFieldError(w, "carID", CodeInvalidCarID)
+		return
+	}
+
+	login := strings.ToLower(r.FormValue("login"))
+
+	var orgID sql.NullString
+	err := db.QueryRow(`SELECT orgid FROM cars WHERE id = $1 AND userid = $2 AND deleted = FALSE`, carID, id).Scan(&orgID)
+	if err == sql.ErrNoRows || orgID.Valid {
+		log.Printf("Инфо. Пользователь (ид = %s) попытался передать машину(ид = %s), которой не владеет лично", id, carID)
+		writeError(w, http.StatusBadRequest, CodeTransferOwnOnly)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД машины пользователя: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	var toUserID string
+	err = db.QueryRow(`SELECT id FROM users WHERE login = $1`, login).Scan(&toUserID)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusBadRequest, CodeLoginNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД пользователя(логин - " + login + " ): " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	if toUserID == id {
+		writeFieldError(w, "login", CodeTransferToSelf)
+		return
+	}
+
+	result, err := db.Exec(`INSERT INTO cartransfers(carid, fromuserid, touserid, status, created) SELECT $1, $2, $3, $4, $5
+	WHERE NOT EXISTS (SELECT 1 FROM cartransfers WHERE carid = $1 AND status = $4)`,
+		carID, id, toUserID, TransferPending, time.Now())
+	if err != nil {
+		log.Printf("Ошибка. При создании передачи машины(ид = %s): %s\n", carID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		log.Printf("Инфо. Пользователь (ид = %s) попытался повторно передать машину(ид = %s)", id, carID)
+		writeError(w, http.StatusBadRequest, CodeTransferPending)
+		return
+	}
+
+	log.Printf("Инфо. Пользователь (ид = %s) начал передачу машины(ид = %s) пользователю(ид = %s)", id, carID, toUserID)
+	writeMessage(w, MsgTransferSent)
+}
+
+// getCarTransfersHandler - отдает входящие и исходящие запросы на передачу машин, ожидающие ответа.
+func getCarTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	rows, err := db.Query(`SELECT t.id, t.carid, c.brand || ' ' || c.model || '(' || c.year || ')', f.login, u.login, t.status, t.created
+	FROM cartransfers t JOIN cars c ON c.id = t.carid JOIN users f ON f.id = t.fromuserid JOIN users u ON u.id = t.touserid
+	WHERE (t.fromuserid = $1 OR t.touserid = $1) AND t.status = $2 ORDER BY t.created`, id, TransferPending)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД передач машин пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	defer rows.Close()
+
+	result := make([]*CarTransfer, 0)
+
+	for rows.Next() {
+		transfer := CarTransfer{}
+		err = rows.Scan(&transfer.ID, &transfer.CarID, &transfer.CarInfo, &transfer.FromLogin, &transfer.ToLogin, &transfer.Status, &transfer.Created)
+		if err != nil {
+			log.Printf("Ошибка. При выборке из БД передач машин пользователя(ид =  %s): %s\n", id, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+		result = append(result, &transfer)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// acceptCarTransferHandler - принимает передачу машины: машина вместе с историей обслуживания
+// переходит получателю, а прежний владелец сохраняет доступ на чтение к своим заказам.
+func acceptCarTransferHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	transferID := r.FormValue("id")
+	if _, err := strconv.Atoi(transferID); err != nil {
+		writeFieldError(w, "id", CodeInvalidTransferID)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Ошибка. При открытии транзакции: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	defer tx.Rollback()
+
+	var carID, fromUserID string
+	err = tx.QueryRow(`SELECT t.carid, t.fromuserid FROM cartransfers t JOIN cars c ON c.id = t.carid
+	WHERE t.id = $1 AND t.touserid = $2 AND t.status = $3 AND c.userid = t.fromuserid AND c.orgid IS NULL AND c.deleted = FALSE
+	FOR UPDATE`, transferID, id, TransferPending).Scan(&carID, &fromUserID)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusBadRequest, CodeTransferNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД передачи машины: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	_, err = tx.Exec(`UPDATE cars SET userid = $1 WHERE id = $2`, id, carID)
+	if err == nil {
+		_, err = tx.Exec(`UPDATE reminders SET userid = $1 WHERE carid = $2 AND sent = FALSE`, id, carID)
+	}
+	if err == nil {
+		_, err = tx.Exec(`UPDATE cartransfers SET status = $1, resolved = $2 WHERE id = $3`, TransferAccepted, time.Now(), transferID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Ошибка. При передаче машины(ид = %s): %s\n", carID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	log.Printf("Инфо. Машина (ид = %s) передана от пользователя(ид = %s) пользователю(ид = %s)", carID, fromUserID, id)
+	writeMessage(w, MsgTransferAccepted)
+}
+
+// declineCarTransferHandler - отклоняет передачу машины получателем или отменяет ее отправителем.
+func declineCarTransferHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	transferID := r.FormValue("id")
+	if _, err := strconv.Atoi(transferID); err != nil {
+		writeFieldError(w, "id", CodeInvalidTransferID)
+		return
+	}
+
+	result, err := db.Exec(`UPDATE cartransfers SET status = $1, resolved = $2
+	WHERE id = $3 AND (fromuserid = $4 OR touserid = $4) AND status = $5`, TransferDeclined, time.Now(), transferID, id, TransferPending)
+	if err != nil {
+		log.Println("Ошибка. При отклонении передачи машины: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		writeError(w, http.StatusBadRequest, CodeTransferNotFound)
+		return
+	}
+
+	writeMessage(w, MsgTransferDeclined)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// TestTransferCarPending - пока машина ожидает ответа на запрос передачи, новый запрос не создается.
+func TestTransferCarPending(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery(`SELECT orgid FROM cars`).WithArgs("7", "5").WillReturnRows(sqlmock.NewRows([]string{"orgid"}).AddRow(nil))
+	mock.ExpectQuery(`SELECT id FROM users`).WithArgs("buyer").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("6"))
+	mock.ExpectExec(`INSERT INTO cartransfers.*WHERE NOT EXISTS`).WithArgs("7", "5", "6", TransferPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	recorder := httptest.NewRecorder()
+	transferCarHandler(recorder, userRequest("5", url.Values{"carID": {"7"}, "login": {"Buyer"}}))
+	if recorder.Code != http.StatusBadRequest || errorCode(recorder) != CodeTransferPending {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestAcceptCarTransfer - машина и неотправленные напоминания переходят получателю, передача принимается.
+func TestAcceptCarTransfer(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM cartransfers t JOIN cars c`).WithArgs("4", "6", TransferPending).
+		WillReturnRows(sqlmock.NewRows([]string{"carid", "fromuserid"}).AddRow("7", "5"))
+	mock.ExpectExec(`UPDATE cars SET userid`).WithArgs("6", "7").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE reminders SET userid`).WithArgs("6", "7").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE cartransfers SET status`).WithArgs(TransferAccepted, sqlmock.AnyArg(), "4").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	recorder := httptest.NewRecorder()
+	acceptCarTransferHandler(recorder, userRequest("6", url.Values{"id": {"4"}}))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestAcceptCarTransferNotFound - чужую, уже решенную передачу или передачу машины, которую владелец
+// успел удалить или передать организации, принять нельзя.
+func TestAcceptCarTransferNotFound(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM cartransfers t JOIN cars c`).WithArgs("4", "6", TransferPending).
+		WillReturnRows(sqlmock.NewRows([]string{"carid", "fromuserid"}))
+	mock.ExpectRollback()
+
+	recorder := httptest.NewRecorder()
+	acceptCarTransferHandler(recorder, userRequest("6", url.Values{"id": {"4"}}))
+	if recorder.Code != http.StatusBadRequest || errorCode(recorder) != CodeTransferNotFound {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestDeclineCarTransfer - отклонить передачу может отправитель или получатель, пока она ожидает ответа.
+func TestDeclineCarTransfer(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectExec(`UPDATE cartransfers SET status`).WithArgs(TransferDeclined, sqlmock.AnyArg(), "4", "5", TransferPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE cartransfers SET status`).WithArgs(TransferDeclined, sqlmock.AnyArg(), "4", "8", TransferPending).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	recorder := httptest.NewRecorder()
+	declineCarTransferHandler(recorder, userRequest("5", url.Values{"id": {"4"}}))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	declineCarTransferHandler(recorder, userRequest("8", url.Values{"id": {"4"}}))
+	if recorder.Code != http.StatusBadRequest || errorCode(recorder) != CodeTransferNotFound {
+		t.Errorf("посторонний пользователь: код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestCarTransferHandlersValidateIDs - нечисловые ид машины и передачи отклоняются до запросов к БД.
+func TestCarTransferHandlersValidateIDs(t *testing.T) {
+	useMockDB(t)
+
+	tests := []struct {
+		handler http.HandlerFunc
+		form    url.Values
+		field   string
+		code    string
+	}{
+		{transferCarHandler, url.Values{"carID": {"abc"}, "login": {"buyer"}}, "carID", CodeInvalidCarID},
+		{acceptCarTransferHandler, url.Values{"id": {"abc"}}, "id", CodeInvalidTransferID},
+		{declineCarTransferHandler, url.Values{}, "id", CodeInvalidTransferID},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		test.handler(recorder, userRequest("5", test.form))
+		if recorder.Code != http.StatusBadRequest || fieldCodes(recorder)[test.field] != test.code {
+			t.Errorf("%v: код %d, ответ %s", test.form, recorder.Code, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Коды ошибок, которые получает клиент. Коды стабильны, по ним клиент может
+// подсвечивать поля и показывать свои тексты, поэтому менять их нельзя.
+const (
+	CodeInternal          = "internal_error"
+	CodeValidation        = "validation_failed"
+	CodeNotFound          = "not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeInvalidBody       = "invalid_body"
+	CodeBodyTooLarge      = "body_too_large"
+	CodeUnauthorized      = "unauthorized"
+	CodeTokenExpired      = "token_expired"
+	CodeForbidden         = "forbidden"
+	CodeClientCert        = "client_certificate_required"
+	CodeOrgForbidden      = "org_forbidden"
+	CodeUserExists        = "user_exists"
+	CodeLoginNotFound     = "login_not_found"
+	CodeUserNotFound      = "user_not_found"
+	CodeWrongPassword     = "wrong_password"
+	CodeNoProfileImage    = "no_profile_image"
+	CodeLoginRequired     = "login_required"
+	CodeLoginTooShort     = "login_too_short"
+	CodePasswordTooShort  = "password_too_short"
+	CodeNameRequired      = "name_required"
+	CodeLastNameRequired  = "lastname_required"
+	CodeInvalidLanguage   = "invalid_language"
+	CodeInvalidOrderID    = "invalid_order_id"
+	CodeInvalidMessageID  = "invalid_message_id"
+	CodeEmptyMessage      = "empty_message"
+	CodeInvalidDate       = "invalid_date"
+	CodeCarRequired       = "car_required"
+	CodeInfoRequired      = "info_required"
+	CodeInvalidMileage    = "invalid_mileage"
+	CodeMileageDecreased  = "mileage_decreased"
+	CodeOrderNotFound     = "order_not_found"
+	CodeOrderUnavailable  = "order_unavailable"
+	CodeOrderClosed       = "order_closed"
+	CodeOrderFinished     = "order_finished"
+	CodeOrderReadOnly     = "order_read_only"
+	CodeItemNameRequired  = "item_name_required"
+	CodeItemNameTooLong   = "item_name_too_long"
+	CodeInvalidQuantity   = "invalid_quantity"
+	CodeInvalidCost       = "invalid_cost"
+	CodeInvalidScheduleID = "invalid_schedule_id"
+	CodeBrandRequired     = "brand_required"
+	CodeBrandTooLong      = "brand_too_long"
+	CodeModelRequired     = "model_required"
+	CodeModelTooLong      = "model_too_long"
+	CodeInvalidVIN        = "invalid_vin"
+	CodeVINChars          = "vin_chars"
+	CodeVINChecksum       = "vin_checksum"
+	CodeVINBrandMismatch  = "vin_brand_mismatch"
+	CodeVINYearMismatch   = "vin_year_mismatch"
+	CodeInvalidYear       = "invalid_year"
+	CodePlateCountry      = "unknown_plate_country"
+	CodePlateFormat       = "plate_format"
+	CodeColorTooLong      = "color_too_long"
+	CodeEngineTooLong     = "engine_too_long"
+	CodeTransmission      = "unknown_transmission"
+	CodeInvalidCarID      = "invalid_car_id"
+	CodeCarNotFound       = "car_not_found"
+	CodeVINCarNotFound    = "vin_car_not_found"
+	CodeNoteRequired      = "note_required"
+	CodeNoteCarNotFound   = "note_car_not_found"
+	CodeAttachmentsRead   = "attachments_unreadable"
+	CodeTooManyFiles      = "too_many_attachments"
+	CodeAttachmentSize    = "attachment_too_large"
+	CodeAttachmentType    = "attachment_type"
+	CodeAttachmentMissing = "attachment_not_found"
+	CodeNoThumbnail       = "no_thumbnail"
+	CodeInvalidTemplateID = "invalid_template_id"
+	CodeTemplateNotFound  = "template_not_found"
+	CodeTemplateName      = "template_name_invalid"
+	CodeTemplateText      = "template_text_required"
+	CodePlaceholder       = "unknown_placeholder"
+	CodeInvalidStatus     = "invalid_status"
+	CodeInvalidTransition = "invalid_status_transition"
+	CodeInvalidAssignee   = "invalid_assignee"
+	CodeAssigneeNotStaff  = "assignee_not_staff"
+	CodeOrgName           = "org_name_invalid"
+	CodeOrgRole           = "unknown_org_role"
+	CodeInvalidOrgID      = "invalid_org_id"
+	CodeInvalidUserID     = "invalid_user_id"
+	CodeRemoveSelf        = "cannot_remove_self"
+	CodeTransferNotFound  = "transfer_not_found"
+	CodeTransferOwnOnly   = "transfer_own_only"
+	CodeTransferToSelf    = "transfer_to_self"
+	CodeTransferPending   = "transfer_pending"
+	CodeInvalidTransferID = "invalid_transfer_id"
+	CodeUnknownChannel    = "unknown_channel"
+	CodeChannelDisabled   = "channel_unavailable"
+	CodeAddressTooLong    = "address_too_long"
+	CodeInvalidEmail      = "invalid_email"
+	CodeInvalidWebhook    = "invalid_webhook_url"
+	CodeTelegramViaBot    = "telegram_via_bot"
+	CodeTelegramDisabled  = "telegram_unavailable"
+	CodeCalendarNotFound  = "calendar_not_found"
+)
+
+// requestIDHeader - заголовок с идентификатором запроса, по которому ошибку клиента можно найти в логах.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDRegexp - допустимый формат идентификатора запроса, переданного клиентом или прокси.
+var requestIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9\-_.]{1,64}$`)
+
+//APIError - структура, описывающая ошибку в ответе клиенту.
+type APIError struct {
+	Code      string
+	Message   string
+	Fields    ValidationErrors `json:",omitempty"`
+	RequestID string
+}
+
+//FieldError - структура, описывающая ошибку валидации одного поля запроса.
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+	args    []interface{} // подстановки в текст ошибки
+}
+
+//ValidationErrors - все ошибки валидации запроса.
+type ValidationErrors []*FieldError
+
+// add - добавляет ошибку валидации поля.
+func (errs *ValidationErrors) add(field string, code string, args ...interface{}) {
+	*errs = append(*errs, &FieldError{Field: field, Code: code, args: args})
+}
+
+// String - тексты всех ошибок валидации одной строкой на языке по умолчанию, для логов.
+func (errs ValidationErrors) String() string {
+	return errs.text(defaultLanguage)
+}
+
+// text - тексты всех ошибок валидации одной строкой на языке lang, для ответов вне http.
+func (errs ValidationErrors) text(lang string) string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, localize(lang, err.Code, err.args...))
+	}
+
+	return strings.Join(messages, " ")
+}
+
+// writeError - отвечает клиенту json ошибкой с кодом и текстом по коду на языке ответа.
+func writeError(w http.ResponseWriter, status int, code string, args ...interface{}) {
+	writeAPIError(w, status, &APIError{Code: code, Message: localize(responseLanguage(w), code, args...)})
+}
+
+// writeValidationErrors - отвечает клиенту json ошибкой со всеми ошибками валидации полей.
+func writeValidationErrors(w http.ResponseWriter, errs ValidationErrors) {
+	lang := responseLanguage(w)
+	for _, err := range errs {
+		err.Message = localize(lang, err.Code, err.args...)
+	}
+
+	writeAPIError(w, http.StatusBadRequest, &APIError{Code: CodeValidation, Message: localize(lang, CodeValidation), Fields: errs})
+}
+
+// writeFieldError - отвечает клиенту json ошибкой валидации одного поля.
+func writeFieldError(w http.ResponseWriter, field string, code string, args ...interface{}) {
+	errs := ValidationErrors{}
+	errs.add(field, code, args...)
+	writeValidationErrors(w, errs)
+}
+
+// writeAPIError - отвечает клиенту ошибкой в конверте {"Error": ...}.
+func writeAPIError(w http.ResponseWriter, status int, apiError *APIError) {
+	apiError.RequestID = w.Header().Get(requestIDHeader)
+
+	data, err := json.Marshal(struct{ Error *APIError }{apiError})
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json ошибки: " + err.Error())
+		http.Error(w, apiError.Message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// withRequestID - присваивает каждому запросу идентификатор и отдает его в заголовке ответа.
+// Если идентификатор пришел в запросе (например, от прокси), то используется он.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !requestIDRegexp.MatchString(requestID) {
+			requestID = generateToken()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestValidationErrorsEnvelope - ответ валидации перечисляет все неверные поля сразу,
+// сообщения переведены на язык ответа, а ид запроса возвращается клиенту.
+func TestValidationErrorsEnvelope(t *testing.T) {
+	request := formRequest("/registration", url.Values{"login": {"abc"}, "password": {"123"}, "language": {"de"}})
+	request.Header.Set("Accept-Language", "en")
+	request.Header.Set(requestIDHeader, "req-41")
+	recorder := httptest.NewRecorder()
+
+	withRequestID(withLanguage(http.HandlerFunc(registrationHandler))).ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	var response struct{ Error *APIError }
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil || response.Error == nil {
+		t.Fatalf("ответ не в конверте ошибки: %s", recorder.Body.String())
+	}
+	if response.Error.Code != CodeValidation || response.Error.Message != localize(LangEN, CodeValidation) {
+		t.Errorf("ошибка %s: %s", response.Error.Code, response.Error.Message)
+	}
+	if response.Error.RequestID != "req-41" {
+		t.Errorf("ид запроса %q", response.Error.RequestID)
+	}
+
+	expected := map[string]string{
+		"login":    localize(LangEN, CodeLoginTooShort, 6),
+		"password": localize(LangEN, CodePasswordTooShort, 6),
+		"name":     localize(LangEN, CodeNameRequired),
+		"lastName": localize(LangEN, CodeLastNameRequired),
+		"language": localize(LangEN, CodeInvalidLanguage, "ru, en, kk"),
+	}
+	if len(response.Error.Fields) != len(expected) {
+		t.Errorf("полей с ошибками %d, ожидалось %d: %s", len(response.Error.Fields), len(expected), recorder.Body.String())
+	}
+	for _, field := range response.Error.Fields {
+		if message, ok := expected[field.Field]; !ok || field.Message != message {
+			t.Errorf("поле %s: %s %q", field.Field, field.Code, field.Message)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"sync"
+	"time"
 )
 
 // logFileName - имя файла для логов, задается через флаг командной строки
@@ -29,4 +30,80 @@ const (
 	StatusOpen       int    = 1                  // Открыт
 	StatusСonfirmed  int    = 2                  // Подтвержден
 	StatusClosed     int    = 3                  // Закрыт
+	StatusCancelled  int    = 4                  // Отменен
+	RoleFleetManager int    = 1                  // Менеджер автопарка организации
+	RoleDriver       int    = 2                  // Водитель организации
+	TransferPending  int    = 1                  // Передача машины ожидает ответа получателя
+	TransferAccepted int    = 2                  // Передача машины принята
+	TransferDeclined int    = 3                  // Передача машины отклонена или отменена
+)
+
+const (
+	remindersInterval = time.Hour // период проверки машин на необходимость обслуживания
+	reminderLeadKm    = 500       // за сколько километров до срока напоминать об обслуживании
+	reminderLeadDays  = 14        // за сколько дней до срока напоминать об обслуживании
+)
+
+const (
+	EventMessage string = "message" // Новое сообщение в заказе
+	EventStatus  string = "status"  // Изменение статуса заказа
+	EventRead    string = "read"    // Сообщения заказа прочитаны
+)
+
+const (
+	formAttachmentName       string = "attachment" // имя поля с вложениями в форме сообщения
+	maxAttachmentSize        int64  = 10 << 20     // максимальный размер одного вложения
+	maxAttachmentsPerMessage int    = 5            // максимальное количество вложений в сообщении
+	thumbnailSize            int    = 200          // размер миниатюры изображения по большей стороне
+	inboxPageSize            int    = 50           // количество переписок на странице входящих сотрудника
+)
+
+// maxRequestBodySize - максимальный размер тела запроса: все вложения сообщения и 1 МБ на поля формы.
+const maxRequestBodySize = int64(maxAttachmentsPerMessage)*maxAttachmentSize + 1<<20
+
+// maxThumbnailPixels - максимальное количество точек изображения, для которого строится миниатюра.
+// Размеры читаются из заголовка до декодирования, чтобы маленький файл не занял гигабайты памяти.
+const maxThumbnailPixels = 40_000_000
+
+const (
+	ChannelEmail    string = "email"    // Уведомления по электронной почте
+	ChannelSMS      string = "sms"      // Уведомления по sms
+	ChannelWebhook  string = "webhook"  // Уведомления http запросом на адрес пользователя
+	ChannelTelegram string = "telegram" // Уведомления в чат с telegram ботом
+)
+
+const (
+	notificationsInterval   = 30 * time.Second // период отправки уведомлений из очереди
+	notificationsBatchSize  = 20               // сколько уведомлений отправлять за один проход
+	notificationMaxAttempts = 8                // после стольких неудачных попыток уведомление больше не отправляется
+	notificationRetryDelay  = time.Minute      // задержка перед повторной отправкой, удваивается с каждой попыткой
+	notificationLease       = 5 * time.Minute  // на сколько уведомление резервируется за отправляющим экземпляром сервиса
+	notifierTimeout         = 10 * time.Second // таймаут запросов к sms шлюзу и вебхукам
+	appointmentLeadDays     = 1                // за сколько дней до записи напоминать о ней
+)
+
+const (
+	telegramDefaultAPIURL = "https://api.telegram.org" // адрес Bot API, если в конфигурации не указан другой
+	telegramPollTimeout   = 30                         // время ожидания новых сообщений боту в секундах
+	telegramLinkTTL       = time.Hour                  // время жизни кода привязки аккаунта к telegram
+)
+
+const (
+	defaultReadTimeout       = 60 * time.Second  // время на чтение запроса вместе с телом, вложения бывают большими
+	defaultReadHeaderTimeout = 10 * time.Second  // время на чтение заголовков запроса
+	defaultWriteTimeout      = 60 * time.Second  // время на ответ, потоки событий снимают его для себя
+	defaultIdleTimeout       = 120 * time.Second // сколько держать открытым простаивающее keep-alive соединение
+	defaultShutdownTimeout   = 30 * time.Second  // сколько ждать завершения запросов и фоновых задач при остановке
+	defaultMaxHeaderBytes    = 64 << 10          // максимальный размер заголовков запроса
+)
+
+const (
+	apiPrefix       string = "/api/v1" // префикс маршрутов текущей версии API
+	maxJSONBodySize int64  = 1 << 20   // максимальный размер json тела запроса
+)
+
+const (
+	calendarPastMonths = 6                  // за сколько месяцев назад отдавать записи в календарь
+	calendarLineLimit  = 75                 // максимальная длина строки ics файла в байтах
+	calendarTimeFormat = "20060102T150405Z" // формат времени в UTC в ics файле
 )
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// graphqlPath - путь, по которому принимаются запросы GraphQL.
+const graphqlPath = "/graphql"
+
+// graphqlSchemaText - схема GraphQL для личного кабинета клиента. Все данные видны от имени
+// авторизованного пользователя, так же как в http API.
+const graphqlSchemaText = `
+schema {
+	query: Query
+}
+
+type Query {
+	me: User!
+}
+
+type User {
+	id: ID!
+	name: String!
+	lastName: String!
+	phone: String!
+	profileImage: Boolean!
+	language: String!
+	cars: [Car!]!
+	orders(closed: Boolean = false): [Order!]!
+}
+
+type Car {
+	id: ID!
+	brand: String!
+	model: String!
+	vin: String!
+	year: String!
+	mileage: String!
+	plate: String!
+	plateCountry: String!
+	color: String!
+	engine: String!
+	transmission: String!
+	orgID: String!
+	orders(closed: Boolean = false): [Order!]!
+}
+
+type Order {
+	id: ID!
+	status: Int!
+	carID: ID!
+	carInfo: String!
+	date: String!
+	cost: String!
+	info: String!
+	mileage: String!
+	unreadCount: Int!
+	messages: [Message!]!
+}
+
+type Message {
+	id: ID!
+	isAdmin: Boolean!
+	date: String!
+	text: String!
+	readByCustomer: Boolean!
+	readByStaff: Boolean!
+	attachments: [Attachment!]!
+}
+
+type Attachment {
+	id: ID!
+	fileName: String!
+	contentType: String!
+	size: Int!
+	hasThumbnail: Boolean!
+}
+`
+
+// graphqlSchema - разобранная схема с резолверами. Несоответствие схемы и резолверов
+// обнаруживается при запуске сервера.
+var graphqlSchema = graphql.MustParseSchema(graphqlSchemaText, &graphqlResolver{})
+
+// graphqlContextKey - ключ, по которому в контексте запроса GraphQL лежат его загрузчики.
+type graphqlContextKey struct{}
+
+// batchLoader - загрузчик данных для одного запроса GraphQL. Ключи, о которых известно заранее
+// (например, ид всех заказов из уже выбранного списка), копятся в очереди, и первое же обращение
+// загружает их все одним запросом к БД вместо запроса на каждый ключ. Загруженное запоминается до конца запроса.
+type batchLoader struct {
+	mu      sync.Mutex
+	fetch   func(keys []string) (map[string]interface{}, error)
+	pending []string
+	results map[string]interface{}
+	errors  map[string]error
+}
+
+// newBatchLoader - конструктор для загрузчика, который получает данные функцией fetch.
+func newBatchLoader(fetch func(keys []string) (map[string]interface{}, error)) *batchLoader {
+	return &batchLoader{
+		fetch:   fetch,
+		results: make(map[string]interface{}),
+		errors:  make(map[string]error),
+	}
+}
+
+// prime - ставит ключи в очередь на загрузку.
+func (loader *batchLoader) prime(keys ...string) {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+
+	loader.pending = append(loader.pending, keys...)
+}
+
+// load - возвращает данные по ключу, при необходимости загружая его вместе со всей очередью.
+func (loader *batchLoader) load(key string) (interface{}, error) {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+
+	if err, ok := loader.errors[key]; ok {
+		return nil, err
+	}
+	if result, ok := loader.results[key]; ok {
+		return result, nil
+	}
+
+	keys := make([]string, 0, len(loader.pending)+1)
+	keys = append(keys, key)
+	for _, pending := range loader.pending {
+		if _, ok := loader.results[pending]; !ok && pending != key {
+			keys = append(keys, pending)
+		}
+	}
+	loader.pending = nil
+
+	results, err := loader.fetch(keys)
+	for _, k := range keys {
+		if err != nil {
+			loader.errors[k] = err
+			continue
+		}
+		loader.results[k] = results[k]
+	}
+
+	return results[key], err
+}
+
+// graphqlLoaders - загрузчики и пользователь одного запроса GraphQL.
+type graphqlLoaders struct {
+	userID   string
+	lang     string
+	orders   *batchLoader // заказы пользователя по признаку закрытости: "true" или "false"
+	messages *batchLoader // сообщения по ид заказа
+}
+
+// newGraphqlLoaders - конструктор для загрузчиков запроса пользователя userID.
+func newGraphqlLoaders(userID string, lang string) *graphqlLoaders {
+	return &graphqlLoaders{
+		userID: userID,
+		lang:   lang,
+		orders: newBatchLoader(func(keys []string) (map[string]interface{}, error) {
+			result := make(map[string]interface{})
+			for _, key := range keys {
+				orders, err := getUserOrders(userID, key == "true")
+				if err != nil {
+					return nil, err
+				}
+				result[key] = orders
+			}
+			return result, nil
+		}),
+		messages: newBatchLoader(func(keys []string) (map[string]interface{}, error) {
+			messages, err := loadOrdersMessages(keys)
+			if err != nil {
+				return nil, err
+			}
+
+			result := make(map[string]interface{})
+			for orderID, list := range messages {
+				result[orderID] = list
+			}
+			return result, nil
+		}),
+	}
+}
+
+// graphqlLoadersFrom - загрузчики из контекста запроса.
+func graphqlLoadersFrom(ctx context.Context) *graphqlLoaders {
+	return ctx.Value(graphqlContextKey{}).(*graphqlLoaders)
+}
+
+// graphqlError - ошибка в ответе GraphQL: текст на языке пользователя и код в extensions.
+type graphqlError struct {
+	code    string
+	message string
+}
+
+// Error - текст ошибки.
+func (err *graphqlError) Error() string {
+	return err.message
+}
+
+// Extensions - дополнительные поля ошибки в ответе, как code в ответах http API.
+func (err *graphqlError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": err.code}
+}
+
+// internalError - ошибка CodeInternal для ответа, подробности пишутся в лог.
+func (loaders *graphqlLoaders) internalError(about string, err error) error {
+	log.Printf("Ошибка. GraphQL, %s(ид пользователя = %s): %s\n", about, loaders.userID, err.Error())
+	return &graphqlError{code: CodeInternal, message: localize(loaders.lang, CodeInternal)}
+}
+
+// loadOrders - заказы пользователя, закрытые или незакрытые. Сообщения всех этих заказов
+// ставятся в очередь загрузчика, чтобы затем выбрать их одним запросом.
+func (loaders *graphqlLoaders) loadOrders(closed bool) ([]*Order, error) {
+	key := "false"
+	if closed {
+		key = "true"
+	}
+
+	result, err := loaders.orders.load(key)
+	if err != nil {
+		return nil, loaders.internalError("при выборке заказов", err)
+	}
+
+	orders := result.([]*Order)
+	for _, order := range orders {
+		loaders.messages.prime(order.ID)
+	}
+
+	return orders, nil
+}
+
+// graphqlHandler - выполняет запрос GraphQL от имени авторизованного пользователя.
+// Принимает json {"query", "operationName", "variables"} методом POST или параметры query, operationName
+// и variables методом GET. Маршрутизатор API для этого пути не используется: он разворачивает
+// json тело в значения формы, а variables - вложенный объект.
+func graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method, r.URL.Path)
+		return
+	}
+
+	id := currentUserID(r)
+
+	var params struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodySize)
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidBody, err.Error())
+			return
+		}
+	} else {
+		params.Query = r.FormValue("query")
+		params.OperationName = r.FormValue("operationName")
+		if variables := r.FormValue("variables"); variables != "" {
+			err := json.Unmarshal([]byte(variables), &params.Variables)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, CodeInvalidBody, err.Error())
+				return
+			}
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), graphqlContextKey{}, newGraphqlLoaders(id, responseLanguage(w)))
+	response := graphqlSchema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи результата GraphQL: " + err.Error())
+	}
+}
+
+// graphqlResolver - корневой резолвер запросов.
+type graphqlResolver struct{}
+
+// Me - авторизованный пользователь.
+func (*graphqlResolver) Me(ctx context.Context) (*graphqlUser, error) {
+	loaders := graphqlLoadersFrom(ctx)
+
+	user, err := getUserProfile(loaders.userID)
+	if err == sql.ErrNoRows {
+		return nil, &graphqlError{code: CodeUserNotFound, message: localize(loaders.lang, CodeUserNotFound)}
+	}
+	if err != nil {
+		return nil, loaders.internalError("при поиске информации о пользователе", err)
+	}
+
+	return &graphqlUser{id: loaders.userID, user: user}, nil
+}
+
+// graphqlOrdersArgs - аргументы полей со списком заказов.
+type graphqlOrdersArgs struct {
+	Closed bool
+}
+
+// graphqlUser - резолвер пользователя.
+type graphqlUser struct {
+	id   string
+	user *User
+}
+
+func (u *graphqlUser) ID() graphql.ID     { return graphql.ID(u.id) }
+func (u *graphqlUser) Name() string       { return u.user.Name }
+func (u *graphqlUser) LastName() string   { return u.user.LastName }
+func (u *graphqlUser) Phone() string      { return u.user.Phone }
+func (u *graphqlUser) ProfileImage() bool { return u.user.ProfileImage }
+func (u *graphqlUser) Language() string   { return u.user.Language }
+
+// Cars - машины пользователя.
+func (u *graphqlUser) Cars(ctx context.Context) ([]*graphqlCar, error) {
+	loaders := graphqlLoadersFrom(ctx)
+
+	cars, err := getUserCars(u.id)
+	if err != nil {
+		return nil, loaders.internalError("при выборке машин", err)
+	}
+
+	result := make([]*graphqlCar, 0, len(cars))
+	for _, car := range cars {
+		result = append(result, &graphqlCar{car})
+	}
+
+	return result, nil
+}
+
+// Orders - заказы, которые видит пользователь.
+func (u *graphqlUser) Orders(ctx context.Context, args graphqlOrdersArgs) ([]*graphqlOrder, error) {
+	orders, err := graphqlLoadersFrom(ctx).loadOrders(args.Closed)
+	if err != nil {
+		return nil, err
+	}
+
+	return newGraphqlOrders(orders, ""), nil
+}
+
+// graphqlCar - резолвер машины.
+type graphqlCar struct {
+	car *Car
+}
+
+func (c *graphqlCar) ID() graphql.ID       { return graphql.ID(c.car.ID) }
+func (c *graphqlCar) Brand() string        { return c.car.Brand }
+func (c *graphqlCar) Model() string        { return c.car.Model }
+func (c *graphqlCar) VIN() string          { return c.car.VIN }
+func (c *graphqlCar) Year() string         { return c.car.Year }
+func (c *graphqlCar) Mileage() string      { return c.car.Mileage }
+func (c *graphqlCar) Plate() string        { return c.car.Plate }
+func (c *graphqlCar) PlateCountry() string { return c.car.PlateCountry }
+func (c *graphqlCar) Color() string        { return c.car.Color }
+func (c *graphqlCar) Engine() string       { return c.car.Engine }
+func (c *graphqlCar) Transmission() string { return c.car.Transmission }
+func (c *graphqlCar) OrgID() string        { return c.car.OrgID }
+
+// Orders - заказы машины. Заказы всех машин берутся из одного списка заказов пользователя.
+func (c *graphqlCar) Orders(ctx context.Context, args graphqlOrdersArgs) ([]*graphqlOrder, error) {
+	orders, err := graphqlLoadersFrom(ctx).loadOrders(args.Closed)
+	if err != nil {
+		return nil, err
+	}
+
+	return newGraphqlOrders(orders, c.car.ID), nil
+}
+
+// newGraphqlOrders - резолверы заказов, если carID не пустой, то только заказов этой машины.
+func newGraphqlOrders(orders []*Order, carID string) []*graphqlOrder {
+	result := make([]*graphqlOrder, 0, len(orders))
+	for _, order := range orders {
+		if carID == "" || order.CarID == carID {
+			result = append(result, &graphqlOrder{order})
+		}
+	}
+
+	return result
+}
+
+// graphqlOrder - резолвер заказа.
+type graphqlOrder struct {
+	order *Order
+}
+
+func (o *graphqlOrder) ID() graphql.ID     { return graphql.ID(o.order.ID) }
+func (o *graphqlOrder) Status() int32      { return int32(o.order.Status) }
+func (o *graphqlOrder) CarID() graphql.ID  { return graphql.ID(o.order.CarID) }
+func (o *graphqlOrder) CarInfo() string    { return o.order.CarInfo }
+func (o *graphqlOrder) Date() string       { return o.order.GetFormatDate() }
+func (o *graphqlOrder) Cost() string       { return o.order.Cost }
+func (o *graphqlOrder) Info() string       { return o.order.Info }
+func (o *graphqlOrder) Mileage() string    { return o.order.Mileage }
+func (o *graphqlOrder) UnreadCount() int32 { return int32(o.order.UnreadCount) }
+
+// Messages - переписка по заказу. Сообщения всех выбранных заказов загружаются одним запросом.
+func (o *graphqlOrder) Messages(ctx context.Context) ([]*graphqlMessage, error) {
+	loaders := graphqlLoadersFrom(ctx)
+
+	messages, err := loaders.messages.load(o.order.ID)
+	if err != nil {
+		return nil, loaders.internalError("при выборке сообщений заказа(ид = "+o.order.ID+")", err)
+	}
+
+	list := messages.([]*Message)
+	result := make([]*graphqlMessage, 0, len(list))
+	for _, message := range list {
+		result = append(result, &graphqlMessage{message})
+	}
+
+	return result, nil
+}
+
+// graphqlMessage - резолвер сообщения.
+type graphqlMessage struct {
+	message *Message
+}
+
+func (m *graphqlMessage) ID() graphql.ID       { return graphql.ID(m.message.ID) }
+func (m *graphqlMessage) IsAdmin() bool        { return m.message.IsAdmin }
+func (m *graphqlMessage) Date() string         { return m.message.Date.Format(time.RFC3339) }
+func (m *graphqlMessage) Text() string         { return m.message.Text }
+func (m *graphqlMessage) ReadByCustomer() bool { return m.message.ReadByCustomer }
+func (m *graphqlMessage) ReadByStaff() bool    { return m.message.ReadByStaff }
+
+// Attachments - вложения сообщения, загружены вместе с сообщениями.
+func (m *graphqlMessage) Attachments() []*graphqlAttachment {
+	result := make([]*graphqlAttachment, 0, len(m.message.Attachments))
+	for _, attachment := range m.message.Attachments {
+		result = append(result, &graphqlAttachment{attachment})
+	}
+
+	return result
+}
+
+// graphqlAttachment - резолвер вложения.
+type graphqlAttachment struct {
+	attachment *Attachment
+}
+
+func (a *graphqlAttachment) ID() graphql.ID      { return graphql.ID(a.attachment.ID) }
+func (a *graphqlAttachment) FileName() string    { return a.attachment.FileName }
+func (a *graphqlAttachment) ContentType() string { return a.attachment.ContentType }
+func (a *graphqlAttachment) Size() int32         { return int32(a.attachment.Size) }
+func (a *graphqlAttachment) HasThumbnail() bool  { return a.attachment.HasThumbnail }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// TestGraphqlMessagesBatched - сообщения всех заказов из ответа выбираются одним запросом,
+// а не отдельным запросом на каждый заказ.
+func TestGraphqlMessagesBatched(t *testing.T) {
+	mock := useMockDB(t)
+	date := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT name, lastname, phone, profileimage, language FROM users`).WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "lastname", "phone", "profileimage", "language"}).
+			AddRow("Иван", "Петров", "87001234567", false, LangRU))
+	mock.ExpectQuery(`SELECT id, status, date, cost, carid, userid, info`).WithArgs("5", StatusClosed, StatusCancelled).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "date", "cost", "carid", "userid", "info", "mileage", "unread", "carinfo"}).
+			AddRow("1", StatusOpen, date, "", "7", "5", "ТО", "", 0, "Lada Priora(2010)").
+			AddRow("2", StatusOpen, date, "", "7", "5", "Шины", "", 0, "Lada Priora(2010)").
+			AddRow("3", StatusСonfirmed, date, "", "8", "5", "Кузов", "", 1, "Honda Accord(2003)"))
+	mock.ExpectQuery(`FROM messages m WHERE m.orderid = ANY`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "isadmin", "date", "text", "orderid", "readbycustomer", "readbystaff"}).
+			AddRow("10", false, date, "Когда забрать?", "1", true, true).
+			AddRow("11", true, date, "Завтра", "1", true, false).
+			AddRow("12", true, date, "Нужен осмотр", "3", false, false))
+	mock.ExpectQuery(`FROM attachments`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "messageid", "filename", "contenttype", "size", "hasthumbnail"}))
+
+	body := `{"query": "{ me { orders { id messages { text attachments { fileName } } } } }"}`
+	request := httptest.NewRequest(http.MethodPost, graphqlPath, strings.NewReader(body))
+	request = request.WithContext(context.WithValue(request.Context(), userIDKey{}, "5"))
+	recorder := httptest.NewRecorder()
+
+	graphqlHandler(recorder, request)
+
+	var response struct {
+		Data struct {
+			Me struct {
+				Orders []struct {
+					ID       string
+					Messages []struct{ Text string }
+				}
+			}
+		}
+		Errors []struct{ Message string }
+	}
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil || len(response.Errors) != 0 {
+		t.Fatalf("ответ %s", recorder.Body.String())
+	}
+
+	counts := make(map[string]int)
+	for _, order := range response.Data.Me.Orders {
+		counts[order.ID] = len(order.Messages)
+	}
+	if len(counts) != 3 || counts["1"] != 2 || counts["2"] != 0 || counts["3"] != 1 {
+		t.Errorf("сообщений по заказам: %v", counts)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/STEJLS/ServiceStation/XMLconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServiceName - полное имя gRPC сервиса.
+const grpcServiceName = "servicestation.ServiceStation"
+
+// grpcErrorCodeKey - ключ трейлера, в котором клиент получает код ошибки, как в http API.
+const grpcErrorCodeKey = "error-code"
+
+// jsonCodec - кодек gRPC, который передает сообщения в json вместо protobuf,
+// чтобы не генерировать код по .proto файлам. Клиент выбирает его типом содержимого application/grpc+json.
+type jsonCodec struct{}
+
+// Marshal - кодирует сообщение в json.
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal - декодирует сообщение из json.
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name - подтип содержимого, по которому gRPC выбирает кодек.
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+// init - регистрирует json кодек. gRPC разрешает регистрировать кодеки только при инициализации пакета,
+// пока не запущены серверы и клиенты.
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// grpcEmpty - пустой запрос или ответ.
+type grpcEmpty struct{}
+
+// grpcOrdersRequest - запрос заказов: закрытых или незакрытых.
+type grpcOrdersRequest struct {
+	Closed bool
+}
+
+// grpcOrderRequest - запрос по одному заказу.
+type grpcOrderRequest struct {
+	OrderID string
+}
+
+// grpcMessageRequest - новое сообщение по заказу.
+type grpcMessageRequest struct {
+	OrderID string
+	Text    string
+}
+
+// grpcStatusRequest - смена статуса заказа. Пробег сохраняется только при закрытии.
+type grpcStatusRequest struct {
+	OrderID string
+	Status  int
+	Mileage string
+}
+
+// grpcCars - список машин.
+type grpcCars struct {
+	Cars []*Car
+}
+
+// grpcOrders - список заказов.
+type grpcOrders struct {
+	Orders []*Order
+}
+
+// grpcMessages - список сообщений.
+type grpcMessages struct {
+	Messages []*Message
+}
+
+// grpcCaller - пользователь, который вызвал метод, и язык текстов ошибок для него.
+type grpcCaller struct {
+	id   string
+	lang string
+}
+
+// grpcStatusCodes - статусы gRPC для кодов ошибок. Остальные коды означают ошибку в запросе.
+var grpcStatusCodes = map[string]codes.Code{
+	CodeInternal:          codes.Internal,
+	CodeUnauthorized:      codes.Unauthenticated,
+	CodeTokenExpired:      codes.Unauthenticated,
+	CodeForbidden:         codes.PermissionDenied,
+	CodeClientCert:        codes.PermissionDenied,
+	CodeOrderNotFound:     codes.NotFound,
+	CodeOrderUnavailable:  codes.NotFound,
+	CodeOrderClosed:       codes.FailedPrecondition,
+	CodeOrderReadOnly:     codes.FailedPrecondition,
+	CodeInvalidTransition: codes.FailedPrecondition,
+}
+
+// grpcServiceDesc - описание сервиса для gRPC сервера. Методы повторяют http API
+// и используют те же функции работы с данными и ту же авторизацию.
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	Methods: []grpc.MethodDesc{
+		grpcMethod("ListCars", func() interface{} { return &grpcEmpty{} },
+			func(ctx context.Context, req interface{}) (interface{}, error) { return grpcListCars(ctx) }),
+		grpcMethod("ListOrders", func() interface{} { return &grpcOrdersRequest{} },
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return grpcListOrders(ctx, req.(*grpcOrdersRequest))
+			}),
+		grpcMethod("ListMessages", func() interface{} { return &grpcOrderRequest{} },
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return grpcListMessages(ctx, req.(*grpcOrderRequest))
+			}),
+		grpcMethod("AddMessage", func() interface{} { return &grpcMessageRequest{} },
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return grpcAddMessage(ctx, req.(*grpcMessageRequest), false)
+			}),
+		grpcMethod("AddStaffMessage", func() interface{} { return &grpcMessageRequest{} },
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return grpcAddMessage(ctx, req.(*grpcMessageRequest), true)
+			}),
+		grpcMethod("SetOrderStatus", func() interface{} { return &grpcStatusRequest{} },
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return grpcSetOrderStatus(ctx, req.(*grpcStatusRequest))
+			}),
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchOrderEvents",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				err := stream.RecvMsg(&grpcEmpty{})
+				if err != nil {
+					return err
+				}
+				return grpcWatchOrderEvents(stream)
+			},
+		},
+	},
+}
+
+// grpcMethod - описание унарного метода: имя, конструктор запроса и реализация.
+func grpcMethod(name string, newRequest func() interface{}, call grpc.UnaryHandler) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newRequest()
+			err := dec(req)
+			if err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + grpcServiceName + "/" + name}, call)
+		},
+	}
+}
+
+// serveGRPC - запускает gRPC сервер на отдельном порту, если он указан в конфигурации.
+// Когда отменяется ctx, сервер перестает принимать вызовы и дожидается завершения текущих.
+// Если задан tlsConfig, то gRPC работает по TLS с тем же сертификатом, что и https.
+func serveGRPC(ctx context.Context, config XMLconfig.Http, tlsConfig *tls.Config) {
+	if config.GRPCPort == 0 {
+		return
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("%v:%v", config.Host, config.GRPCPort))
+	if err != nil {
+		log.Println("Ошибка. При открытии порта gRPC сервера, gRPC недоступен: " + err.Error())
+		return
+	}
+
+	options := []grpc.ServerOption{grpc.UnaryInterceptor(grpcMetricsInterceptor), grpc.StreamInterceptor(grpcMetricsStreamInterceptor)}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig.Clone())))
+	}
+
+	server := grpc.NewServer(options...)
+	server.RegisterService(&grpcServiceDesc, nil)
+
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	log.Printf("Инфо. gRPC сервер слушает порт %d", config.GRPCPort)
+	err = server.Serve(listener)
+	if err != nil {
+		log.Println("Ошибка. В работе gRPC сервера: " + err.Error())
+	}
+}
+
+// grpcError - ошибка gRPC с текстом по коду на языке пользователя. Сам код передается в трейлере.
+func grpcError(ctx context.Context, lang string, code string, args ...interface{}) error {
+	grpc.SetTrailer(ctx, metadata.Pairs(grpcErrorCodeKey, code))
+
+	statusCode, ok := grpcStatusCodes[code]
+	if !ok {
+		statusCode = codes.InvalidArgument
+	}
+
+	return status.Error(statusCode, localize(lang, code, args...))
+}
+
+// authorizeGRPC - проверяет токен из метаданных token, это тот же токен, что и в cookie http API.
+// Язык текстов ошибок выбирается так же, как для http: из профиля или по метаданным accept-language.
+func authorizeGRPC(ctx context.Context, staffOnly bool) (*grpcCaller, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	caller := &grpcCaller{lang: defaultLanguage}
+	if values := md.Get("accept-language"); len(values) != 0 {
+		caller.lang = negotiateLanguage(values[0])
+	}
+
+	tokens := md.Get("token")
+	if len(tokens) == 0 || tokens[0] == "" {
+		return nil, grpcError(ctx, caller.lang, CodeUnauthorized)
+	}
+
+	id, lang, err := findAuthorization(tokens[0])
+	if err == sql.ErrNoRows {
+		log.Println("Инфо. Попытка доступа к gRPC по недействительному токену.")
+		return nil, grpcError(ctx, caller.lang, CodeTokenExpired)
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске записи в БД об авторизации пользователя: " + err.Error())
+		return nil, grpcError(ctx, caller.lang, CodeInternal)
+	}
+
+	caller.id = id
+	if lang != "" {
+		caller.lang = lang
+	}
+
+	if staffOnly {
+		if staffTerminalsOnly && !grpcFromStaffTerminal(ctx) {
+			log.Println("Инфо. Попытка вызова служебного метода gRPC не с терминала сотрудника.")
+			return nil, grpcError(ctx, caller.lang, CodeClientCert)
+		}
+
+		staff, err := isStaff(id)
+		if err != nil {
+			log.Println("Ошибка. При поиске в БД роли пользователя: " + err.Error())
+			return nil, grpcError(ctx, caller.lang, CodeInternal)
+		}
+		if !staff {
+			log.Println("Инфо. Попытка вызова служебного метода gRPC пользователем(ид = " + id + ") без прав сотрудника.")
+			return nil, grpcError(ctx, caller.lang, CodeForbidden)
+		}
+	}
+
+	return caller, nil
+}
+
+// grpcFromStaffTerminal - проверяет, что вызов пришел с проверенным клиентским сертификатом терминала сотрудника.
+func grpcFromStaffTerminal(ctx context.Context) bool {
+	client, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+
+	info, ok := client.AuthInfo.(credentials.TLSInfo)
+	return ok && len(info.State.VerifiedChains) != 0
+}
+
+// grpcListCars - машины пользователя, как GET /cars.
+func grpcListCars(ctx context.Context) (*grpcCars, error) {
+	caller, err := authorizeGRPC(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	cars, err := getUserCars(caller.id)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД информации о машинах пользователя(ид =  %s): %s\n", caller.id, err.Error())
+		return nil, grpcError(ctx, caller.lang, CodeInternal)
+	}
+
+	return &grpcCars{Cars: cars}, nil
+}
+
+// grpcListOrders - заказы пользователя, как GET /orders.
+func grpcListOrders(ctx context.Context, req *grpcOrdersRequest) (*grpcOrders, error) {
+	caller, err := authorizeGRPC(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := getUserOrders(caller.id, req.Closed)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД информации о заказах пользователя(ид =  %s): %s\n", caller.id, err.Error())
+		return nil, grpcError(ctx, caller.lang, CodeInternal)
+	}
+
+	return &grpcOrders{Orders: orders}, nil
+}
+
+// grpcListMessages - переписка по заказу. Сотрудник видит любой заказ, как в GET /admin/orders/{orderID}/messages,
+// остальные - только свои, как в GET /orders/{orderID}/messages.
+func grpcListMessages(ctx context.Context, req *grpcOrderRequest) (*grpcMessages, error) {
+	caller, err := authorizeGRPC(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := strconv.Atoi(req.OrderID); err != nil {
+		return nil, grpcError(ctx, caller.lang, CodeInvalidOrderID)
+	}
+
+	staff, err := isStaff(caller.id)
+	if err == nil && !staff {
+		err = db.QueryRow(`SELECT id FROM orders WHERE id = $2 AND `+visibleOrdersCondition+` LIMIT 1`, caller.id, req.OrderID).Scan(&req.OrderID)
+		if err == sql.ErrNoRows {
+			return nil, grpcError(ctx, caller.lang, CodeOrderNotFound)
+		}
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске записи в БД о заказе: " + err.Error())
+		return nil, grpcError(ctx, caller.lang, CodeInternal)
+	}
+
+	messages, err := loadOrderMessages(req.OrderID)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД информации о сообщениях заказа(ид =  %s): %s\n", req.OrderID, err.Error())
+		return nil, grpcError(ctx, caller.lang, CodeInternal)
+	}
+
+	return &grpcMessages{Messages: messages}, nil
+}
+
+// grpcAddMessage - сообщение по заказу от клиента или, если staff, от сотрудника сервиса.
+// Вложения через gRPC не передаются.
+func grpcAddMessage(ctx context.Context, req *grpcMessageRequest, staff bool) (*Message, error) {
+	caller, err := authorizeGRPC(ctx, staff)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &Message{
+		Date:        time.Now(),
+		Text:        req.Text,
+		OrderID:     req.OrderID,
+		Attachments: make([]*Attachment, 0),
+	}
+
+	resultOfValidation := ValidateMessage(message)
+	if len(resultOfValidation) != 0 {
+		grpc.SetTrailer(ctx, metadata.Pairs(grpcErrorCodeKey, CodeValidation))
+		return nil, status.Error(codes.InvalidArgument, resultOfValidation.text(caller.lang))
+	}
+
+	var code string
+	if staff {
+		code, err = saveStaffMessage(message)
+	} else {
+		code, err = saveCustomerMessage(caller.id, message)
+	}
+	if err != nil {
+		log.Printf("Ошибка. При добавлении сообщения из gRPC к заказу(ид пользователя =  %s,ид заказа =  %s ): %s\n", caller.id, req.OrderID, err.Error())
+		return nil, grpcError(ctx, caller.lang, CodeInternal)
+	}
+	if code != "" {
+		return nil, grpcError(ctx, caller.lang, code)
+	}
+
+	return message, nil
+}
+
+// grpcSetOrderStatus - подтверждение или закрытие заказа сотрудником.
+func grpcSetOrderStatus(ctx context.Context, req *grpcStatusRequest) (*grpcEmpty, error) {
+	caller, err := authorizeGRPC(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := strconv.Atoi(req.OrderID); err != nil {
+		return nil, grpcError(ctx, caller.lang, CodeInvalidOrderID)
+	}
+	if req.Status != StatusСonfirmed && req.Status != StatusClosed && req.Status != StatusCancelled {
+		return nil, grpcError(ctx, caller.lang, CodeInvalidStatus)
+	}
+	if req.Mileage != "" {
+		if value, err := strconv.Atoi(req.Mileage); err != nil || value < 0 {
+			return nil, grpcError(ctx, caller.lang, CodeInvalidMileage)
+		}
+	}
+
+	code, err := changeOrderStatus(req.OrderID, req.Status, req.Mileage)
+	if err != nil {
+		log.Printf("Ошибка. При смене статуса заказа(ид = %s) из gRPC: %s\n", req.OrderID, err.Error())
+		return nil, grpcError(ctx, caller.lang, CodeInternal)
+	}
+	if code != "" {
+		return nil, grpcError(ctx, caller.lang, code)
+	}
+
+	return &grpcEmpty{}, nil
+}
+
+// grpcWatchOrderEvents - поток событий заказов пользователя, как GET /orders/events.
+func grpcWatchOrderEvents(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+
+	caller, err := authorizeGRPC(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	ch := events.subscribe(caller.id)
+	defer events.unsubscribe(caller.id, ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-events.done():
+			return nil
+		case event := <-ch:
+			err = stream.SendMsg(event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
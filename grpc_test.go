@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+// TestJSONCodecRegistered - json кодек зарегистрирован при инициализации пакета, а не при запуске сервера.
+func TestJSONCodecRegistered(t *testing.T) {
+	if encoding.GetCodec("json") == nil {
+		t.Fatal("json кодек gRPC не зарегистрирован")
+	}
+}
+
+// testServerStream - поток gRPC без соединения.
+type testServerStream struct {
+	grpc.ServerStream
+}
+
+func (testServerStream) Context() context.Context { return context.Background() }
+
+// TestGRPCStreamMetrics - потоковые методы учитываются в метриках: открытый поток и вызов по коду ответа.
+func TestGRPCStreamMetrics(t *testing.T) {
+	method := "/" + grpcServiceName + "/WatchOrderEvents"
+	info := &grpc.StreamServerInfo{FullMethod: method, IsServerStream: true}
+	before := testutil.ToFloat64(grpcRequests.WithLabelValues(method, codes.Unauthenticated.String()))
+
+	err := grpcMetricsStreamInterceptor(nil, testServerStream{}, info, func(srv interface{}, stream grpc.ServerStream) error {
+		if open := testutil.ToFloat64(grpcStreams.WithLabelValues(method)); open != 1 {
+			t.Errorf("открытых потоков %v, ожидается 1", open)
+		}
+		return status.Error(codes.Unauthenticated, "")
+	})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("интерсептор изменил ошибку: %v", err)
+	}
+
+	if open := testutil.ToFloat64(grpcStreams.WithLabelValues(method)); open != 0 {
+		t.Errorf("после закрытия открытых потоков %v", open)
+	}
+	if after := testutil.ToFloat64(grpcRequests.WithLabelValues(method, codes.Unauthenticated.String())); after != before+1 {
+		t.Errorf("вызовов %v, ожидается %v", after, before+1)
+	}
+}
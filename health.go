@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// buildCommit - коммит, из которого собран сервис. Задается при сборке:
+// go build -ldflags "-X main.buildCommit=$(git rev-parse HEAD)".
+// Если не задан, то берется из информации о сборке, которую go добавляет сам.
+var buildCommit string
+
+// readinessTimeout - сколько ждать ответа от базы данных при проверке готовности.
+const readinessTimeout = 2 * time.Second
+
+//HealthCheck - структура, описывающая результат одной проверки готовности сервиса.
+type HealthCheck struct {
+	Name  string
+	OK    bool
+	Error string `json:",omitempty"`
+}
+
+//Readiness - структура, описывающая готовность сервиса принимать запросы.
+type Readiness struct {
+	Ready  bool
+	Checks []*HealthCheck
+}
+
+//BuildInfo - структура, описывающая версию сервиса.
+type BuildInfo struct {
+	Commit          string
+	GoVersion       string
+	SchemaVersion   int // версия схемы БД, с которой работает код
+	DBSchemaVersion int // версия схемы БД, которая сейчас в базе, 0 - если не удалось получить
+}
+
+// liveHandler - сервис жив и отвечает на запросы. Ничего не проверяет, чтобы недоступность базы данных
+// не приводила к перезапуску сервиса.
+func liveHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealthJSON(w, http.StatusOK, struct{ Status string }{"ok"})
+}
+
+// readyHandler - сервис готов принимать запросы: база данных доступна, в хранилище файлов можно писать
+// и схема БД той версии, с которой работает код. Если нет, то отвечает 503 со списком проверок.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	readiness := &Readiness{Ready: true}
+	check := func(name string, err error) {
+		result := &HealthCheck{Name: name, OK: err == nil}
+		if err != nil {
+			log.Printf("Ошибка. Сервис не готов, проверка %s: %s\n", name, err.Error())
+			result.Error = err.Error()
+			readiness.Ready = false
+		}
+		readiness.Checks = append(readiness.Checks, result)
+	}
+
+	check("database", db.PingContext(ctx))
+	check("storage", checkStorageWritable())
+
+	version, err := dbSchemaVersion(ctx)
+	if err == nil && version < schemaVersion {
+		err = fmt.Errorf("версия схемы БД %d, ожидается %d: не применены миграции %d-%d", version, schemaVersion, version+1, schemaVersion)
+	}
+	if err == nil && version > schemaVersion {
+		err = fmt.Errorf("версия схемы БД %d новее, чем знает сервис(%d): запущена старая сборка", version, schemaVersion)
+	}
+	check("schema", err)
+
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealthJSON(w, status, readiness)
+}
+
+// versionHandler - отдает коммит, из которого собран сервис, и версии схемы БД.
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	info := &BuildInfo{Commit: currentBuildCommit(), GoVersion: runtime.Version(), SchemaVersion: schemaVersion}
+
+	version, err := dbSchemaVersion(ctx)
+	if err != nil {
+		log.Println("Ошибка. При получении версии схемы БД: " + err.Error())
+	} else {
+		info.DBSchemaVersion = version
+	}
+
+	writeHealthJSON(w, http.StatusOK, info)
+}
+
+// currentBuildCommit - коммит из флагов сборки, иначе из информации о сборке go, иначе "unknown".
+func currentBuildCommit() string {
+	if buildCommit != "" {
+		return buildCommit
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+
+	return "unknown"
+}
+
+// dbSchemaVersion - версия схемы, которая сейчас в базе данных.
+func dbSchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := db.QueryRowContext(ctx, `SELECT version FROM schemaversion`).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("в таблице schemaversion нет версии")
+	}
+
+	return version, err
+}
+
+// checkStorageWritable - проверяет, что в хранилище файлов можно создать файл.
+func checkStorageWritable() error {
+	file, err := ioutil.TempFile(storageDirectory, ".ready")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write([]byte("ok"))
+	closeErr := file.Close()
+	removeErr := os.Remove(file.Name())
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = removeErr
+	}
+
+	return err
+}
+
+// writeHealthJSON - отвечает json с кодом status. Служебные ответы не кешируются.
+func writeHealthJSON(w http.ResponseWriter, status int, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи состояния сервиса: " + err.Error())
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// TestReadySchemaBehind - сервис не готов, пока к базе не применены все миграции.
+func TestReadySchemaBehind(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery(`SELECT version FROM schemaversion`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(schemaVersion - 1))
+
+	recorder := httptest.NewRecorder()
+	readyHandler(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+	readiness := Readiness{}
+	err := json.Unmarshal(recorder.Body.Bytes(), &readiness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusServiceUnavailable || readiness.Ready {
+		t.Fatalf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+	for _, check := range readiness.Checks {
+		if check.Name == "schema" {
+			if check.OK || !strings.Contains(check.Error, "миграции") {
+				t.Errorf("проверка схемы: %+v", check)
+			}
+			return
+		}
+	}
+	t.Error("нет проверки схемы")
+}
@@ -27,34 +27,37 @@ func registrationHandler(w http.ResponseWriter, r *http.Request) {
 	err = db.QueryRow("SELECT id FROM users WHERE login = $1", user.Login).Scan(&id)
 	if err == nil {
 		log.Printf("Инфо. Попытка зарегистрироваться с логином которые уже существует(%s)", user.Login)
-		http.Error(w, "Пользователь с таким логином уже существует.", http.StatusBadRequest)
+		writeFieldError(w, "login", CodeUserExists)
 		return
 	}
 
 	if err != nil && err != sql.ErrNoRows {
 		log.Printf("Ошибка. При проверке в БД пользователя с именем %s: %v\n", user.Login, err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
 	var userid int // регистрация в бд
-	err = db.QueryRow(`INSERT INTO users(login, password, name, lastName, phone, profileImage)
-	VALUES($1, $2, $3, $4, $5, $6) RETURNING id`, user.Login, user.Password, user.Name, user.LastName, user.Phone, user.ProfileImage).Scan(&userid)
+	err = db.QueryRow(`INSERT INTO users(login, password, name, lastName, phone, profileImage, language)
+	VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id`, user.Login, user.Password, user.Name, user.LastName, user.Phone, user.ProfileImage, user.Language).Scan(&userid)
 	if err != nil {
 		log.Printf("Ошибка. При добавлении нового пользователя в БД: %v\n", err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
 	if user.ProfileImage {
 		err = saveFile(fd, strconv.Itoa(userid))
 		if err != nil {
-			http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, CodeInternal)
 			return
 		}
 	}
 
-	w.Write([]byte("Регистрация успешно выполнена"))
+	if user.Language != "" {
+		w.Header().Set("Content-Language", user.Language)
+	}
+	writeMessage(w, MsgRegistered)
 	log.Printf("Инфо. Пользователь с ником %q зарегистрировался", user.Login)
 }
 
@@ -64,12 +67,12 @@ func authorizationHandler(w http.ResponseWriter, r *http.Request) {
 	estimatePass := r.FormValue("password")
 
 	if len(estimatePass) < 6 {
-		http.Error(w, "Длина пароля должна быть не менее 7 символов.", http.StatusBadRequest)
+		writeFieldError(w, "password", CodePasswordTooShort, 7)
 		return
 	}
 
 	if login == "" {
-		http.Error(w, "Логин не может быть пустой строкой.", http.StatusBadRequest)
+		writeFieldError(w, "login", CodeLoginRequired)
 		return
 	}
 
@@ -79,20 +82,20 @@ func authorizationHandler(w http.ResponseWriter, r *http.Request) {
 	err := db.QueryRow("SELECT id, password FROM users WHERE login = $1", login).Scan(&id, &password)
 	if err != nil && err == sql.ErrNoRows {
 		log.Println("Инфо. Запрос по несуществующему пользователю(login - " + login + " ): " + err.Error())
-		http.Error(w, "Пользователя с таким логином не существует.", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeLoginNotFound)
 		return
 	}
 
 	if err != nil {
 		log.Println("Ошибка. При поиске в БД пользователя(логин - " + login + " ): " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
 	estimatePass = generateMD5hash(estimatePass)
 
 	if password != estimatePass {
-		http.Error(w, "Неверный пароль.", http.StatusBadRequest)
+		writeFieldError(w, "password", CodeWrongPassword)
 		return
 	}
 
@@ -101,14 +104,14 @@ func authorizationHandler(w http.ResponseWriter, r *http.Request) {
 	_, err = db.Exec(`INSERT INTO authorizations VALUES($1, $2)`, id, token)
 	if err != nil {
 		log.Println("Ошибка. При создании записи в БД об авторизации пользователя: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: token})
+	http.SetCookie(w, &http.Cookie{Name: "token", Value: token, Secure: r.TLS != nil})
 
 	log.Println("Инфо. Пользователь " + login + " авторизовался.")
-	w.Write([]byte("Авторизация успешно выполнена."))
+	writeMessage(w, MsgAuthorized)
 }
 
 // logOutHandler - реализует выход из аккаунта
@@ -123,72 +126,61 @@ func logOutHandler(w http.ResponseWriter, r *http.Request) {
 	_, err := db.Exec(`DELETE FROM authorizations WHERE token = $1`, token)
 	if err != nil {
 		log.Println("Ошибка. При удалении записи в БД об авторизации пользователя: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
-	w.Write([]byte("Выход из системы успешно выполнен."))
+	writeMessage(w, MsgLoggedOut)
 }
 
 // profileImageHandler - возвращает аватарку, если она есть.
 func profileImageHandler(w http.ResponseWriter, r *http.Request) {
-	id := checkAuthorization(w, r)
-
-	if id == "" {
-		return
-	}
+	id := currentUserID(r)
 
 	var withProfileImage bool
 
 	err := db.QueryRow(`SELECT profileimage FROM users WHERE id=$1`, id).Scan(&withProfileImage)
 	if err == sql.ErrNoRows {
 		log.Println("Инфо. Запрос по несуществующему пользователю(ид - " + id + " ): " + err.Error())
-		http.Error(w, "Запрашиваемого пользователя не существует.", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeUserNotFound)
 		return
 	}
 
 	if err != nil {
 		log.Println("Ошибка. При запросе информации о пользователе (id - " + id + " ): " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
 	if withProfileImage {
 		http.ServeFile(w, r, fmt.Sprintf("%s%s", storageDirectory, id))
 	} else {
-		http.Error(w, "У данного пользоватля нет аватарки.", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeNoProfileImage)
 	}
 }
 
 // profileHandler - отдает информацию о пользователе.
 func profileInfoHandler(w http.ResponseWriter, r *http.Request) {
-	id := checkAuthorization(w, r)
-
-	if id == "" {
-		return
-	}
-
-	user := User{}
+	id := currentUserID(r)
 
-	err := db.QueryRow(`SELECT name, lastname, phone, profileimage FROM users WHERE id=$1`, id).
-		Scan(&user.Name, &user.LastName, &user.Phone, &user.ProfileImage)
+	user, err := getUserProfile(id)
 
 	if err == sql.ErrNoRows {
 		log.Println("Инфо. Запрос по несуществующему пользователю(ид - " + id + " ): " + err.Error())
-		http.Error(w, "Запрашиваемого пользователя не существует.", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeUserNotFound)
 		return
 	}
 
 	if err != nil {
 		log.Println("Ошибка. При поиске в БД информации о пользователе(ид - " + id + " ): " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
 	data, err := json.Marshal(user)
 	if err != nil {
 		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
@@ -197,69 +189,67 @@ func profileInfoHandler(w http.ResponseWriter, r *http.Request) {
 	_, err = w.Write(data)
 	if err != nil {
 		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 	}
 
 	log.Println("Инфо. Отдача метаданных профиля id = " + id + ")успешно закончена")
 }
 
+// getUserProfile - возвращает информацию о пользователе без логина и пароля.
+func getUserProfile(userID string) (*User, error) {
+	user := User{}
+
+	err := db.QueryRow(`SELECT name, lastname, phone, profileimage, language FROM users WHERE id=$1`, userID).
+		Scan(&user.Name, &user.LastName, &user.Phone, &user.ProfileImage, &user.Language)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 // registrationHandler - обработчик, который осуществляет регистрацию нового пользователя.
 func addCarHandler(w http.ResponseWriter, r *http.Request) {
-	id := checkAuthorization(w, r)
+	id := currentUserID(r)
 
-	if id == "" {
+	car := getAndCheckCar(w, r)
+	if car == nil {
 		return
 	}
 
-	car := getAndCheckCar(w, r)
-	if car == nil {
+	car.OrgID = r.FormValue("orgID")
+	if car.OrgID != "" && !checkOrgRole(w, id, car.OrgID, RoleFleetManager) {
 		return
 	}
 
-	_, err := db.Exec("INSERT INTO cars(brand, model, vin, year, userid) VALUES($1, $2, $3, $4, $5)", car.Brand, car.Model, car.VIN, car.Year, id)
+	_, err := db.Exec(`INSERT INTO cars(brand, model, vin, year, userid, plate, platecountry, color, engine, transmission, orgid)
+	VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		car.Brand, car.Model, car.VIN, car.Year, id, car.Plate, car.PlateCountry, car.Color, car.Engine, car.Transmission,
+		sql.NullString{String: car.OrgID, Valid: car.OrgID != ""})
 	if err != nil {
 		log.Printf("Ошибка. При добавлении в БД машины пользователю(ид = %s): %s\n", id, err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
 	log.Printf("Инфо. Пользователю (ид = %s) добавлена машина", id)
-	w.Write([]byte("Машина успешно добавлена успешно выполнена"))
+	writeMessage(w, MsgCarAdded)
 }
 
 func GetCarsHandler(w http.ResponseWriter, r *http.Request) {
-	id := checkAuthorization(w, r)
-
-	if id == "" {
-		return
-	}
-
-	rows, err := db.Query("SELECT id, brand, model, vin, year, userid FROM cars WHERE userid = $1 AND deleted = FALSE", id)
+	id := currentUserID(r)
 
+	result, err := getUserCars(id)
 	if err != nil {
 		log.Printf("Ошибка. При выборке из БД информации о машинах пользователя(ид =  %s): %s\n", id, err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
-	defer rows.Close()
-
-	result := make([]*Car, 0)
-
-	for rows.Next() {
-		car := Car{}
-		err = rows.Scan(&car.ID, &car.Brand, &car.Model, &car.VIN, &car.Year, &car.UserID)
-		if err != nil {
-			log.Printf("Ошибка. При выборке из БД информации о машинах пользователя(ид =  %s): %s\n", id, err.Error())
-			http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
-			return
-		}
-		result = append(result, &car)
-	}
 
 	data, err := json.Marshal(result)
 	if err != nil {
 		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
@@ -268,48 +258,78 @@ func GetCarsHandler(w http.ResponseWriter, r *http.Request) {
 	_, err = w.Write(data)
 	if err != nil {
 		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 	}
 
 	log.Println("Инфо. Отдача информации о машинах пользователя(ид =  " + id + ") успешно закончена")
 
 }
 
-func removeCarHandler(w http.ResponseWriter, r *http.Request) {
-	id := checkAuthorization(w, r)
+// getUserCars - возвращает машины пользователя и машины организаций, которые он видит.
+func getUserCars(userID string) ([]*Car, error) {
+	rows, err := db.Query(`SELECT id, brand, model, vin, year, userid, plate, platecountry, color, engine, transmission,
+	COALESCE((SELECT MAX(mileage)::text FROM odometer WHERE odometer.carid = cars.id), ''), COALESCE(orgid::text, '')
+	FROM cars WHERE `+ownedCarCondition+` AND deleted = FALSE`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	if id == "" {
-		return
+	result := make([]*Car, 0)
+
+	for rows.Next() {
+		car := Car{}
+		err = rows.Scan(&car.ID, &car.Brand, &car.Model, &car.VIN, &car.Year, &car.UserID,
+			&car.Plate, &car.PlateCountry, &car.Color, &car.Engine, &car.Transmission, &car.Mileage, &car.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &car)
 	}
 
+	return result, rows.Err()
+}
+
+func removeCarHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
 	carID := r.FormValue("id")
 
-	if carID == "" {
+	if _, err := strconv.Atoi(carID); err != nil {
 		log.Println("Ошибка. Пользователь не передал id машины для удаления машины.")
-		http.Error(w, "Необходимо передать id машины, которую вы хотите удалить", http.StatusBadRequest)
+		writeFieldError(w, "id", CodeInvalidCarID)
+		return
+	}
+
+	if !checkCarAccess(w, id, carID, true) {
 		return
 	}
+
 	_, err := db.Exec(`UPDATE cars SET deleted = TRUE WHERE id = $1`, carID)
+	if err == nil {
+		_, err = db.Exec(`UPDATE orders SET `+orderRevised+` WHERE carid = $1`, carID)
+	}
 	if err != nil {
 		log.Println("Ошибка. При удалении записи в БД об машине: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
-	w.Write([]byte("Машина успешно удалена из системы."))
+	writeMessage(w, MsgCarRemoved)
 }
 
 func addOrderHandler(w http.ResponseWriter, r *http.Request) {
-	id := checkAuthorization(w, r)
+	id := currentUserID(r)
 
-	if id == "" {
+	order := getAndCheckOrder(w, r)
+	if order == nil {
 		return
 	}
 
-	order := getAndCheckOrder(w, r)
-	if order == nil {
+	if !checkCarAccess(w, id, order.CarID, false) {
 		return
 	}
+
 	order.UserID = id
 	order.Status = StatusOpen
 
@@ -324,183 +344,195 @@ func addOrderHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Printf("Ошибка. При добавлении в БД заказа пользователю(ид = %s): %s\n", id, err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
-	_, err = db.Exec("INSERT INTO messages(isadmin, date, text, orderid) VALUES(FALSE, $1, $2, $3)", time.Now(), order.Info, order.ID)
+	var messageID string
+	err = db.QueryRow("INSERT INTO messages(isadmin, date, text, orderid) VALUES(FALSE, $1, $2, $3) RETURNING id", time.Now(), order.Info, order.ID).Scan(&messageID)
+	if err == nil {
+		err = markMessagesRead(db, order.ID, id, messageID)
+	}
 	if err != nil {
 		log.Printf("Ошибка. При добавлении в БД первого сообщения пользователю(ид = %s): %s\n", id, err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
+	if order.Mileage != "" {
+		_, err = db.Exec(`UPDATE orders SET mileage = $1 WHERE id = $2`, order.Mileage, order.ID)
+		if err == nil {
+			_, err = db.Exec(`INSERT INTO odometer(vin, carid, date, mileage, orderid) SELECT upper(vin), id, $1, $2, $3 FROM cars WHERE id = $4`,
+				time.Now(), order.Mileage, order.ID, order.CarID)
+		}
+		if err != nil {
+			log.Printf("Ошибка. При сохранении пробега по заказу(ид = %s): %s\n", order.ID, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+	}
+
+	publishOrderEvent(&OrderEvent{Type: EventStatus, OrderID: order.ID, Status: order.Status})
+
 	log.Printf("Инфо. Пользователю (ид = %s) добавлен заказ", id)
-	w.Write([]byte("Заказ успешно добавлен"))
+	writeMessage(w, MsgOrderAdded)
 }
 
 // getOrdersHandler - отдает все заказы пользователя в формате json
 func getOrdersHandler(w http.ResponseWriter, r *http.Request) {
-	id := checkAuthorization(w, r)
+	id := currentUserID(r)
 
-	if id == "" {
+	result, err := getUserOrders(id, r.FormValue("isclosed") == "true")
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД информации о заказах пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
-	var err error
-	var rows *sql.Rows
-	if r.FormValue("isclosed") == "true" {
-		rows, err = db.Query("SELECT * FROM orders WHERE userid = $1 AND status = $2 ORDER BY status, date", id, StatusClosed)
-	} else {
-		rows, err = db.Query("SELECT * FROM orders WHERE userid = $1 AND status != $2 ORDER BY status, date", id, StatusClosed)
-	}
+	data, err := json.Marshal(result)
 	if err != nil {
-		log.Printf("Ошибка. При выборке из БД информации о заказах пользователя(ид =  %s): %s\n", id, err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+
+	log.Println("Инфо. Отдача информации о заказах пользователя(ид =  " + id + ") успешно закончена")
+
+}
+
+// getUserOrders - возвращает закрытые или незакрытые заказы, которые видит пользователь.
+// Отмененные заказы показываются вместе с закрытыми.
+func getUserOrders(userID string, closed bool) ([]*Order, error) {
+	condition := "status NOT IN ($2, $3)"
+	if closed {
+		condition = "status IN ($2, $3)"
+	}
+
+	rows, err := db.Query("SELECT id, status, date, cost, carid, userid, info, COALESCE(mileage::text, ''), "+unreadCountColumn+", "+
+		"(SELECT brand || ' ' || model || '(' || year || ')' FROM cars WHERE cars.id = orders.carid) "+
+		"FROM orders WHERE "+visibleOrdersCondition+" AND "+condition+" ORDER BY status, date", userID, StatusClosed, StatusCancelled)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	result := make([]*Order, 0)
-	var (
-		brand, model, year string
-		date               time.Time
-	)
+	var date time.Time
 
 	for rows.Next() {
 		order := Order{}
-		err = rows.Scan(&order.ID, &order.Status, &date, &order.Cost, &order.CarID, &order.UserID, &order.Info, &order.IsNewMSGForUser)
+		err = rows.Scan(&order.ID, &order.Status, &date, &order.Cost, &order.CarID, &order.UserID, &order.Info, &order.Mileage, &order.UnreadCount, &order.CarInfo)
 		if err != nil {
-			log.Printf("Ошибка. При выборке из БД информации о машинах пользователя(ид =  %s): %s\n", id, err.Error())
-			http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
-			return
+			return nil, err
 		}
 
+		order.IsNewMSGForUser = order.UnreadCount > 0
 		order.Month = strconv.Itoa(int(date.Month()))
 		order.Day = strconv.Itoa(date.Day())
 		order.Year = strconv.Itoa(date.Year())
 
-		err = db.QueryRow("SELECT brand, model, year FROM cars WHERE id = $1", order.CarID).Scan(&brand, &model, &year)
-		if err != nil {
-			log.Printf("Ошибка. При выборке из БД информации о машине пользователя(id машины =  %s): %s\n", order.CarID, err.Error())
-			http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
-			return
-		}
-
-		order.CarInfo = brand + " " + model + "(" + year + ")"
 		result = append(result, &order)
 	}
 
-	data, err := json.Marshal(result)
-	if err != nil {
-		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Add("Content-type", "application/json;")
-
-	_, err = w.Write(data)
-	if err != nil {
-		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
-	}
-
-	log.Println("Инфо. Отдача информации о заказах пользователя(ид =  " + id + ") успешно закончена")
-
+	return result, rows.Err()
 }
 
 // addMessageToOrderHandler - добавляет сообщение к заказу
 func addMessageToOrderHandler(w http.ResponseWriter, r *http.Request) {
-	id := checkAuthorization(w, r)
+	id := currentUserID(r)
 
-	if id == "" {
+	message := getAndCheckMessage(w, r)
+	if message == nil {
 		return
 	}
+	defer closeAttachments(message.Attachments)
 
-	message := getAndCheckMessage(w, r)
-	if message == nil {
+	code, err := saveCustomerMessage(id, message)
+	if err != nil {
+		log.Printf("Ошибка. При добавлении сообщения к заказу(ид пользователя =  %s,ид заказа =  %s ): %s\n", id, message.OrderID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
+	if code != "" {
+		writeError(w, http.StatusBadRequest, code)
+	}
+}
 
+// saveCustomerMessage - проверяет, что пользователь может писать в заказ, сохраняет его сообщение
+// и рассылает событие участникам заказа. Сообщение должно быть уже проверено ValidateMessage.
+// Возвращает код ошибки для пользователя, если добавить сообщение к заказу нельзя.
+func saveCustomerMessage(userID string, message *Message) (string, error) {
 	var status int
-	err := db.QueryRow(`SELECT status FROM orders WHERE id = $1 AND userID = $2 LIMIT 1`, message.OrderID, id).Scan(&status)
+	var writable bool
+	err := db.QueryRow(`SELECT orders.status, `+ownedCarCondition+` FROM orders JOIN cars ON cars.id = orders.carid
+	WHERE orders.id = $2 AND `+visibleOrdersCondition+` LIMIT 1`, userID, message.OrderID).Scan(&status, &writable)
 	if err == sql.ErrNoRows {
 		log.Println("Инфо. Попытка добавить сообщение к указанному заказу: " + err.Error())
-		http.Error(w, "Невозможно добавить сообщение к указанному заказу.", http.StatusBadRequest)
-		return
+		return CodeOrderUnavailable, nil
 	}
 	if err != nil {
-		log.Println("Ошибка. При поиске записи в БД о заказе: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
-		return
+		return "", err
 	}
 
-	if status == StatusClosed {
+	if status == StatusClosed || status == StatusCancelled {
 		log.Println("Инфо. Попытка добавить сообщение к закрытому заказу: ")
-		http.Error(w, "Невозможно добавить сообщение к закрытому заказу.", http.StatusBadRequest)
-		return
+		return CodeOrderClosed, nil
 	}
 
-	_, err = db.Exec("INSERT INTO messages(isadmin, date, text, orderid) VALUES(FALSE, $1, $2, $3)", message.Date, message.Text, message.OrderID)
+	if !writable {
+		log.Println("Инфо. Попытка добавить сообщение к заказу по машине, переданной другому владельцу.")
+		return CodeOrderReadOnly, nil
+	}
+
+	err = insertMessage(message, userID)
 	if err != nil {
-		log.Printf("Ошибка. При добавлении сообщения к заказу(ид пользователя =  %s,ид заказа =  %s ): %s\n", id, message.OrderID, err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
-		return
+		return "", err
 	}
+
+	publishOrderEvent(&OrderEvent{Type: EventMessage, OrderID: message.OrderID, Status: status, Message: message})
+
+	return "", nil
 }
 
 func getMessagesHandler(w http.ResponseWriter, r *http.Request) {
-	id := checkAuthorization(w, r)
-
-	if id == "" {
-		return
-	}
+	id := currentUserID(r)
 
 	orderID := r.FormValue("orderID")
 	if _, err := strconv.Atoi(orderID); err != nil {
 		log.Println("Инфо. Попытка получить сообщения заказа с невалидным ID.")
-		http.Error(w, "Ошибка. Получен некорректный номер заказа", http.StatusBadRequest)
+		writeFieldError(w, "orderID", CodeInvalidOrderID)
 		return
 	}
 
-	err := db.QueryRow(`SELECT id FROM orders WHERE id = $1 AND userID = $2 LIMIT 1`, orderID, id).Scan(&orderID)
+	err := db.QueryRow(`SELECT id FROM orders WHERE id = $2 AND `+visibleOrdersCondition+` LIMIT 1`, id, orderID).Scan(&orderID)
 	if err == sql.ErrNoRows {
 		log.Println("Инфо. Попытка получить сообщения заказа, которого нет у пользователя или его вовсе не существует: " + err.Error())
-		http.Error(w, "Укажите верный номер заказа.", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeOrderNotFound)
 		return
 	}
 	if err != nil {
 		log.Println("Ошибка. При поиске записи в БД о заказе: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
-	rows, err := db.Query(`SELECT * FROM messages WHERE orderid = $1 ORDER BY date`, orderID)
-	if err != nil {
-		log.Printf("Ошибка. При выборке из БД информации о машинах пользователя(ид =  %s): %s\n", id, err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже."+err.Error(), http.StatusInternalServerError)
+	result := getOrderMessages(w, orderID)
+	if result == nil {
 		return
 	}
-	defer rows.Close()
-
-	result := make([]*Message, 0)
-
-	for rows.Next() {
-		message := Message{}
-		err = rows.Scan(&message.IsAdmin, &message.Date, &message.Text, &message.OrderID)
-		if err != nil {
-			log.Printf("Ошибка. При выборке из БД информации о сообщениях заказа(ид =  %s): %s\n", orderID, err.Error())
-			http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
-			return
-		}
-		result = append(result, &message)
-	}
 
 	data, err := json.Marshal(result)
 	if err != nil {
 		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
 
@@ -509,28 +541,100 @@ func getMessagesHandler(w http.ResponseWriter, r *http.Request) {
 	_, err = w.Write(data)
 	if err != nil {
 		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 	}
 
-	db.Exec("UPDATE orders SET newmsgforuser=FALSE WHERE id=$1", orderID)
-
 	log.Println("Инфо. Отдача информации о сообщения заказа(ид =  " + orderID + ") успешно закончена")
 
 }
 
-// addMessageToOrderHandler - добавляет сообщение к заказу
+// addAdminMeassageHandler - добавляет сообщение сотрудника к заказу.
+// Если передан templateID, то текстом сообщения становится заполненный шаблон.
 func addAdminMeassageHandler(w http.ResponseWriter, r *http.Request) {
-	text := r.FormValue("text")
-	orderID := r.FormValue("orderID")
-	if text == "" || orderID == "" {
+	if templateID := r.FormValue("templateID"); templateID != "" {
+		text := renderMessageTemplate(w, templateID, r.FormValue("orderID"))
+		if text == "" {
+			return
+		}
+		r.Form.Set("text", text)
+	}
+
+	message := getAndCheckMessage(w, r)
+	if message == nil {
 		return
 	}
+	defer closeAttachments(message.Attachments)
 
-	_, err := db.Exec("INSERT INTO messages(isadmin, date, text, orderid) VALUES(TRUE, $1, $2, $3)", time.Now(), text, orderID)
+	code, err := saveStaffMessage(message)
 	if err != nil {
-		log.Printf("Ошибка. При добавлении сообщения админа к заказу(ид заказа =  %s ): %s\n", orderID, err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		log.Printf("Ошибка. При добавлении сообщения админа к заказу(ид заказа =  %s ): %s\n", message.OrderID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return
 	}
-	db.Exec("UPDATE orders SET newmsgforuser=TRUE WHERE id=$1", orderID)
+	if code != "" {
+		writeError(w, http.StatusBadRequest, code)
+	}
+}
+
+// saveStaffMessage - сохраняет сообщение сотрудника, рассылает событие и уведомления участникам заказа.
+// Сообщение должно быть уже проверено ValidateMessage.
+// Возвращает код ошибки для сотрудника, если заказа нет.
+func saveStaffMessage(message *Message) (string, error) {
+	message.IsAdmin = true
+	orderID := message.OrderID
+
+	var status int
+	err := db.QueryRow("SELECT status FROM orders WHERE id = $1", orderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		log.Println("Инфо. Попытка добавить сообщение сотрудника к несуществующему заказу(ид = " + orderID + ")")
+		return CodeOrderNotFound, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = insertMessage(message, "")
+	if err != nil {
+		return "", err
+	}
+
+	publishOrderEvent(&OrderEvent{Type: EventMessage, OrderID: orderID, Status: status, Message: message})
+
+	text := newLocalizedText(NotifyMessageText, message.Text)
+	if message.Text == "" {
+		text = newLocalizedText(NotifyAttachmentText)
+	}
+	notifyOrderParticipants(orderID, newLocalizedText(NotifyMessageSubject, orderID), text)
+
+	return "", nil
+}
+
+// insertMessage - сохраняет сообщение и его вложения в одной транзакции, чтобы в заказе не появилось
+// сообщение без части вложений. Если readerID не пустой, то этот пользователь прочитал заказ до нового сообщения.
+// Если сохранить не удалось, то уже записанные в хранилище файлы вложений удаляются.
+func insertMessage(message *Message, readerID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("INSERT INTO messages(isadmin, date, text, orderid) VALUES($1, $2, $3, $4) RETURNING id",
+		message.IsAdmin, message.Date, message.Text, message.OrderID).Scan(&message.ID)
+	if err == nil && readerID != "" {
+		err = markMessagesRead(tx, message.OrderID, readerID, message.ID)
+	}
+	if err == nil {
+		err = saveAttachments(tx, message)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		removeAttachmentFiles(message.Attachments)
+		message.ID = ""
+		return err
+	}
+
+	return nil
 }
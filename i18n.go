@@ -0,0 +1,736 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	LangRU string = "ru" // Русский
+	LangEN string = "en" // Английский
+	LangKK string = "kk" // Казахский
+)
+
+// defaultLanguage - язык, если клиент не указал поддерживаемый язык.
+const defaultLanguage = LangRU
+
+// supportedLanguages - языки, на которые переведены тексты ответов.
+var supportedLanguages = []string{LangRU, LangEN, LangKK}
+
+// languageAliases - распространенные неправильные коды языков, которые присылают клиенты.
+var languageAliases = map[string]string{
+	"kz": LangKK,
+}
+
+// Коды текстов успешных ответов.
+const (
+	MsgRegistered       = "registered"
+	MsgAuthorized       = "authorized"
+	MsgLoggedOut        = "logged_out"
+	MsgCarAdded         = "car_added"
+	MsgCarRemoved       = "car_removed"
+	MsgCarUnchanged     = "car_unchanged"
+	MsgCarUpdated       = "car_updated"
+	MsgOrderAdded       = "order_added"
+	MsgMileageSaved     = "mileage_saved"
+	MsgOrderRescheduled = "order_rescheduled"
+	MsgOrderCancelled   = "order_cancelled"
+	MsgAssigneeSaved    = "assignee_saved"
+	MsgTransferSent     = "transfer_sent"
+	MsgTransferAccepted = "transfer_accepted"
+	MsgTransferDeclined = "transfer_declined"
+	MsgTemplateSaved    = "template_saved"
+	MsgTemplateRemoved  = "template_removed"
+	MsgPreferenceSaved  = "notification_preference_saved"
+	MsgOrgCreated       = "organisation_created"
+	MsgMemberAdded      = "member_added"
+	MsgMemberRemoved    = "member_removed"
+	MsgTelegramUnlinked = "telegram_unlinked"
+	MsgLanguageSaved    = "language_saved"
+)
+
+// Коды текстов уведомлений, ответов telegram бота, календаря и pdf с историей обслуживания.
+const (
+	NotifyMessageSubject     = "notify_message_subject"
+	NotifyMessageText        = "notify_message_text"
+	NotifyAttachmentText     = "notify_attachment_text"
+	NotifyConfirmedSubject   = "notify_confirmed_subject"
+	NotifyConfirmedText      = "notify_confirmed_text"
+	NotifyClosedSubject      = "notify_closed_subject"
+	NotifyClosedText         = "notify_closed_text"
+	NotifyCancelledSubject   = "notify_cancelled_subject"
+	NotifyCancelledText      = "notify_cancelled_text"
+	NotifyRescheduledSubject = "notify_rescheduled_subject"
+	NotifyRescheduledText    = "notify_rescheduled_text"
+	NotifyReminderSubject    = "notify_reminder_subject"
+	NotifyReminderText       = "notify_reminder_text"
+	NotifyAppointmentSubject = "notify_appointment_subject"
+	NotifyAppointmentText    = "notify_appointment_text"
+	NotifyReplyHint          = "notify_reply_hint"
+	BotStartHelp             = "bot_start_help"
+	BotLinkInvalid           = "bot_link_invalid"
+	BotLinked                = "bot_linked"
+	BotUnlinked              = "bot_unlinked"
+	BotOrderUnknown          = "bot_order_unknown"
+	BotMessageAdded          = "bot_message_added"
+	BotHelp                  = "bot_help"
+	CalendarSummary          = "calendar_summary"
+	CalendarDescription      = "calendar_description"
+	PDFTitle                 = "pdf_title"
+	PDFOrder                 = "pdf_order"
+	PDFOrderMileage          = "pdf_order_mileage"
+	PDFOrderItem             = "pdf_order_item"
+	PDFReadings              = "pdf_readings"
+	PDFReading               = "pdf_reading"
+	PDFNotes                 = "pdf_notes"
+)
+
+// Коды названий регионов производства по VIN и регламентов обслуживания из начальных данных БД.
+const (
+	RegionAfrica        = "vin_region_africa"
+	RegionAsia          = "vin_region_asia"
+	RegionEurope        = "vin_region_europe"
+	RegionNorthAmerica  = "vin_region_north_america"
+	RegionOceania       = "vin_region_oceania"
+	RegionSouthAmerica  = "vin_region_south_america"
+	ScheduleOilChange   = "schedule_oil_change"
+	ScheduleAirFilter   = "schedule_air_filter"
+	ScheduleCabinFilter = "schedule_cabin_filter"
+	ScheduleBrakeFluid  = "schedule_brake_fluid"
+	ScheduleSparkPlugs  = "schedule_spark_plugs"
+	ScheduleCoolant     = "schedule_coolant"
+)
+
+// catalogue - тексты ответов по языкам и кодам. Текст может содержать подстановки fmt.
+// Если перевода нет, то используется текст на языке по умолчанию.
+var catalogue = map[string]map[string]string{
+	LangRU: {
+		CodeInternal:          "Неполадки на сервере, повторите попытку позже.",
+		CodeValidation:        "Ошибка. Данные не прошли проверку.",
+		CodeNotFound:          "Ресурс не найден.",
+		CodeMethodNotAllowed:  "Метод %s не поддерживается для %s.",
+		CodeInvalidBody:       "Ошибка. Некорректное тело запроса: %s",
+		CodeBodyTooLarge:      "Ошибка. Размер запроса превышает %d МБ.",
+		CodeUnauthorized:      "Для начала работы необходимо авторизоваться.",
+		CodeTokenExpired:      "Устаревший токен авторизации.",
+		CodeForbidden:         "Недостаточно прав.",
+		CodeClientCert:        "Служебные функции доступны только с терминала сотрудника с сертификатом.",
+		CodeOrgForbidden:      "Недостаточно прав в организации.",
+		CodeUserExists:        "Пользователь с таким логином уже существует.",
+		CodeLoginNotFound:     "Пользователя с таким логином не существует.",
+		CodeUserNotFound:      "Запрашиваемого пользователя не существует.",
+		CodeWrongPassword:     "Неверный пароль.",
+		CodeNoProfileImage:    "У данного пользоватля нет аватарки.",
+		CodeLoginRequired:     "Логин не может быть пустой строкой.",
+		CodeLoginTooShort:     "Ошибка. Длина логина меньше %d символов.",
+		CodePasswordTooShort:  "Ошибка. Длина пароля меньше %d символов.",
+		CodeNameRequired:      "Ошибка. Поле имя не может быть пустым.",
+		CodeLastNameRequired:  "Ошибка. Поле фамилия не может быть пустым.",
+		CodeInvalidLanguage:   "Ошибка. Неподдерживаемый язык, доступны: %s.",
+		CodeInvalidOrderID:    "Ошибка. Неверный id заказа.",
+		CodeInvalidMessageID:  "Ошибка. Получен некорректный номер сообщения.",
+		CodeEmptyMessage:      "Ошибка. Пустой текст сообщения.",
+		CodeInvalidDate:       "Ошибка. Неверная дата.",
+		CodeCarRequired:       "Ошибка. Укажите машину.",
+		CodeInfoRequired:      "Ошибка. Укажите информацию по заказу.",
+		CodeInvalidMileage:    "Ошибка. Получен некорректный пробег.",
+		CodeMileageDecreased:  "Ошибка. Пробег не может быть меньше последнего показания (%d км).",
+		CodeOrderNotFound:     "Укажите верный номер заказа.",
+		CodeOrderUnavailable:  "Невозможно добавить сообщение к указанному заказу.",
+		CodeOrderClosed:       "Невозможно добавить сообщение к закрытому заказу.",
+		CodeOrderFinished:     "Заказ уже закрыт или отменен, перенести запись нельзя.",
+		CodeOrderReadOnly:     "Машина передана другому владельцу, заказ доступен только для чтения.",
+		CodeItemNameRequired:  "Ошибка. Необходимо указать наименование позиции.",
+		CodeItemNameTooLong:   "Ошибка. Наименование позиции не может быть длиннее %d символов.",
+		CodeInvalidQuantity:   "Ошибка. Получено некорректное количество.",
+		CodeInvalidCost:       "Ошибка. Получена некорректная стоимость.",
+		CodeInvalidScheduleID: "Ошибка. Неверный id регламента обслуживания.",
+		CodeBrandRequired:     "Ошибка. Необходимо указать марку машины.",
+		CodeBrandTooLong:      "Ошибка. Марка машины не может быть длиннее %d символов.",
+		CodeModelRequired:     "Ошибка. Необходимо указать модель машины.",
+		CodeModelTooLong:      "Ошибка. Модель машины не может быть длиннее %d символов.",
+		CodeInvalidVIN:        "Ошибка. Получен некорректный VIN код.",
+		CodeVINChars:          "Ошибка. VIN код может содержать только латинские буквы (кроме I, O, Q) и цифры.",
+		CodeVINChecksum:       "Ошибка. Неверная контрольная цифра VIN кода.",
+		CodeVINBrandMismatch:  "Ошибка. Марка машины не совпадает с производителем из VIN кода.",
+		CodeVINYearMismatch:   "Ошибка. Год выпуска не совпадает с модельным годом из VIN кода (%s).",
+		CodeInvalidYear:       "Ошибка. Получен некорректный год.",
+		CodePlateCountry:      "Ошибка. Неизвестная страна регистрации номерного знака.",
+		CodePlateFormat:       "Ошибка. Номерной знак не соответствует формату страны регистрации.",
+		CodeColorTooLong:      "Ошибка. Цвет машины не может быть длиннее %d символов.",
+		CodeEngineTooLong:     "Ошибка. Описание двигателя не может быть длиннее %d символов.",
+		CodeTransmission:      "Ошибка. Неизвестный тип коробки передач.",
+		CodeInvalidCarID:      "Ошибка. Неверный id машины.",
+		CodeCarNotFound:       "Укажите верную машину.",
+		CodeVINCarNotFound:    "У вас нет машины с таким VIN.",
+		CodeNoteRequired:      "Необходимо передать текст заметки.",
+		CodeNoteCarNotFound:   "Машины с таким VIN нет в сервисе.",
+		CodeAttachmentsRead:   "Ошибка. Не удалось прочитать вложения.",
+		CodeTooManyFiles:      "Ошибка. К сообщению можно приложить не более %d файлов.",
+		CodeAttachmentSize:    "Ошибка. Размер вложения %q превышает %d МБ.",
+		CodeAttachmentType:    "Ошибка. Недопустимый тип вложения %q.",
+		CodeAttachmentMissing: "Вложение не найдено.",
+		CodeNoThumbnail:       "У вложения нет миниатюры.",
+		CodeInvalidTemplateID: "Ошибка. Неверный id шаблона.",
+		CodeTemplateNotFound:  "Шаблон не найден.",
+		CodeTemplateName:      "Ошибка. Название шаблона не может быть пустым или длиннее %d символов.",
+		CodeTemplateText:      "Ошибка. Пустой текст шаблона.",
+		CodePlaceholder:       "Ошибка. Неизвестная подстановка в шаблоне: %s. Доступны: %s",
+		CodeInvalidStatus:     "Ошибка. Получен некорректный статус заказа.",
+		CodeInvalidTransition: "Заказ нельзя перевести в этот статус из текущего.",
+		CodeInvalidAssignee:   "Ошибка. Получен некорректный ид ответственного сотрудника.",
+		CodeAssigneeNotStaff:  "Ответственным можно назначить только сотрудника сервиса.",
+		CodeOrgName:           "Ошибка. Название организации не может быть пустым или длиннее %d символов.",
+		CodeOrgRole:           "Ошибка. Неизвестная роль участника организации.",
+		CodeInvalidOrgID:      "Ошибка. Неверный id организации.",
+		CodeInvalidUserID:     "Ошибка. Неверный id пользователя.",
+		CodeRemoveSelf:        "Нельзя удалить самого себя из организации.",
+		CodeTransferNotFound:  "Запрос на передачу машины не найден или уже недействителен.",
+		CodeTransferOwnOnly:   "Передать можно только свою личную машину.",
+		CodeTransferToSelf:    "Нельзя передать машину самому себе.",
+		CodeTransferPending:   "Машина уже ожидает ответа на другой запрос передачи, сначала отмените его.",
+		CodeInvalidTransferID: "Ошибка. Неверный id передачи машины.",
+		CodeUnknownChannel:    "Ошибка. Неизвестный канал уведомлений.",
+		CodeChannelDisabled:   "Этот канал уведомлений сейчас недоступен.",
+		CodeAddressTooLong:    "Ошибка. Адрес доставки уведомлений длиннее %d символов.",
+		CodeInvalidEmail:      "Ошибка. Некорректный адрес электронной почты.",
+		CodeInvalidWebhook:    "Ошибка. Адрес вебхука должен быть http или https ссылкой на внешний сервер.",
+		CodeTelegramViaBot:    "Ошибка. Telegram подключается через бота, получите код привязки в настройках.",
+		CodeTelegramDisabled:  "Telegram бот сейчас недоступен.",
+		CodeCalendarNotFound:  "Календарь не найден.",
+
+		MsgRegistered:       "Регистрация успешно выполнена.",
+		MsgAuthorized:       "Авторизация успешно выполнена.",
+		MsgLoggedOut:        "Выход из системы успешно выполнен.",
+		MsgCarAdded:         "Машина успешно добавлена.",
+		MsgCarRemoved:       "Машина успешно удалена из системы.",
+		MsgCarUnchanged:     "Данные машины не изменились.",
+		MsgCarUpdated:       "Данные машины успешно изменены.",
+		MsgOrderAdded:       "Заказ успешно добавлен.",
+		MsgMileageSaved:     "Пробег успешно сохранен.",
+		MsgOrderRescheduled: "Запись перенесена.",
+		MsgOrderCancelled:   "Заказ отменен.",
+		MsgAssigneeSaved:    "Ответственный за заказ сохранен.",
+		MsgTransferSent:     "Запрос на передачу машины отправлен.",
+		MsgTransferAccepted: "Машина успешно передана в ваш аккаунт.",
+		MsgTransferDeclined: "Передача машины отклонена.",
+		MsgTemplateSaved:    "Шаблон успешно сохранен.",
+		MsgTemplateRemoved:  "Шаблон успешно удален.",
+		MsgPreferenceSaved:  "Настройка уведомлений сохранена.",
+		MsgOrgCreated:       "Организация успешно создана.",
+		MsgMemberAdded:      "Участник успешно добавлен в организацию.",
+		MsgMemberRemoved:    "Участник успешно удален из организации.",
+		MsgTelegramUnlinked: "Telegram отвязан.",
+		MsgLanguageSaved:    "Язык успешно сохранен.",
+
+		NotifyMessageSubject:     "Новое сообщение по заказу №%s",
+		NotifyMessageText:        "%s",
+		NotifyAttachmentText:     "Сотрудник сервиса прислал вложение.",
+		NotifyConfirmedSubject:   "Заказ №%s подтвержден",
+		NotifyConfirmedText:      "Сервис подтвердил заказ №%s и принял его в работу.",
+		NotifyClosedSubject:      "Заказ №%s закрыт",
+		NotifyClosedText:         "Работы по заказу №%s завершены, заказ закрыт.",
+		NotifyCancelledSubject:   "Заказ №%s отменен",
+		NotifyCancelledText:      "Заказ №%s отменен, запись на обслуживание снята.",
+		NotifyRescheduledSubject: "Запись по заказу №%s перенесена",
+		NotifyRescheduledText:    "Запись на обслуживание по заказу №%s перенесена на %s.",
+		NotifyReminderSubject:    "Напоминание об обслуживании",
+		NotifyReminderText:       "Пора пройти обслуживание \"%s\" для %s %s(%s).",
+		NotifyAppointmentSubject: "Запись на обслуживание",
+		NotifyAppointmentText:    "Напоминаем, что %s ваш автомобиль %s записан на обслуживание (заказ №%s).",
+		NotifyReplyHint:          "Чтобы ответить по заказу, ответьте на это сообщение.",
+		BotStartHelp:             "Чтобы получать уведомления о заказах, получите код привязки в настройках профиля и отправьте боту команду /start <код>.",
+		BotLinkInvalid:           "Код привязки неверный или устарел, получите новый в настройках профиля.",
+		BotLinked:                "Аккаунт привязан. Сюда будут приходить сообщения сотрудников и изменения статусов ваших заказов.",
+		BotUnlinked:              "Уведомления отключены. Чтобы снова их получать, привяжите аккаунт заново.",
+		BotOrderUnknown:          "Не удалось определить заказ. Ответьте на сообщение бота о нужном заказе.",
+		BotMessageAdded:          "Сообщение добавлено к заказу №%s.",
+		BotHelp:                  "Чтобы написать по заказу, ответьте на сообщение бота об этом заказе. Отключить уведомления - /stop.",
+		CalendarSummary:          "Обслуживание %s",
+		CalendarDescription:      "Заказ №%s. %s",
+		PDFTitle:                 "История обслуживания автомобиля",
+		PDFOrder:                 "Заказ №%s от %s",
+		PDFOrderMileage:          ", пробег %s км",
+		PDFOrderItem:             "  - %s x%s: %s руб.",
+		PDFReadings:              "Показания одометра",
+		PDFReading:               "%s: %d км",
+		PDFNotes:                 "Заметки сервиса",
+		RegionAfrica:             "Африка",
+		RegionAsia:               "Азия",
+		RegionEurope:             "Европа",
+		RegionNorthAmerica:       "Северная Америка",
+		RegionOceania:            "Океания",
+		RegionSouthAmerica:       "Южная Америка",
+		ScheduleOilChange:        "Замена моторного масла и масляного фильтра",
+		ScheduleAirFilter:        "Замена воздушного фильтра",
+		ScheduleCabinFilter:      "Замена салонного фильтра",
+		ScheduleBrakeFluid:       "Замена тормозной жидкости",
+		ScheduleSparkPlugs:       "Замена свечей зажигания",
+		ScheduleCoolant:          "Замена охлаждающей жидкости",
+	},
+	LangEN: {
+		CodeInternal:          "Server error, please try again later.",
+		CodeValidation:        "Error. The data did not pass validation.",
+		CodeNotFound:          "Resource not found.",
+		CodeMethodNotAllowed:  "Method %s is not supported for %s.",
+		CodeInvalidBody:       "Error. Invalid request body: %s",
+		CodeBodyTooLarge:      "Error. The request is larger than %d MB.",
+		CodeUnauthorized:      "Please sign in to continue.",
+		CodeTokenExpired:      "The authorisation token has expired.",
+		CodeForbidden:         "Insufficient permissions.",
+		CodeClientCert:        "Staff functions are only available from a staff terminal with a client certificate.",
+		CodeOrgForbidden:      "Insufficient permissions in the organisation.",
+		CodeUserExists:        "A user with this login already exists.",
+		CodeLoginNotFound:     "There is no user with this login.",
+		CodeUserNotFound:      "The requested user does not exist.",
+		CodeWrongPassword:     "Wrong password.",
+		CodeNoProfileImage:    "This user has no profile picture.",
+		CodeLoginRequired:     "Login must not be empty.",
+		CodeLoginTooShort:     "Error. Login is shorter than %d characters.",
+		CodePasswordTooShort:  "Error. Password is shorter than %d characters.",
+		CodeNameRequired:      "Error. First name must not be empty.",
+		CodeLastNameRequired:  "Error. Last name must not be empty.",
+		CodeInvalidLanguage:   "Error. Unsupported language, available: %s.",
+		CodeInvalidOrderID:    "Error. Invalid order id.",
+		CodeInvalidMessageID:  "Error. Invalid message id.",
+		CodeEmptyMessage:      "Error. The message text is empty.",
+		CodeInvalidDate:       "Error. Invalid date.",
+		CodeCarRequired:       "Error. Please select a car.",
+		CodeInfoRequired:      "Error. Please describe the order.",
+		CodeInvalidMileage:    "Error. Invalid mileage.",
+		CodeMileageDecreased:  "Error. Mileage cannot be lower than the last reading (%d km).",
+		CodeOrderNotFound:     "Please specify a valid order number.",
+		CodeOrderUnavailable:  "Cannot add a message to this order.",
+		CodeOrderClosed:       "Cannot add a message to a closed order.",
+		CodeOrderFinished:     "The order is already closed or cancelled, the appointment cannot be moved.",
+		CodeOrderReadOnly:     "The car has been transferred to another owner, the order is read-only.",
+		CodeItemNameRequired:  "Error. Please specify the item name.",
+		CodeItemNameTooLong:   "Error. The item name cannot be longer than %d characters.",
+		CodeInvalidQuantity:   "Error. Invalid quantity.",
+		CodeInvalidCost:       "Error. Invalid cost.",
+		CodeInvalidScheduleID: "Error. Invalid maintenance schedule id.",
+		CodeBrandRequired:     "Error. Please specify the car make.",
+		CodeBrandTooLong:      "Error. The car make cannot be longer than %d characters.",
+		CodeModelRequired:     "Error. Please specify the car model.",
+		CodeModelTooLong:      "Error. The car model cannot be longer than %d characters.",
+		CodeInvalidVIN:        "Error. Invalid VIN.",
+		CodeVINChars:          "Error. A VIN may only contain Latin letters (except I, O, Q) and digits.",
+		CodeVINChecksum:       "Error. Invalid VIN check digit.",
+		CodeVINBrandMismatch:  "Error. The car make does not match the manufacturer in the VIN.",
+		CodeVINYearMismatch:   "Error. The year does not match the model year in the VIN (%s).",
+		CodeInvalidYear:       "Error. Invalid year.",
+		CodePlateCountry:      "Error. Unknown licence plate country.",
+		CodePlateFormat:       "Error. The licence plate does not match the country's format.",
+		CodeColorTooLong:      "Error. The colour cannot be longer than %d characters.",
+		CodeEngineTooLong:     "Error. The engine description cannot be longer than %d characters.",
+		CodeTransmission:      "Error. Unknown transmission type.",
+		CodeInvalidCarID:      "Error. Invalid car id.",
+		CodeCarNotFound:       "Please specify a valid car.",
+		CodeVINCarNotFound:    "You have no car with this VIN.",
+		CodeNoteRequired:      "Please pass the note text.",
+		CodeNoteCarNotFound:   "There is no car with this VIN in the service.",
+		CodeAttachmentsRead:   "Error. Could not read the attachments.",
+		CodeTooManyFiles:      "Error. A message can have at most %d attachments.",
+		CodeAttachmentSize:    "Error. Attachment %q is larger than %d MB.",
+		CodeAttachmentType:    "Error. Attachment %q has an unsupported type.",
+		CodeAttachmentMissing: "Attachment not found.",
+		CodeNoThumbnail:       "This attachment has no thumbnail.",
+		CodeInvalidTemplateID: "Error. Invalid template id.",
+		CodeTemplateNotFound:  "Template not found.",
+		CodeTemplateName:      "Error. The template name must not be empty or longer than %d characters.",
+		CodeTemplateText:      "Error. The template text is empty.",
+		CodePlaceholder:       "Error. Unknown placeholder in the template: %s. Available: %s",
+		CodeInvalidStatus:     "Error. Invalid order status.",
+		CodeInvalidTransition: "The order cannot be moved to this status from its current one.",
+		CodeInvalidAssignee:   "Error. Invalid assignee id.",
+		CodeAssigneeNotStaff:  "Only service staff can be assigned.",
+		CodeOrgName:           "Error. The organisation name must not be empty or longer than %d characters.",
+		CodeOrgRole:           "Error. Unknown organisation member role.",
+		CodeInvalidOrgID:      "Error. Invalid organisation id.",
+		CodeInvalidUserID:     "Error. Invalid user id.",
+		CodeRemoveSelf:        "You cannot remove yourself from the organisation.",
+		CodeTransferNotFound:  "The car transfer request was not found or is no longer valid.",
+		CodeTransferOwnOnly:   "You can only transfer your own personal car.",
+		CodeTransferToSelf:    "You cannot transfer a car to yourself.",
+		CodeTransferPending:   "The car already has a pending transfer, cancel it first.",
+		CodeInvalidTransferID: "Error. Invalid car transfer id.",
+		CodeUnknownChannel:    "Error. Unknown notification channel.",
+		CodeChannelDisabled:   "This notification channel is currently unavailable.",
+		CodeAddressTooLong:    "Error. The delivery address is longer than %d characters.",
+		CodeInvalidEmail:      "Error. Invalid email address.",
+		CodeInvalidWebhook:    "Error. The webhook address must be an http or https URL of a public server.",
+		CodeTelegramViaBot:    "Error. Telegram is linked through the bot, get a link code in your settings.",
+		CodeTelegramDisabled:  "The Telegram bot is currently unavailable.",
+		CodeCalendarNotFound:  "Calendar not found.",
+
+		MsgRegistered:       "Registration completed successfully.",
+		MsgAuthorized:       "Signed in successfully.",
+		MsgLoggedOut:        "Signed out successfully.",
+		MsgCarAdded:         "Car added successfully.",
+		MsgCarRemoved:       "Car removed successfully.",
+		MsgCarUnchanged:     "The car details have not changed.",
+		MsgCarUpdated:       "Car details updated successfully.",
+		MsgOrderAdded:       "Order created successfully.",
+		MsgMileageSaved:     "Mileage saved successfully.",
+		MsgOrderRescheduled: "The appointment has been moved.",
+		MsgOrderCancelled:   "The order has been cancelled.",
+		MsgAssigneeSaved:    "The order assignee has been saved.",
+		MsgTransferSent:     "Car transfer request sent.",
+		MsgTransferAccepted: "The car has been transferred to your account.",
+		MsgTransferDeclined: "Car transfer declined.",
+		MsgTemplateSaved:    "Template saved successfully.",
+		MsgTemplateRemoved:  "Template deleted successfully.",
+		MsgPreferenceSaved:  "Notification settings saved.",
+		MsgOrgCreated:       "Organisation created successfully.",
+		MsgMemberAdded:      "Member added to the organisation.",
+		MsgMemberRemoved:    "Member removed from the organisation.",
+		MsgTelegramUnlinked: "Telegram unlinked.",
+		MsgLanguageSaved:    "Language saved successfully.",
+
+		NotifyMessageSubject:     "New message on order #%s",
+		NotifyMessageText:        "%s",
+		NotifyAttachmentText:     "Service staff sent an attachment.",
+		NotifyConfirmedSubject:   "Order #%s confirmed",
+		NotifyConfirmedText:      "The service has confirmed order #%s and started work on it.",
+		NotifyClosedSubject:      "Order #%s closed",
+		NotifyClosedText:         "Work on order #%s is complete and the order is closed.",
+		NotifyCancelledSubject:   "Order #%s cancelled",
+		NotifyCancelledText:      "Order #%s has been cancelled and the service appointment removed.",
+		NotifyRescheduledSubject: "Appointment for order #%s moved",
+		NotifyRescheduledText:    "The service appointment for order #%s has been moved to %s.",
+		NotifyReminderSubject:    "Maintenance reminder",
+		NotifyReminderText:       "It is time for \"%s\" maintenance on your %s %s (%s).",
+		NotifyAppointmentSubject: "Service appointment",
+		NotifyAppointmentText:    "Reminder: on %s your %s is booked for service (order #%s).",
+		NotifyReplyHint:          "To reply about this order, reply to this message.",
+		BotStartHelp:             "To receive order notifications, get a link code in your profile settings and send the bot /start <code>.",
+		BotLinkInvalid:           "The link code is invalid or expired, get a new one in your profile settings.",
+		BotLinked:                "Account linked. Staff messages and order status changes will arrive here.",
+		BotUnlinked:              "Notifications are off. Link your account again to receive them.",
+		BotOrderUnknown:          "Could not determine the order. Reply to the bot's message about that order.",
+		BotMessageAdded:          "Message added to order #%s.",
+		BotHelp:                  "To write about an order, reply to the bot's message about it. To turn off notifications, send /stop.",
+		CalendarSummary:          "Car service: %s",
+		CalendarDescription:      "Order #%s. %s",
+		PDFTitle:                 "Vehicle service history",
+		PDFOrder:                 "Order #%s of %s",
+		PDFOrderMileage:          ", mileage %s km",
+		PDFOrderItem:             "  - %s x%s: %s RUB",
+		PDFReadings:              "Odometer readings",
+		PDFReading:               "%s: %d km",
+		PDFNotes:                 "Service notes",
+		RegionAfrica:             "Africa",
+		RegionAsia:               "Asia",
+		RegionEurope:             "Europe",
+		RegionNorthAmerica:       "North America",
+		RegionOceania:            "Oceania",
+		RegionSouthAmerica:       "South America",
+		ScheduleOilChange:        "Engine oil and oil filter replacement",
+		ScheduleAirFilter:        "Air filter replacement",
+		ScheduleCabinFilter:      "Cabin filter replacement",
+		ScheduleBrakeFluid:       "Brake fluid replacement",
+		ScheduleSparkPlugs:       "Spark plug replacement",
+		ScheduleCoolant:          "Coolant replacement",
+	},
+	LangKK: {
+		CodeInternal:          "Серверде ақау, кейінірек қайталап көріңіз.",
+		CodeValidation:        "Қате. Деректер тексеруден өтпеді.",
+		CodeNotFound:          "Ресурс табылмады.",
+		CodeMethodNotAllowed:  "%s әдісі %s үшін қолданылмайды.",
+		CodeInvalidBody:       "Қате. Сұраныс денесі дұрыс емес: %s",
+		CodeBodyTooLarge:      "Қате. Сұраныс көлемі %d МБ-тан асады.",
+		CodeUnauthorized:      "Жұмысты бастау үшін жүйеге кіріңіз.",
+		CodeTokenExpired:      "Авторизация токенінің мерзімі өтіп кеткен.",
+		CodeForbidden:         "Құқықтар жеткіліксіз.",
+		CodeClientCert:        "Қызметтік функциялар тек сертификаты бар қызметкер терминалынан қолжетімді.",
+		CodeOrgForbidden:      "Ұйымдағы құқықтар жеткіліксіз.",
+		CodeUserExists:        "Мұндай логині бар пайдаланушы бұрыннан бар.",
+		CodeLoginNotFound:     "Мұндай логині бар пайдаланушы жоқ.",
+		CodeUserNotFound:      "Сұралған пайдаланушы жоқ.",
+		CodeWrongPassword:     "Құпиясөз қате.",
+		CodeNoProfileImage:    "Бұл пайдаланушының аватары жоқ.",
+		CodeLoginRequired:     "Логин бос болмауы керек.",
+		CodeLoginTooShort:     "Қате. Логин %d таңбадан қысқа.",
+		CodePasswordTooShort:  "Қате. Құпиясөз %d таңбадан қысқа.",
+		CodeNameRequired:      "Қате. Аты өрісі бос болмауы керек.",
+		CodeLastNameRequired:  "Қате. Тегі өрісі бос болмауы керек.",
+		CodeInvalidLanguage:   "Қате. Бұл тіл қолданылмайды, қолжетімдісі: %s.",
+		CodeInvalidOrderID:    "Қате. Тапсырыс id дұрыс емес.",
+		CodeInvalidMessageID:  "Қате. Хабарлама нөмірі дұрыс емес.",
+		CodeEmptyMessage:      "Қате. Хабарлама мәтіні бос.",
+		CodeInvalidDate:       "Қате. Күні дұрыс емес.",
+		CodeCarRequired:       "Қате. Көлікті көрсетіңіз.",
+		CodeInfoRequired:      "Қате. Тапсырыс туралы ақпаратты көрсетіңіз.",
+		CodeInvalidMileage:    "Қате. Жүріс дұрыс емес.",
+		CodeMileageDecreased:  "Қате. Жүріс соңғы көрсеткіштен (%d км) аз болмауы керек.",
+		CodeOrderNotFound:     "Тапсырыстың дұрыс нөмірін көрсетіңіз.",
+		CodeOrderUnavailable:  "Бұл тапсырысқа хабарлама қосу мүмкін емес.",
+		CodeOrderClosed:       "Жабылған тапсырысқа хабарлама қосу мүмкін емес.",
+		CodeOrderFinished:     "Тапсырыс жабылған немесе бас тартылған, жазылуды ауыстыруға болмайды.",
+		CodeOrderReadOnly:     "Көлік басқа иесіне берілген, тапсырысты тек оқуға болады.",
+		CodeItemNameRequired:  "Қате. Позиция атауын көрсету қажет.",
+		CodeItemNameTooLong:   "Қате. Позиция атауы %d таңбадан ұзын болмауы керек.",
+		CodeInvalidQuantity:   "Қате. Саны дұрыс емес.",
+		CodeInvalidCost:       "Қате. Құны дұрыс емес.",
+		CodeInvalidScheduleID: "Қате. Қызмет көрсету регламентінің id дұрыс емес.",
+		CodeBrandRequired:     "Қате. Көлік маркасын көрсету қажет.",
+		CodeBrandTooLong:      "Қате. Көлік маркасы %d таңбадан ұзын болмауы керек.",
+		CodeModelRequired:     "Қате. Көлік моделін көрсету қажет.",
+		CodeModelTooLong:      "Қате. Көлік моделі %d таңбадан ұзын болмауы керек.",
+		CodeInvalidVIN:        "Қате. VIN коды дұрыс емес.",
+		CodeVINChars:          "Қате. VIN кодында тек латын әріптері (I, O, Q-дан басқа) мен цифрлар болуы мүмкін.",
+		CodeVINChecksum:       "Қате. VIN кодының бақылау цифры дұрыс емес.",
+		CodeVINBrandMismatch:  "Қате. Көлік маркасы VIN кодындағы өндірушімен сәйкес келмейді.",
+		CodeVINYearMismatch:   "Қате. Шығарылған жылы VIN кодындағы модельдік жылмен (%s) сәйкес келмейді.",
+		CodeInvalidYear:       "Қате. Жылы дұрыс емес.",
+		CodePlateCountry:      "Қате. Нөмір белгісін тіркеген ел белгісіз.",
+		CodePlateFormat:       "Қате. Нөмір белгісі тіркеген елдің форматына сәйкес келмейді.",
+		CodeColorTooLong:      "Қате. Көлік түсі %d таңбадан ұзын болмауы керек.",
+		CodeEngineTooLong:     "Қате. Қозғалтқыш сипаттамасы %d таңбадан ұзын болмауы керек.",
+		CodeTransmission:      "Қате. Беріліс қорабының түрі белгісіз.",
+		CodeInvalidCarID:      "Қате. Көлік id дұрыс емес.",
+		CodeCarNotFound:       "Дұрыс көлікті көрсетіңіз.",
+		CodeVINCarNotFound:    "Сізде мұндай VIN коды бар көлік жоқ.",
+		CodeNoteRequired:      "Жазба мәтінін беру қажет.",
+		CodeNoteCarNotFound:   "Сервисте мұндай VIN коды бар көлік жоқ.",
+		CodeAttachmentsRead:   "Қате. Тіркемелерді оқу мүмкін болмады.",
+		CodeTooManyFiles:      "Қате. Хабарламаға %d файлдан артық тіркеуге болмайды.",
+		CodeAttachmentSize:    "Қате. %q тіркемесінің көлемі %d МБ-тан асады.",
+		CodeAttachmentType:    "Қате. %q тіркемесінің түріне рұқсат жоқ.",
+		CodeAttachmentMissing: "Тіркеме табылмады.",
+		CodeNoThumbnail:       "Тіркеменің шағын суреті жоқ.",
+		CodeInvalidTemplateID: "Қате. Үлгі id дұрыс емес.",
+		CodeTemplateNotFound:  "Үлгі табылмады.",
+		CodeTemplateName:      "Қате. Үлгі атауы бос немесе %d таңбадан ұзын болмауы керек.",
+		CodeTemplateText:      "Қате. Үлгі мәтіні бос.",
+		CodePlaceholder:       "Қате. Үлгіде белгісіз алмастыру: %s. Қолжетімдісі: %s",
+		CodeInvalidStatus:     "Қате. Тапсырыс мәртебесі дұрыс емес.",
+		CodeInvalidTransition: "Тапсырысты ағымдағы мәртебеден бұл мәртебеге ауыстыруға болмайды.",
+		CodeInvalidAssignee:   "Қате. Жауапты қызметкердің id дұрыс емес.",
+		CodeAssigneeNotStaff:  "Жауапты етіп тек сервис қызметкерін тағайындауға болады.",
+		CodeOrgName:           "Қате. Ұйым атауы бос немесе %d таңбадан ұзын болмауы керек.",
+		CodeOrgRole:           "Қате. Ұйым қатысушысының рөлі белгісіз.",
+		CodeInvalidOrgID:      "Қате. Ұйым id дұрыс емес.",
+		CodeInvalidUserID:     "Қате. Пайдаланушы id дұрыс емес.",
+		CodeRemoveSelf:        "Өзіңізді ұйымнан жоюға болмайды.",
+		CodeTransferNotFound:  "Көлікті беру туралы сұраныс табылмады немесе жарамсыз.",
+		CodeTransferOwnOnly:   "Тек өзіңіздің жеке көлігіңізді беруге болады.",
+		CodeTransferToSelf:    "Көлікті өзіңізге беруге болмайды.",
+		CodeTransferPending:   "Көлік басқа беру сұрауына жауап күтуде, алдымен оны болдырмаңыз.",
+		CodeInvalidTransferID: "Қате. Көлікті беру id дұрыс емес.",
+		CodeUnknownChannel:    "Қате. Хабарландыру арнасы белгісіз.",
+		CodeChannelDisabled:   "Бұл хабарландыру арнасы қазір қолжетімсіз.",
+		CodeAddressTooLong:    "Қате. Хабарландыру жеткізу мекенжайы %d таңбадан ұзын.",
+		CodeInvalidEmail:      "Қате. Электрондық пошта мекенжайы дұрыс емес.",
+		CodeInvalidWebhook:    "Қате. Вебхук мекенжайы сыртқы серверге http немесе https сілтемесі болуы керек.",
+		CodeTelegramViaBot:    "Қате. Telegram бот арқылы қосылады, баптаулардан байланыстыру кодын алыңыз.",
+		CodeTelegramDisabled:  "Telegram боты қазір қолжетімсіз.",
+		CodeCalendarNotFound:  "Күнтізбе табылмады.",
+
+		MsgRegistered:       "Тіркеу сәтті аяқталды.",
+		MsgAuthorized:       "Жүйеге сәтті кірдіңіз.",
+		MsgLoggedOut:        "Жүйеден сәтті шықтыңыз.",
+		MsgCarAdded:         "Көлік сәтті қосылды.",
+		MsgCarRemoved:       "Көлік жүйеден сәтті жойылды.",
+		MsgCarUnchanged:     "Көлік деректері өзгерген жоқ.",
+		MsgCarUpdated:       "Көлік деректері сәтті өзгертілді.",
+		MsgOrderAdded:       "Тапсырыс сәтті қосылды.",
+		MsgMileageSaved:     "Жүріс сәтті сақталды.",
+		MsgOrderRescheduled: "Жазылу ауыстырылды.",
+		MsgOrderCancelled:   "Тапсырыстан бас тартылды.",
+		MsgAssigneeSaved:    "Тапсырысқа жауапты қызметкер сақталды.",
+		MsgTransferSent:     "Көлікті беру туралы сұраныс жіберілді.",
+		MsgTransferAccepted: "Көлік сіздің аккаунтыңызға сәтті берілді.",
+		MsgTransferDeclined: "Көлікті беру қабылданбады.",
+		MsgTemplateSaved:    "Үлгі сәтті сақталды.",
+		MsgTemplateRemoved:  "Үлгі сәтті жойылды.",
+		MsgPreferenceSaved:  "Хабарландыру баптаулары сақталды.",
+		MsgOrgCreated:       "Ұйым сәтті құрылды.",
+		MsgMemberAdded:      "Қатысушы ұйымға сәтті қосылды.",
+		MsgMemberRemoved:    "Қатысушы ұйымнан сәтті жойылды.",
+		MsgTelegramUnlinked: "Telegram ажыратылды.",
+		MsgLanguageSaved:    "Тіл сәтті сақталды.",
+
+		NotifyMessageSubject:     "№%s тапсырыс бойынша жаңа хабарлама",
+		NotifyMessageText:        "%s",
+		NotifyAttachmentText:     "Сервис қызметкері тіркеме жіберді.",
+		NotifyConfirmedSubject:   "№%s тапсырыс расталды",
+		NotifyConfirmedText:      "Сервис №%s тапсырысты растап, жұмысқа алды.",
+		NotifyClosedSubject:      "№%s тапсырыс жабылды",
+		NotifyClosedText:         "№%s тапсырыс бойынша жұмыстар аяқталды, тапсырыс жабылды.",
+		NotifyCancelledSubject:   "№%s тапсырыстан бас тартылды",
+		NotifyCancelledText:      "№%s тапсырыстан бас тартылды, қызмет көрсетуге жазылу алынып тасталды.",
+		NotifyRescheduledSubject: "№%s тапсырыс бойынша жазылу ауыстырылды",
+		NotifyRescheduledText:    "№%s тапсырыс бойынша қызмет көрсетуге жазылу %s күніне ауыстырылды.",
+		NotifyReminderSubject:    "Қызмет көрсету туралы еске салу",
+		NotifyReminderText:       "%[2]s %[3]s(%[4]s) көлігіне \"%[1]s\" қызмет көрсетуден өту уақыты келді.",
+		NotifyAppointmentSubject: "Қызмет көрсетуге жазылу",
+		NotifyAppointmentText:    "Еске саламыз: %s күні сіздің %s көлігіңіз қызмет көрсетуге жазылған (№%s тапсырыс).",
+		NotifyReplyHint:          "Тапсырыс бойынша жауап беру үшін осы хабарламаға жауап беріңіз.",
+		BotStartHelp:             "Тапсырыстар туралы хабарландыру алу үшін профиль баптауларынан байланыстыру кодын алып, ботқа /start <код> командасын жіберіңіз.",
+		BotLinkInvalid:           "Байланыстыру коды қате немесе ескірген, профиль баптауларынан жаңасын алыңыз.",
+		BotLinked:                "Аккаунт байланыстырылды. Қызметкерлердің хабарламалары мен тапсырыс мәртебесінің өзгерістері осында келеді.",
+		BotUnlinked:              "Хабарландырулар өшірілді. Оларды қайта алу үшін аккаунтты қайта байланыстырыңыз.",
+		BotOrderUnknown:          "Тапсырысты анықтау мүмкін болмады. Қажетті тапсырыс туралы бот хабарламасына жауап беріңіз.",
+		BotMessageAdded:          "Хабарлама №%s тапсырысқа қосылды.",
+		BotHelp:                  "Тапсырыс бойынша жазу үшін бот хабарламасына жауап беріңіз. Хабарландыруларды өшіру - /stop.",
+		CalendarSummary:          "Қызмет көрсету: %s",
+		CalendarDescription:      "№%s тапсырыс. %s",
+		PDFTitle:                 "Автокөліктің қызмет көрсету тарихы",
+		PDFOrder:                 "№%s тапсырыс, %s",
+		PDFOrderMileage:          ", жүрісі %s км",
+		PDFOrderItem:             "  - %s x%s: %s рубль",
+		PDFReadings:              "Одометр көрсеткіштері",
+		PDFReading:               "%s: %d км",
+		PDFNotes:                 "Сервис жазбалары",
+		RegionAfrica:             "Африка",
+		RegionAsia:               "Азия",
+		RegionEurope:             "Еуропа",
+		RegionNorthAmerica:       "Солтүстік Америка",
+		RegionOceania:            "Океания",
+		RegionSouthAmerica:       "Оңтүстік Америка",
+		ScheduleOilChange:        "Қозғалтқыш майын және май сүзгісін ауыстыру",
+		ScheduleAirFilter:        "Ауа сүзгісін ауыстыру",
+		ScheduleCabinFilter:      "Салон сүзгісін ауыстыру",
+		ScheduleBrakeFluid:       "Тежегіш сұйықтығын ауыстыру",
+		ScheduleSparkPlugs:       "Оталдыру шамдарын ауыстыру",
+		ScheduleCoolant:          "Салқындату сұйықтығын ауыстыру",
+	},
+}
+
+// localize - текст по коду на указанном языке. Если перевода нет, то на языке по умолчанию,
+// а если нет и его, то сам код.
+func localize(lang string, code string, args ...interface{}) string {
+	message, ok := catalogue[lang][code]
+	if !ok {
+		message, ok = catalogue[defaultLanguage][code]
+	}
+	if !ok {
+		return code
+	}
+	if len(args) == 0 {
+		return message
+	}
+
+	return fmt.Sprintf(message, args...)
+}
+
+// supportedLanguage - возвращает поддерживаемый код языка для тега вида "en-US",
+// или пустую строку, если язык не поддерживается.
+func supportedLanguage(tag string) string {
+	lang := strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(lang, "-_"); i != -1 {
+		lang = lang[:i]
+	}
+	if alias, ok := languageAliases[lang]; ok {
+		lang = alias
+	}
+	if _, ok := catalogue[lang]; !ok {
+		return ""
+	}
+
+	return lang
+}
+
+// negotiateLanguage - выбирает поддерживаемый язык с наибольшим весом из заголовка Accept-Language.
+func negotiateLanguage(acceptLanguage string) string {
+	type candidate struct {
+		lang    string
+		quality float64
+	}
+
+	candidates := make([]candidate, 0)
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		lang := supportedLanguage(fields[0])
+		if lang == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = value
+				}
+			}
+		}
+		if quality > 0 {
+			candidates = append(candidates, candidate{lang, quality})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return defaultLanguage
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].quality > candidates[j].quality })
+	return candidates[0].lang
+}
+
+// responseLanguage - язык ответа, выбранный для запроса.
+func responseLanguage(w http.ResponseWriter) string {
+	if lang := w.Header().Get("Content-Language"); lang != "" {
+		return lang
+	}
+
+	return defaultLanguage
+}
+
+// withLanguage - выбирает язык ответа по заголовку Accept-Language и сохраняет его в Content-Language.
+// После авторизации язык из настроек пользователя имеет приоритет, см. checkAuthorization.
+func withLanguage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Language", negotiateLanguage(r.Header.Get("Accept-Language")))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeMessage - отвечает клиенту текстом успешного результата на языке ответа.
+func writeMessage(w http.ResponseWriter, code string, args ...interface{}) {
+	w.Write([]byte(localize(responseLanguage(w), code, args...)))
+}
+
+// userLanguage - язык из настроек пользователя, а если он не выбран - язык по умолчанию.
+func userLanguage(userID string) string {
+	var lang string
+	err := db.QueryRow(`SELECT language FROM users WHERE id = $1`, userID).Scan(&lang)
+	if err != nil || lang == "" {
+		return defaultLanguage
+	}
+
+	return lang
+}
+
+// setLanguageHandler - сохраняет язык пользователя. Пустой язык означает выбор по Accept-Language.
+func setLanguageHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	lang := r.FormValue("language")
+	if lang != "" {
+		lang = supportedLanguage(lang)
+		if lang == "" {
+			writeFieldError(w, "language", CodeInvalidLanguage, strings.Join(supportedLanguages, ", "))
+			return
+		}
+	}
+
+	_, err := db.Exec(`UPDATE users SET language = $1 WHERE id = $2`, lang, id)
+	if err != nil {
+		log.Printf("Ошибка. При сохранении языка пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	if lang == "" {
+		lang = negotiateLanguage(r.Header.Get("Accept-Language"))
+	}
+	w.Header().Set("Content-Language", lang)
+
+	writeMessage(w, MsgLanguageSaved)
+}
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+// TestCatalogueComplete - каждый текст переведен на все поддерживаемые языки.
+func TestCatalogueComplete(t *testing.T) {
+	for _, lang := range supportedLanguages {
+		for code := range catalogue[defaultLanguage] {
+			if _, ok := catalogue[lang][code]; !ok {
+				t.Errorf("нет текста %s на языке %s", code, lang)
+			}
+		}
+		for code := range catalogue[lang] {
+			if _, ok := catalogue[defaultLanguage][code]; !ok {
+				t.Errorf("текст %s на языке %s есть только в этом языке", code, lang)
+			}
+		}
+	}
+}
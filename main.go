@@ -1,9 +1,13 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	//go run main.go httpHandlers.go types.go utils.go  globals.go
 	//go build main.go httpHandlers.go types.go utils.go  globals.go
 	//pgx
@@ -19,27 +23,65 @@ func main() {
 
 	connectToDB(config.Db)
 	defer db.Close()
+	err := migrateDB()
+	if err != nil {
+		log.Fatalln("Фатал. При обновлении схемы БД: " + err.Error())
+	}
+	initMetrics(db, config.Db.DBname)
 
-	server := http.Server{
-		Addr: fmt.Sprintf("%v:%v", config.HTTP.Host, config.HTTP.Port),
+	initNotifiers(config.Notifications)
+	initTelegram(config.Notifications.Telegram)
+	calendarSettings = config.Calendar
+
+	tlsConfig, certificates, err := newTLSConfig(config.HTTP.TLS)
+	if err != nil {
+		log.Fatalln("Фатал. При настройке https: " + err.Error())
 	}
 
-	http.HandleFunc("/registration", registrationHandler)
-	http.HandleFunc("/authorization", authorizationHandler)
-	http.HandleFunc("/profileInfo", profileInfoHandler)
-	http.HandleFunc("/profileImage", profileImageHandler)
-	http.HandleFunc("/addCar", addCarHandler)
-	http.HandleFunc("/removeCar", removeCarHandler)
-	http.HandleFunc("/logOut", logOutHandler)
-	http.HandleFunc("/getCars", GetCarsHandler)
-	http.HandleFunc("/addOrder", addOrderHandler)
-	http.HandleFunc("/getOrders", getOrdersHandler)
-	http.HandleFunc("/addMessageToOrder", addMessageToOrderHandler)
-	http.HandleFunc("/getMessages", getMessagesHandler)
-	http.HandleFunc("/addAdminMessage", addAdminMeassageHandler)
-
-	err := server.ListenAndServe()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var workers sync.WaitGroup
+	startWorker(ctx, &workers, remindersWorker)
+	startWorker(ctx, &workers, notificationsWorker)
+	startWorker(ctx, &workers, telegramWorker)
+	startWorker(ctx, &workers, func(ctx context.Context) { listenOrderEvents(ctx, config.Db) })
+	startWorker(ctx, &workers, func(ctx context.Context) { serveGRPC(ctx, config.HTTP, tlsConfig) })
+	if certificates != nil {
+		startWorker(ctx, &workers, certificates.reloadOnSIGHUP)
+	}
+	if config.HTTP.TLS.RedirectPort != 0 {
+		startWorker(ctx, &workers, func(ctx context.Context) { redirectToHTTPS(ctx, config.HTTP) })
+	}
+	if config.HTTP.Metrics.Port != 0 {
+		startWorker(ctx, &workers, func(ctx context.Context) { serveMetrics(ctx, config.HTTP) })
+	}
+
+	server := newHTTPServer(config.HTTP, chain(http.DefaultServeMux, withRequestID, withLogging, withMetrics, withRecovery, withLanguage, withBodyLimit))
+	server.TLSConfig = tlsConfig
+
+	routes := registerRoutes(http.DefaultServeMux)
+	openAPIDocument, err = buildOpenAPIDocument(routes)
 	if err != nil {
-		log.Println(err.Error())
+		log.Fatalln("Фатал. При сборке спецификации API: " + err.Error())
 	}
+
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "") // сертификат берется из TLSConfig.GetCertificate, HTTP/2 включается автоматически
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Println("Ошибка. В работе http сервера: " + err.Error())
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Инфо. Остановка сервиса.")
+
+	shutdown(server, &workers, configSeconds(config.HTTP.ShutdownTimeout, defaultShutdownTimeout))
 }
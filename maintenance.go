@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// addOdometerReadingHandler - сохраняет показание одометра, введенное пользователем.
+func addOdometerReadingHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	carID := r.FormValue("carID")
+	if _, err := strconv.Atoi(carID); err != nil {
+		writeFieldError(w, "carID", CodeInvalidCarID)
+		return
+	}
+
+	mileage, err := strconv.Atoi(r.FormValue("mileage"))
+	if err != nil || mileage < 0 {
+		writeFieldError(w, "mileage", CodeInvalidMileage)
+		return
+	}
+
+	if !checkCarAccess(w, id, carID, false) {
+		return
+	}
+
+	var vin string
+	err = db.QueryRow(`SELECT upper(vin) FROM cars WHERE id = $1`, carID).Scan(&vin)
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД машины пользователя: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	var lastMileage int
+	err = db.QueryRow(`SELECT COALESCE(MAX(mileage), 0) FROM odometer WHERE carid = $1`, carID).Scan(&lastMileage)
+	if err != nil {
+		log.Println("Ошибка. При выборке из БД последнего показания одометра: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	if mileage < lastMileage {
+		writeFieldError(w, "mileage", CodeMileageDecreased, lastMileage)
+		return
+	}
+
+	_, err = db.Exec(`INSERT INTO odometer(vin, carid, date, mileage) VALUES($1, $2, $3, $4)`, vin, carID, time.Now(), mileage)
+	if err != nil {
+		log.Printf("Ошибка. При добавлении показания одометра(VIN = %s): %s\n", vin, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	log.Printf("Инфо. Пользователь (ид = %s) добавил показание одометра машине(ид = %s)", id, carID)
+	writeMessage(w, MsgMileageSaved)
+}
+
+// closeAdminOrderHandler - закрывает заказ и, если передан пробег, сохраняет показание одометра.
+// Доступно только сотрудникам сервиса.
+func closeAdminOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID := r.FormValue("orderID")
+	mileage := r.FormValue("mileage")
+	if _, err := strconv.Atoi(orderID); err != nil {
+		writeFieldError(w, "orderID", CodeInvalidOrderID)
+		return
+	}
+
+	if mileage != "" {
+		if value, err := strconv.Atoi(mileage); err != nil || value < 0 {
+			writeFieldError(w, "mileage", CodeInvalidMileage)
+			return
+		}
+	}
+
+	code, err := changeOrderStatus(orderID, StatusClosed, mileage)
+	if err != nil {
+		log.Printf("Ошибка. При закрытии заказа(ид = %s): %s\n", orderID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	if code != "" {
+		writeError(w, http.StatusBadRequest, code)
+	}
+}
+
+// cancelAdminOrderHandler - отменяет незакрытый заказ. Доступно только сотрудникам сервиса.
+func cancelAdminOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID := r.FormValue("orderID")
+	if _, err := strconv.Atoi(orderID); err != nil {
+		writeFieldError(w, "orderID", CodeInvalidOrderID)
+		return
+	}
+
+	code, err := changeOrderStatus(orderID, StatusCancelled, "")
+	if err != nil {
+		log.Printf("Ошибка. При отмене заказа(ид = %s): %s\n", orderID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	if code != "" {
+		writeError(w, http.StatusBadRequest, code)
+		return
+	}
+
+	writeMessage(w, MsgOrderCancelled)
+}
+
+// rescheduleAdminOrderHandler - переносит запись по незакрытому заказу на другую дату.
+// Доступно только сотрудникам сервиса.
+func rescheduleAdminOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order := &Order{
+		ID:    r.FormValue("orderID"),
+		Month: r.FormValue("month"),
+		Day:   r.FormValue("day"),
+		Year:  r.FormValue("year"),
+	}
+	if _, err := strconv.Atoi(order.ID); err != nil {
+		writeFieldError(w, "orderID", CodeInvalidOrderID)
+		return
+	}
+
+	resultOfValidation := ValidateOrderDate(order)
+	if len(resultOfValidation) != 0 {
+		log.Println("Инфо. Попытка перенести запись на невалидную дату: " + resultOfValidation.String())
+		writeValidationErrors(w, resultOfValidation)
+		return
+	}
+
+	code, err := rescheduleOrder(order)
+	if err != nil {
+		log.Printf("Ошибка. При переносе записи по заказу(ид = %s): %s\n", order.ID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	if code == CodeOrderNotFound {
+		writeError(w, http.StatusNotFound, code)
+		return
+	}
+	if code != "" {
+		writeError(w, http.StatusBadRequest, code)
+		return
+	}
+
+	writeMessage(w, MsgOrderRescheduled)
+}
+
+// rescheduleOrder - меняет дату записи по незакрытому заказу и уведомляет участников заказа.
+// Ревизия заказа увеличивается, чтобы календари обновили событие, а флаг уведомления о записи
+// сбрасывается, чтобы напоминание пришло заново перед новой датой.
+// Возвращает код ошибки для сотрудника, если заказа нет или он уже закрыт или отменен.
+func rescheduleOrder(order *Order) (string, error) {
+	result, err := db.Exec(`UPDATE orders SET date = $1, appointmentnotified = FALSE, `+orderRevised+`
+	WHERE id = $2 AND status IN ($3, $4)`, order.GetFormatDate(), order.ID, StatusOpen, StatusСonfirmed)
+	if err != nil {
+		return "", err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		var status int
+		err = db.QueryRow(`SELECT status FROM orders WHERE id = $1`, order.ID).Scan(&status)
+		if err == sql.ErrNoRows {
+			return CodeOrderNotFound, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return CodeOrderFinished, nil
+	}
+
+	date, _ := time.Parse("1-2-2006", order.Month+"-"+order.Day+"-"+order.Year)
+	notifyOrderParticipants(order.ID, newLocalizedText(NotifyRescheduledSubject, order.ID), newLocalizedText(NotifyRescheduledText, order.ID, date.Format("02.01.2006")))
+
+	log.Printf("Инфо. Запись по заказу (ид = %s) перенесена на %s", order.ID, date.Format("02.01.2006"))
+	return "", nil
+}
+
+// orderTransitions - допустимые смены статуса заказа: из какого статуса в какие.
+var orderTransitions = map[int][]int{
+	StatusOpen:      {StatusСonfirmed, StatusClosed, StatusCancelled},
+	StatusСonfirmed: {StatusClosed, StatusCancelled},
+}
+
+// statusNotifications - тема и текст уведомления участникам заказа о переходе в статус.
+// Должны быть для каждого статуса, в который заказ может перейти по orderTransitions.
+var statusNotifications = map[int][2]string{
+	StatusСonfirmed: {NotifyConfirmedSubject, NotifyConfirmedText},
+	StatusClosed:    {NotifyClosedSubject, NotifyClosedText},
+	StatusCancelled: {NotifyCancelledSubject, NotifyCancelledText},
+}
+
+// changeOrderStatus - переводит заказ в новый статус, рассылает событие и уведомления участникам заказа.
+// При закрытии, если передан пробег, сохраняет показание одометра.
+// Возвращает код ошибки для пользователя, если заказа нет или смена статуса недопустима.
+func changeOrderStatus(orderID string, status int, mileage string) (string, error) {
+	var current int
+	err := db.QueryRow(`SELECT status FROM orders WHERE id = $1`, orderID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return CodeOrderNotFound, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	allowed := false
+	for _, next := range orderTransitions[current] {
+		allowed = allowed || next == status
+	}
+	if !allowed {
+		return CodeInvalidTransition, nil
+	}
+
+	// Условие на текущий статус защищает от одновременной смены статуса двумя сотрудниками.
+	result, err := db.Exec(`UPDATE orders SET status = $1, mileage = COALESCE($2::integer, mileage), `+orderRevised+` WHERE id = $3 AND status = $4`,
+		status, sql.NullString{String: mileage, Valid: mileage != ""}, orderID, current)
+	if err != nil {
+		return "", err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return CodeInvalidTransition, nil
+	}
+
+	if status == StatusClosed && mileage != "" {
+		_, err = db.Exec(`INSERT INTO odometer(vin, carid, date, mileage, orderid)
+		SELECT upper(c.vin), c.id, $1, $2, o.id FROM orders o JOIN cars c ON c.id = o.carid WHERE o.id = $3`, time.Now(), mileage, orderID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	publishOrderEvent(&OrderEvent{Type: EventStatus, OrderID: orderID, Status: status})
+	notification := statusNotifications[status]
+	notifyOrderParticipants(orderID, newLocalizedText(notification[0], orderID), newLocalizedText(notification[1], orderID))
+
+	log.Printf("Инфо. Заказ (ид = %s) переведен в статус %d", orderID, status)
+	return "", nil
+}
+
+// getRemindersHandler - отдает пользователю напоминания о предстоящем обслуживании его машин.
+func getRemindersHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	rows, err := db.Query(`SELECT r.id, r.carid, c.brand || ' ' || c.model || '(' || c.year || ')', r.scheduleid, r.text, COALESCE(r.duemileage::text, ''), r.duedate, r.created
+	FROM reminders r JOIN cars c ON c.id = r.carid
+	WHERE r.userid = $1 AND c.deleted = FALSE ORDER BY r.created DESC`, id)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД напоминаний пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	defer rows.Close()
+
+	result := make([]*Reminder, 0)
+
+	for rows.Next() {
+		reminder := Reminder{}
+		err = rows.Scan(&reminder.ID, &reminder.CarID, &reminder.CarInfo, &reminder.ScheduleID, &reminder.Text, &reminder.DueMileage, &reminder.DueDate, &reminder.Created)
+		if err != nil {
+			log.Printf("Ошибка. При выборке из БД напоминаний пользователя(ид =  %s): %s\n", id, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+		result = append(result, &reminder)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// remindersWorker - фоновая задача, которая периодически ищет машины,
+// которым пора на обслуживание, и ставит их владельцам напоминания в очередь,
+// а также уведомляет о новых напоминаниях и предстоящих записях на обслуживание.
+// Завершается, когда отменяется ctx.
+func remindersWorker(ctx context.Context) {
+	ticker := time.NewTicker(remindersInterval)
+	defer ticker.Stop()
+
+	for {
+		checkMaintenance()
+		notifyReminders()
+		notifyUpcomingAppointments()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkMaintenance - проверяет все машины по регламентам обслуживания и создает напоминания.
+// Машины без показаний одометра не проверяются: отсчитывать срок обслуживания не от чего.
+func checkMaintenance() {
+	schedules, err := getMaintenanceSchedules()
+	if err != nil {
+		log.Println("Ошибка. При выборке из БД регламентов обслуживания: " + err.Error())
+		return
+	}
+
+	services, err := getLastServices()
+	if err != nil {
+		log.Println("Ошибка. При выборке из БД выполненных работ по регламентам: " + err.Error())
+		return
+	}
+
+	rows, err := db.Query(`SELECT c.id, c.brand, c.model, c.year, upper(c.vin), c.userid, r.current, r.first, r.firstdate
+	FROM cars c JOIN (SELECT carid, MAX(mileage) AS current, (array_agg(mileage ORDER BY date, id))[1] AS first, MIN(date) AS firstdate
+		FROM odometer GROUP BY carid) r ON r.carid = c.id
+	WHERE c.deleted = FALSE`)
+	if err != nil {
+		log.Println("Ошибка. При выборке из БД машин для проверки обслуживания: " + err.Error())
+		return
+	}
+
+	cars := make([]*Car, 0)
+	mileages := make([]*carMileage, 0)
+	for rows.Next() {
+		car := Car{}
+		mileage := carMileage{}
+		err = rows.Scan(&car.ID, &car.Brand, &car.Model, &car.Year, &car.VIN, &car.UserID, &mileage.current, &mileage.first, &mileage.firstDate)
+		if err != nil {
+			log.Println("Ошибка. При выборке из БД машин для проверки обслуживания: " + err.Error())
+			rows.Close()
+			return
+		}
+		cars = append(cars, &car)
+		mileages = append(mileages, &mileage)
+	}
+	rows.Close()
+
+	created := 0
+	for i, car := range cars {
+		for _, schedule := range schedules {
+			if schedule.Brand != "" && !strings.EqualFold(schedule.Brand, car.Brand) {
+				continue
+			}
+
+			ok, err := enqueueReminderIfDue(car, mileages[i], schedule, services[serviceKey(car.VIN, schedule.ID)])
+			if err != nil {
+				log.Printf("Ошибка. При проверке обслуживания машины(ид = %s) по регламенту %q: %s\n", car.ID, schedule.Name, err.Error())
+				continue
+			}
+			if ok {
+				created++
+			}
+		}
+	}
+
+	log.Printf("Инфо. Проверка обслуживания завершена, создано напоминаний: %d", created)
+}
+
+// carMileage - показания одометра машины, от которых считается срок обслуживания.
+type carMileage struct {
+	current   int       // наибольший пробег
+	first     int       // пробег по первому показанию
+	firstDate time.Time // дата первого показания
+}
+
+// lastService - последний закрытый заказ с работой по регламенту. Пробег в заказе может быть не указан.
+type lastService struct {
+	date    time.Time
+	mileage sql.NullInt64
+}
+
+// serviceKey - ключ последнего обслуживания машины с VIN vin по регламенту scheduleID.
+func serviceKey(vin string, scheduleID string) string {
+	return vin + "/" + scheduleID
+}
+
+// getLastServices - возвращает одним запросом последние закрытые заказы с работой по каждому регламенту
+// для каждого VIN, ключ - serviceKey. Работы считаются по VIN, так как обслуживание, сделанное
+// при прежнем владельце, тоже сдвигает срок следующего.
+func getLastServices() (map[string]*lastService, error) {
+	rows, err := db.Query(`SELECT DISTINCT ON (upper(c.vin), i.scheduleid) upper(c.vin), i.scheduleid, o.date, o.mileage
+	FROM orderitems i JOIN orders o ON o.id = i.orderid JOIN cars c ON c.id = o.carid
+	WHERE i.scheduleid IS NOT NULL AND o.status = $1
+	ORDER BY upper(c.vin), i.scheduleid, o.date DESC`, StatusClosed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]*lastService)
+	for rows.Next() {
+		var vin, scheduleID string
+		service := lastService{}
+		err = rows.Scan(&vin, &scheduleID, &service.date, &service.mileage)
+		if err != nil {
+			return nil, err
+		}
+		result[serviceKey(vin, scheduleID)] = &service
+	}
+
+	return result, rows.Err()
+}
+
+// getMaintenanceSchedules - возвращает все регламенты обслуживания.
+func getMaintenanceSchedules() ([]*MaintenanceSchedule, error) {
+	rows, err := db.Query(`SELECT id, COALESCE(brand, ''), name, COALESCE(code, ''), intervalkm, intervalmonths FROM maintenanceschedules`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*MaintenanceSchedule, 0)
+	for rows.Next() {
+		schedule := MaintenanceSchedule{}
+		err = rows.Scan(&schedule.ID, &schedule.Brand, &schedule.Name, &schedule.Code, &schedule.IntervalKm, &schedule.IntervalMonths)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &schedule)
+	}
+
+	return result, rows.Err()
+}
+
+// scheduleName - название регламента на языке lang. Регламенты из начальных данных БД переводятся по коду,
+// названия регламентов, добавленных сервисом, отдаются как есть.
+func scheduleName(schedule *MaintenanceSchedule, lang string) string {
+	if schedule.Code == "" {
+		return schedule.Name
+	}
+
+	return localize(lang, schedule.Code)
+}
+
+// enqueueReminderIfDue - создает напоминание, если машине пора пройти обслуживание по регламенту.
+// Отсчет ведется от последнего закрытого заказа с работой по этому регламенту done,
+// а если такого не было - от первого показания одометра.
+func enqueueReminderIfDue(car *Car, mileage *carMileage, schedule *MaintenanceSchedule, done *lastService) (bool, error) {
+	baseMileage := mileage.first
+	baseDate := mileage.firstDate
+
+	if done != nil {
+		baseDate = done.date
+		baseMileage = int(done.mileage.Int64)
+	}
+
+	due := false
+	reminder := &Reminder{
+		CarID:      car.ID,
+		ScheduleID: schedule.ID,
+	}
+
+	var dueMileage sql.NullInt64
+	if schedule.IntervalKm > 0 && (done == nil || done.mileage.Valid) {
+		dueMileage = sql.NullInt64{Int64: int64(baseMileage + schedule.IntervalKm), Valid: true}
+		due = due || mileage.current >= int(dueMileage.Int64)-reminderLeadKm
+	}
+
+	if schedule.IntervalMonths > 0 {
+		reminder.DueDate = baseDate.AddDate(0, schedule.IntervalMonths, 0)
+		due = due || time.Now().After(reminder.DueDate.AddDate(0, 0, -reminderLeadDays))
+	} else {
+		reminder.DueDate = baseDate
+	}
+
+	if !due {
+		return false, nil
+	}
+
+	// Текст напоминания сразу переводится на язык владельца, его же видно в списке напоминаний.
+	lang := userLanguage(car.UserID)
+	reminder.Text = localize(lang, NotifyReminderText, scheduleName(schedule, lang), car.Brand, car.Model, car.Year)
+
+	result, err := db.Exec(`INSERT INTO reminders(userid, carid, scheduleid, text, duemileage, duedate, created)
+	SELECT $1, $2, $3, $4, $5, $6, $7 WHERE NOT EXISTS
+	(SELECT 1 FROM reminders WHERE carid = $2 AND scheduleid = $3 AND duedate = $6)`,
+		car.UserID, reminder.CarID, reminder.ScheduleID, reminder.Text, dueMileage, reminder.DueDate, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count != 0, err
+}
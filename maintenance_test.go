@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// TestScheduleName - регламенты из начальных данных переводятся на язык владельца,
+// названия регламентов, добавленных сервисом, не меняются.
+func TestScheduleName(t *testing.T) {
+	seeded := &MaintenanceSchedule{Name: "Замена тормозной жидкости", Code: ScheduleBrakeFluid}
+	custom := &MaintenanceSchedule{Name: "Замена ремня ГРМ"}
+
+	if name := scheduleName(seeded, LangEN); name != "Brake fluid replacement" {
+		t.Errorf("регламент из начальных данных: %q", name)
+	}
+	if name := scheduleName(seeded, LangRU); name != seeded.Name {
+		t.Errorf("регламент из начальных данных на русском: %q", name)
+	}
+	if name := scheduleName(custom, LangEN); name != custom.Name {
+		t.Errorf("регламент сервиса: %q", name)
+	}
+}
+
+// TestCheckMaintenance - последние работы по регламентам выбираются одним запросом на все машины,
+// а срок для машины без обслуживания считается от первого показания одометра, а не от нулевого пробега.
+func TestCheckMaintenance(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery(`FROM maintenanceschedules`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "brand", "name", "code", "intervalkm", "intervalmonths"}).
+			AddRow("1", "", "Замена моторного масла и масляного фильтра", ScheduleOilChange, 10000, 12).
+			AddRow("2", "Toyota", "Замена ремня ГРМ", "", 1000, 0))
+
+	month := time.Now().AddDate(0, -1, 0)
+	mock.ExpectQuery(`FROM orderitems`).WithArgs(StatusClosed).WillReturnRows(
+		sqlmock.NewRows([]string{"vin", "scheduleid", "date", "mileage"}).AddRow("XTA210990Y2766389", "1", month, 55000))
+	mock.ExpectQuery(`FROM cars c JOIN`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "brand", "model", "year", "vin", "userid", "current", "first", "firstdate"}).
+			AddRow("7", "Lada", "Vesta", "2020", "XTA210990S1234567", "5", 59600, 50000, month).
+			AddRow("8", "Lada", "Priora", "2000", "XTA210990Y2766389", "6", 59600, 40000, month))
+
+	mock.ExpectQuery(`SELECT language FROM users`).WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"language"}).AddRow(LangEN))
+	mock.ExpectExec(`INSERT INTO reminders`).
+		WithArgs("5", "7", "1", localize(LangEN, NotifyReminderText, "Engine oil and oil filter replacement", "Lada", "Vesta", "2020"),
+			int64(60000), month.AddDate(0, 12, 0), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	checkMaintenance()
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
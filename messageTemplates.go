@@ -0,0 +1,232 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templatePlaceholders - подстановки, доступные в шаблонах сообщений.
+var templatePlaceholders = []string{"{customerName}", "{carInfo}", "{orderDate}", "{cost}"}
+
+// templatePlaceholderRegexp - регулярное выражение для поиска подстановок в тексте шаблона.
+var templatePlaceholderRegexp = regexp.MustCompile(`\{[a-zA-Z]+\}`)
+
+// getAdminTemplatesHandler - отдает сотруднику все шаблоны сообщений.
+func getAdminTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query(`SELECT id, name, text FROM messagetemplates ORDER BY name`)
+	if err != nil {
+		log.Println("Ошибка. При выборке из БД шаблонов сообщений: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	defer rows.Close()
+
+	result := make([]*MessageTemplate, 0)
+
+	for rows.Next() {
+		template := MessageTemplate{}
+		err = rows.Scan(&template.ID, &template.Name, &template.Text)
+		if err != nil {
+			log.Println("Ошибка. При выборке из БД шаблонов сообщений: " + err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+		result = append(result, &template)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// addAdminTemplateHandler - добавляет шаблон сообщения.
+func addAdminTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	template := &MessageTemplate{
+		Name: strings.TrimSpace(r.FormValue("name")),
+		Text: r.FormValue("text"),
+	}
+
+	resultOfValidation := ValidateMessageTemplate(template)
+	if len(resultOfValidation) != 0 {
+		writeValidationErrors(w, resultOfValidation)
+		return
+	}
+
+	_, err := db.Exec(`INSERT INTO messagetemplates(name, text) VALUES($1, $2)`, template.Name, template.Text)
+	if err != nil {
+		log.Println("Ошибка. При сохранении в БД шаблона сообщения: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	log.Printf("Инфо. Сотрудник (ид = %s) добавил шаблон сообщения %q", id, template.Name)
+	writeMessage(w, MsgTemplateSaved)
+}
+
+// updateAdminTemplateHandler - изменяет существующий шаблон сообщения.
+func updateAdminTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	template := &MessageTemplate{
+		ID:   r.FormValue("id"),
+		Name: strings.TrimSpace(r.FormValue("name")),
+		Text: r.FormValue("text"),
+	}
+	if _, err := strconv.Atoi(template.ID); err != nil {
+		writeFieldError(w, "id", CodeInvalidTemplateID)
+		return
+	}
+
+	resultOfValidation := ValidateMessageTemplate(template)
+	if len(resultOfValidation) != 0 {
+		writeValidationErrors(w, resultOfValidation)
+		return
+	}
+
+	result, err := db.Exec(`UPDATE messagetemplates SET name = $1, text = $2 WHERE id = $3`, template.Name, template.Text, template.ID)
+	if err != nil {
+		log.Println("Ошибка. При сохранении в БД шаблона сообщения: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		writeError(w, http.StatusNotFound, CodeTemplateNotFound)
+		return
+	}
+
+	log.Printf("Инфо. Сотрудник (ид = %s) изменил шаблон сообщения(ид = %s)", id, template.ID)
+	writeMessage(w, MsgTemplateSaved)
+}
+
+// removeAdminTemplateHandler - удаляет шаблон сообщения.
+func removeAdminTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	templateID := r.FormValue("id")
+	if _, err := strconv.Atoi(templateID); err != nil {
+		writeFieldError(w, "id", CodeInvalidTemplateID)
+		return
+	}
+
+	_, err := db.Exec(`DELETE FROM messagetemplates WHERE id = $1`, templateID)
+	if err != nil {
+		log.Println("Ошибка. При удалении из БД шаблона сообщения: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	writeMessage(w, MsgTemplateRemoved)
+}
+
+// previewAdminTemplateHandler - отдает текст шаблона, заполненный данными указанного заказа.
+func previewAdminTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	text := renderMessageTemplate(w, r.FormValue("templateID"), r.FormValue("orderID"))
+	if text == "" {
+		return
+	}
+
+	data, err := json.Marshal(&TemplatePreview{Text: text})
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// renderMessageTemplate - заполняет шаблон сообщения данными заказа.
+// В случае ошибки сам отвечает клиенту и возвращает пустую строку.
+func renderMessageTemplate(w http.ResponseWriter, templateID string, orderID string) string {
+	if _, err := strconv.Atoi(templateID); err != nil {
+		writeFieldError(w, "templateID", CodeInvalidTemplateID)
+		return ""
+	}
+	if _, err := strconv.Atoi(orderID); err != nil {
+		writeFieldError(w, "orderID", CodeInvalidOrderID)
+		return ""
+	}
+
+	var text string
+	err := db.QueryRow(`SELECT text FROM messagetemplates WHERE id = $1`, templateID).Scan(&text)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusBadRequest, CodeTemplateNotFound)
+		return ""
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД шаблона сообщения: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return ""
+	}
+
+	var customerName, carInfo, cost string
+	var date time.Time
+	err = db.QueryRow(`SELECT u.name, c.brand || ' ' || c.model || '(' || c.year || ')', o.date, COALESCE(o.cost::text, '')
+	FROM orders o JOIN users u ON u.id = o.userid JOIN cars c ON c.id = o.carid WHERE o.id = $1`, orderID).
+		Scan(&customerName, &carInfo, &date, &cost)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusBadRequest, CodeOrderNotFound)
+		return ""
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД данных заказа для шаблона: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return ""
+	}
+
+	return strings.NewReplacer(
+		"{customerName}", customerName,
+		"{carInfo}", carInfo,
+		"{orderDate}", date.Format("02.01.2006"),
+		"{cost}", cost,
+	).Replace(text)
+}
+
+// ValidateMessageTemplate - проверяет шаблон сообщения на бизнес правила
+func ValidateMessageTemplate(template *MessageTemplate) ValidationErrors {
+	resultOfValidation := ValidationErrors{}
+
+	if template.Name == "" || len(template.Name) > 100 {
+		resultOfValidation.add("name", CodeTemplateName, 100)
+	}
+
+	if strings.TrimSpace(template.Text) == "" {
+		resultOfValidation.add("text", CodeTemplateText)
+	}
+
+	for _, placeholder := range templatePlaceholderRegexp.FindAllString(template.Text, -1) {
+		known := false
+		for _, item := range templatePlaceholders {
+			known = known || placeholder == item
+		}
+		if !known {
+			resultOfValidation.add("text", CodePlaceholder, placeholder, strings.Join(templatePlaceholders, ", "))
+		}
+	}
+
+	return resultOfValidation
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// TestValidateMessageTemplate - название, текст и известные подстановки шаблона.
+func TestValidateMessageTemplate(t *testing.T) {
+	tests := []struct {
+		template MessageTemplate
+		fields   []string
+	}{
+		{MessageTemplate{Name: "Готово", Text: "{customerName}, ваш {carInfo} готов, к оплате {cost}."}, nil},
+		{MessageTemplate{Name: "", Text: "Текст"}, []string{"name"}},
+		{MessageTemplate{Name: strings.Repeat("я", 101), Text: "Текст"}, []string{"name"}},
+		{MessageTemplate{Name: "Пусто", Text: "  "}, []string{"text"}},
+		{MessageTemplate{Name: "Опечатка", Text: "Ждем вас {orderdate} и {customerName} {price}"}, []string{"text", "text"}},
+	}
+
+	for _, test := range tests {
+		errs := ValidateMessageTemplate(&test.template)
+		fields := make([]string, 0)
+		for _, err := range errs {
+			fields = append(fields, err.Field)
+		}
+		if strings.Join(fields, ",") != strings.Join(test.fields, ",") {
+			t.Errorf("%q: ошибки %s", test.template.Text, errs.String())
+		}
+	}
+}
+
+// TestPreviewAdminTemplate - подстановки заполняются данными заказа, ответ - json с текстом.
+func TestPreviewAdminTemplate(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery(`SELECT text FROM messagetemplates`).WithArgs("3").
+		WillReturnRows(sqlmock.NewRows([]string{"text"}).AddRow("{customerName}, ждем {carInfo} {orderDate}. Стоимость: {cost}"))
+	mock.ExpectQuery(`FROM orders o JOIN users u`).WithArgs("9").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "car", "date", "cost"}).
+			AddRow("Иван", "Lada Vesta(2020)", time.Date(2026, 11, 3, 0, 0, 0, 0, time.UTC), "4500"))
+
+	recorder := httptest.NewRecorder()
+	previewAdminTemplateHandler(recorder, formRequest("/", url.Values{"templateID": {"3"}, "orderID": {"9"}}))
+
+	preview := TemplatePreview{}
+	err := json.Unmarshal(recorder.Body.Bytes(), &preview)
+	if err != nil || preview.Text != "Иван, ждем Lada Vesta(2020) 03.11.2026. Стоимость: 4500" {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+	if contentType := recorder.Header().Get("Content-type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Errorf("Content-type %s", contentType)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestUpdateAdminTemplate - изменить можно только существующий шаблон, иначе 404.
+func TestUpdateAdminTemplate(t *testing.T) {
+	mock := useMockDB(t)
+	form := url.Values{"id": {"3"}, "name": {"Готово"}, "text": {"Ваш {carInfo} готов."}}
+
+	mock.ExpectExec(`UPDATE messagetemplates`).WithArgs("Готово", "Ваш {carInfo} готов.", "3").WillReturnResult(sqlmock.NewResult(0, 1))
+	recorder := httptest.NewRecorder()
+	updateAdminTemplateHandler(recorder, userRequest("5", form))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	mock.ExpectExec(`UPDATE messagetemplates`).WillReturnResult(sqlmock.NewResult(0, 0))
+	recorder = httptest.NewRecorder()
+	updateAdminTemplateHandler(recorder, userRequest("5", form))
+	if recorder.Code != http.StatusNotFound || errorCode(recorder) != CodeTemplateNotFound {
+		t.Errorf("несуществующий шаблон: код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	form.Set("id", "abc")
+	recorder = httptest.NewRecorder()
+	updateAdminTemplateHandler(recorder, userRequest("5", form))
+	if recorder.Code != http.StatusBadRequest || fieldCodes(recorder)["id"] != CodeInvalidTemplateID {
+		t.Errorf("нечисловой ид: код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/STEJLS/ServiceStation/XMLconfig"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// metricsPath - путь, по которому Prometheus забирает метрики.
+const metricsPath = "/metrics"
+
+// metricsDefaultHost - адрес сервера метрик, если он не указан в конфигурации.
+const metricsDefaultHost = "127.0.0.1"
+
+// metricsNamespace - общий префикс имен метрик сервиса.
+const metricsNamespace = "servicestation"
+
+// metricsRegistry - все метрики сервиса. Отдельный реестр, чтобы в метрики не попадало лишнее из библиотек.
+var metricsRegistry = prometheus.NewRegistry()
+
+// Метрики запросов.
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "http_requests_total",
+		Help: "Количество http запросов по маршруту, методу и коду ответа.",
+	}, []string{"route", "method", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace, Name: "http_request_duration_seconds",
+		Help: "Время обработки http запросов по маршруту и методу.", Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "grpc_requests_total",
+		Help: "Количество gRPC запросов по методу и коду ответа.",
+	}, []string{"method", "code"})
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace, Name: "grpc_request_duration_seconds",
+		Help: "Время обработки gRPC запросов по методу.", Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+	grpcStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace, Name: "grpc_open_streams",
+		Help: "Количество открытых потоков gRPC по методу.",
+	}, []string{"method"})
+)
+
+// Метрики бизнес-событий.
+var (
+	registrationsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "registrations_total", Help: "Количество регистраций пользователей.",
+	})
+	loginsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "logins_total", Help: "Количество успешных входов.",
+	})
+	failedLoginsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "failed_logins_total", Help: "Количество неудачных попыток входа.",
+	})
+	ordersCreatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "orders_created_total", Help: "Количество созданных заказов.",
+	})
+	messagesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "messages_total", Help: "Количество сообщений в заказах по отправителю: user или staff.",
+	}, []string{"sender"})
+)
+
+// httpEvents - бизнес-события по маршруту запроса "МЕТОД маршрут", которые учитываются по коду ответа.
+// Обработчики про метрики ничего не знают, события считает withMetrics.
+var httpEvents = map[string]func(status int){
+	"POST " + apiPrefix + "/users":                           countSuccess(registrationsTotal),
+	"POST /registration":                                     countSuccess(registrationsTotal),
+	"POST " + apiPrefix + "/sessions":                        countLogin,
+	"POST /authorization":                                    countLogin,
+	"POST " + apiPrefix + "/orders":                          countSuccess(ordersCreatedTotal),
+	"POST /addOrder":                                         countSuccess(ordersCreatedTotal),
+	"POST " + apiPrefix + "/orders/{orderID}/messages":       countSuccess(messagesTotal.WithLabelValues("user")),
+	"POST /addMessageToOrder":                                countSuccess(messagesTotal.WithLabelValues("user")),
+	"POST " + apiPrefix + "/admin/orders/{orderID}/messages": countSuccess(messagesTotal.WithLabelValues("staff")),
+	"POST /addAdminMessage":                                  countSuccess(messagesTotal.WithLabelValues("staff")),
+}
+
+// grpcEvents - бизнес-события по полному имени метода gRPC, учитываются при успешном ответе.
+var grpcEvents = map[string]prometheus.Counter{
+	"/servicestation.ServiceStation/AddMessage":      messagesTotal.WithLabelValues("user"),
+	"/servicestation.ServiceStation/AddStaffMessage": messagesTotal.WithLabelValues("staff"),
+}
+
+// countSuccess - событие, которое учитывается при успешном ответе.
+func countSuccess(counter prometheus.Counter) func(status int) {
+	return func(status int) {
+		if status < http.StatusBadRequest {
+			counter.Inc()
+		}
+	}
+}
+
+// countLogin - успешный вход или неудачная попытка входа. Внутренние ошибки сервиса попыткой не считаются.
+func countLogin(status int) {
+	switch {
+	case status < http.StatusBadRequest:
+		loginsTotal.Inc()
+	case status < http.StatusInternalServerError:
+		failedLoginsTotal.Inc()
+	}
+}
+
+// initMetrics - регистрирует метрики сервиса, среды выполнения go и пула соединений с базой данных dbName.
+func initMetrics(db *sql.DB, dbName string) {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, dbName),
+		httpRequests, httpDuration, grpcRequests, grpcDuration, grpcStreams,
+		registrationsTotal, loginsTotal, failedLoginsTotal, ordersCreatedTotal, messagesTotal,
+	)
+}
+
+// metricsHandler - отдает метрики в формате Prometheus.
+var metricsHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}).ServeHTTP
+
+// serveMetrics - служебный http сервер, который отдает только метрики. Метрики не регистрируются
+// в маршрутах API: по ним видно нагрузку и пути запросов, поэтому снаружи они недоступны.
+func serveMetrics(ctx context.Context, config XMLconfig.Http) {
+	host := config.Metrics.Host
+	if host == "" {
+		host = metricsDefaultHost
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, metricsHandler)
+	server := &http.Server{
+		Addr:              net.JoinHostPort(host, strconv.Itoa(config.Metrics.Port)),
+		Handler:           mux,
+		ReadHeaderTimeout: configSeconds(config.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		IdleTimeout:       configSeconds(config.IdleTimeout, defaultIdleTimeout),
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Инфо. Метрики отдаются на %s%s", server.Addr, metricsPath)
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Println("Ошибка. В работе сервера метрик: " + err.Error())
+	}
+}
+
+// routeKey - ключ, по которому в контексте запроса лежит маршрут для метрик, см. setMetricsRoute.
+type routeKey struct{}
+
+// setMetricsRoute - уточняет маршрут запроса для метрик. Маршрутизатор API передает шаблон маршрута,
+// чтобы запросы к /cars/1 и /cars/2 попадали в одну метрику.
+func setMetricsRoute(r *http.Request, route string) {
+	if holder, ok := r.Context().Value(routeKey{}).(*string); ok {
+		*holder = route
+	}
+}
+
+// withMetrics - учитывает каждый запрос в метриках: количество по маршруту, методу и коду ответа,
+// время обработки и бизнес-события. Маршрут - шаблон, по которому запрос попал в обработчик,
+// а не путь запроса, чтобы количество метрик не росло от параметров в пути.
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		route := new(string)
+
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), routeKey{}, route)))
+
+		if *route == "" {
+			_, *route = http.DefaultServeMux.Handler(r)
+		}
+		if *route == "" {
+			*route = "unknown"
+		}
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(*route, r.Method, strconv.Itoa(recorder.status)).Inc()
+		httpDuration.WithLabelValues(*route, r.Method).Observe(time.Since(start).Seconds())
+
+		if event, ok := httpEvents[r.Method+" "+*route]; ok {
+			event(recorder.status)
+		}
+	})
+}
+
+// grpcMetricsInterceptor - то же, что withMetrics, для gRPC методов.
+func grpcMetricsInterceptor(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+
+	response, err := handler(ctx, request)
+
+	grpcRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	grpcDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+
+	if counter, ok := grpcEvents[info.FullMethod]; ok && err == nil {
+		counter.Inc()
+	}
+
+	return response, err
+}
+
+// grpcMetricsStreamInterceptor - учитывает потоковые методы gRPC: количество открытых потоков,
+// а после закрытия потока - вызов по коду ответа. Время не учитывается: поток открыт, пока клиент
+// подписан на события, и его длительность ничего не говорит о скорости сервиса.
+func grpcMetricsStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	streams := grpcStreams.WithLabelValues(info.FullMethod)
+	streams.Inc()
+	defer streams.Dec()
+
+	err := handler(srv, stream)
+
+	grpcRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+
+	return err
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// middleware - промежуточный обработчик: оборачивает обработчик и выполняет общую для маршрутов работу.
+type middleware func(http.Handler) http.Handler
+
+// chain - оборачивает обработчик промежуточными обработчиками. Первый в списке выполняется первым.
+func chain(handler http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// userIDKey - ключ, по которому в контексте запроса лежит ид авторизованного пользователя.
+type userIDKey struct{}
+
+// protect - обработчик маршрута с проверкой уровня доступа: accessPublic, accessUser или accessStaff.
+// Уровень доступа указывается при регистрации каждого маршрута в main.
+func protect(access string, handler http.HandlerFunc) http.Handler {
+	switch access {
+	case accessPublic:
+		return handler
+	case accessUser:
+		return requireUser(handler)
+	case accessStaff:
+		return requireStaff(handler)
+	}
+
+	log.Fatalln("Фатал. Неизвестный уровень доступа к маршруту: " + access)
+	return nil
+}
+
+// requireUser - пропускает только авторизованных пользователей и кладет ид пользователя в контекст запроса.
+func requireUser(next http.Handler) http.Handler {
+	return withUserID(next, checkAuthorization)
+}
+
+// requireStaff - пропускает только сотрудников сервиса, а если включена проверка терминалов -
+// только с терминалов сотрудников, и кладет ид сотрудника в контекст запроса.
+func requireStaff(next http.Handler) http.Handler {
+	return withUserID(next, func(w http.ResponseWriter, r *http.Request) string {
+		if !checkStaffTerminal(w, r) {
+			return ""
+		}
+
+		return checkStaffAuthorization(w, r)
+	})
+}
+
+// withUserID - проверяет авторизацию функцией check, которая сама отвечает клиенту при отказе,
+// и передает запрос дальше с ид пользователя в контексте.
+func withUserID(next http.Handler, check func(w http.ResponseWriter, r *http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := check(w, r)
+
+		if id == "" {
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userIDKey{}, id)))
+	})
+}
+
+// currentUserID - ид пользователя, авторизованного requireUser или requireStaff.
+// Для публичных маршрутов возвращает пустую строку.
+func currentUserID(r *http.Request) string {
+	id, _ := r.Context().Value(userIDKey{}).(string)
+	return id
+}
+
+// withBodyLimit - ограничивает размер тела любого запроса, чтобы разбор формы не читал в память
+// и на диск сколько угодно данных. Самые большие запросы - сообщения с вложениями.
+func withBodyLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withRecovery - перехватывает панику в обработчике, пишет ее в лог и отвечает клиенту внутренней ошибкой,
+// чтобы сбой в одном обработчике не обрывал соединение без ответа.
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			log.Printf("Ошибка. Паника при обработке запроса %s %s(ид запроса = %s): %v\n%s",
+				r.Method, r.URL.Path, w.Header().Get(requestIDHeader), err, debug.Stack())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder - ResponseWriter, который запоминает код ответа для лога.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader - запоминает код ответа.
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Write - без WriteHeader ответ получает код 200.
+func (recorder *statusRecorder) Write(data []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	return recorder.ResponseWriter.Write(data)
+}
+
+// Flush - нужен потоку событий заказов.
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap - исходный ResponseWriter для http.ResponseController.
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// withLogging - пишет в лог каждый запрос: метод, путь, код ответа, время обработки и ид запроса.
+func withLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		log.Printf("Инфо. %s %s %d %v(ид запроса = %s)\n", r.Method, r.URL.Path, recorder.status,
+			time.Since(start).Round(time.Millisecond), w.Header().Get(requestIDHeader))
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles - миграции схемы БД. Имя файла - номер версии, подчеркивание и описание,
+// например 007_read_receipts.sql. Версия схемы в БД хранится в таблице schemaversion.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationsLock - ключ advisory lock, чтобы экземпляры сервиса, запущенные одновременно,
+// не применяли миграции параллельно.
+const migrationsLock = 7_001_033
+
+// schemaVersion - версия схемы БД, с которой работает код: номер последней миграции в каталоге migrations.
+// До этой версии схему доводит migrateDB при запуске, проверяется в readyHandler.
+var schemaVersion = latestMigration()
+
+// migration - одна миграция схемы БД.
+type migration struct {
+	version int
+	name    string
+	query   string
+}
+
+// loadMigrations - читает миграции и сортирует их по версии.
+// Версии должны идти подряд с 1, чтобы пропущенная или повторенная миграция не осталась незамеченной.
+func loadMigrations() ([]*migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]*migration, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		number := strings.SplitN(name, "_", 2)[0]
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("имя миграции %q должно начинаться с номера версии", name)
+		}
+
+		data, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, &migration{version: version, name: name, query: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i, migration := range migrations {
+		if migration.version != i+1 {
+			return nil, fmt.Errorf("миграция %s: ожидается версия %d", migration.name, i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// latestMigration - номер последней миграции. Миграции встроены в сервис при сборке,
+// поэтому ошибка в них - ошибка сборки, и сервис с ней не запускается.
+func latestMigration() int {
+	migrations, err := loadMigrations()
+	if err != nil {
+		log.Fatalln("Фатал. Некорректные миграции схемы БД: " + err.Error())
+	}
+
+	return len(migrations)
+}
+
+// migrateDB - применяет миграции, которых еще нет в БД. Все миграции применяются в одной транзакции:
+// если одна из них не прошла, то схема остается прежней. В базе, созданной до появления миграций,
+// нет таблицы schemaversion, такая база считается базой версии 0.
+func migrateDB() error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationsLock)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS schemaversion (version integer NOT NULL)`)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = tx.QueryRow(`SELECT version FROM schemaversion`).Scan(&version)
+	if err == sql.ErrNoRows {
+		_, err = tx.Exec(`INSERT INTO schemaversion(version) VALUES (0)`)
+	}
+	if err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("версия схемы БД %d новее, чем знает сервис(%d)", version, len(migrations))
+	}
+
+	for _, migration := range migrations[version:] {
+		_, err = tx.Exec(migration.query)
+		if err != nil {
+			return fmt.Errorf("миграция %s: %s", migration.name, err.Error())
+		}
+		log.Println("Инфо. Применена миграция схемы БД " + migration.name)
+	}
+
+	_, err = tx.Exec(`UPDATE schemaversion SET version = $1`, len(migrations))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,28 @@
+-- История обслуживания по VIN: сотрудники, пробег в заказе, позиции заказа, показания одометра и заметки сервиса.
+
+ALTER TABLE users ADD COLUMN isstaff boolean NOT NULL DEFAULT FALSE;
+
+ALTER TABLE orders ADD COLUMN mileage integer;
+
+CREATE TABLE orderitems (
+id serial PRIMARY KEY,
+orderID integer REFERENCES orders(id),
+name varchar (100) NOT NULL,
+quantity integer NOT NULL DEFAULT 1,
+cost integer NOT NULL
+);
+
+CREATE TABLE odometer (
+id serial PRIMARY KEY,
+vin varchar (17) NOT NULL,
+date timestamp NOT NULL,
+mileage integer NOT NULL,
+orderID integer REFERENCES orders(id)
+);
+
+CREATE TABLE carnotes (
+id serial PRIMARY KEY,
+vin varchar (17) NOT NULL,
+date timestamp NOT NULL,
+text varchar NOT NULL
+);
@@ -0,0 +1,31 @@
+-- Регламенты обслуживания и напоминания владельцам.
+
+CREATE TABLE maintenanceschedules (
+id serial PRIMARY KEY,
+brand varchar (20),
+name varchar (100) NOT NULL,
+intervalkm integer NOT NULL DEFAULT 0,
+intervalmonths integer NOT NULL DEFAULT 0
+);
+
+INSERT INTO maintenanceschedules(name, intervalkm, intervalmonths) VALUES
+('Замена моторного масла и масляного фильтра', 10000, 12),
+('Замена воздушного фильтра', 20000, 24),
+('Замена салонного фильтра', 15000, 12),
+('Замена тормозной жидкости', 0, 24),
+('Замена свечей зажигания', 30000, 36),
+('Замена охлаждающей жидкости', 60000, 48);
+
+ALTER TABLE orderitems ADD COLUMN scheduleID integer REFERENCES maintenanceschedules(id);
+
+CREATE TABLE reminders (
+id serial PRIMARY KEY,
+userID integer REFERENCES users(id),
+carID integer REFERENCES cars(id),
+scheduleID integer REFERENCES maintenanceschedules(id),
+text varchar NOT NULL,
+duemileage integer,
+duedate Date NOT NULL,
+created timestamp NOT NULL,
+sent boolean NOT NULL DEFAULT FALSE
+);
@@ -0,0 +1,18 @@
+-- Номер, цвет, двигатель и коробка передач машины, история изменений машины.
+
+ALTER TABLE cars
+ADD COLUMN plate varchar (12) NOT NULL DEFAULT '',
+ADD COLUMN platecountry varchar (2) NOT NULL DEFAULT '',
+ADD COLUMN color varchar (30) NOT NULL DEFAULT '',
+ADD COLUMN engine varchar (50) NOT NULL DEFAULT '',
+ADD COLUMN transmission varchar (20) NOT NULL DEFAULT '';
+
+CREATE TABLE caredits (
+id serial PRIMARY KEY,
+carID integer REFERENCES cars(id),
+userID integer REFERENCES users(id),
+date timestamp NOT NULL,
+field varchar (20) NOT NULL,
+oldvalue varchar NOT NULL,
+newvalue varchar NOT NULL
+);
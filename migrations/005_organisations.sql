@@ -0,0 +1,15 @@
+-- Организации с ролями участников и машины организаций.
+
+CREATE TABLE organisations (
+id serial PRIMARY KEY,
+name varchar (100) NOT NULL
+);
+
+CREATE TABLE orgmembers (
+orgID integer REFERENCES organisations(id),
+userID integer REFERENCES users(id),
+role smallint NOT NULL,
+PRIMARY KEY (orgID, userID)
+);
+
+ALTER TABLE cars ADD COLUMN orgID integer REFERENCES organisations(id);
@@ -0,0 +1,11 @@
+-- Передача машины другому владельцу.
+
+CREATE TABLE cartransfers (
+id serial PRIMARY KEY,
+carID integer REFERENCES cars(id),
+fromUserID integer REFERENCES users(id),
+toUserID integer REFERENCES users(id),
+status smallint NOT NULL,
+created timestamp NOT NULL,
+resolved timestamp
+);
@@ -0,0 +1,19 @@
+-- Ид сообщений и отметки о прочтении вместо флага newmsgforuser в заказе.
+
+ALTER TABLE messages ADD COLUMN id serial PRIMARY KEY;
+
+CREATE TABLE messagereads (
+orderID integer REFERENCES orders(id),
+userID integer REFERENCES users(id),
+lastmessageid integer NOT NULL,
+PRIMARY KEY (orderID, userID)
+);
+
+-- Владелец прочитал все сообщения заказа, если у заказа не было флага нового сообщения,
+-- иначе - только свои сообщения.
+INSERT INTO messagereads(orderID, userID, lastmessageid)
+SELECT o.id, o.userID, max(m.id) FROM orders o JOIN messages m ON m.orderID = o.id
+WHERE o.userID IS NOT NULL AND (o.newmsgforuser = FALSE OR m.isadmin = FALSE)
+GROUP BY o.id, o.userID;
+
+ALTER TABLE orders DROP COLUMN newmsgforuser;
@@ -0,0 +1,10 @@
+-- Вложения сообщений.
+
+CREATE TABLE attachments (
+id serial PRIMARY KEY,
+messageID integer REFERENCES messages(id),
+filename varchar (255) NOT NULL,
+contenttype varchar (50) NOT NULL,
+size integer NOT NULL,
+hasthumbnail boolean NOT NULL DEFAULT FALSE
+);
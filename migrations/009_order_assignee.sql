@@ -0,0 +1,3 @@
+-- Сотрудник, назначенный на заказ.
+
+ALTER TABLE orders ADD COLUMN assigneeID integer REFERENCES users(id);
@@ -0,0 +1,11 @@
+-- Шаблоны сообщений сотрудников.
+
+CREATE TABLE messagetemplates (
+id serial PRIMARY KEY,
+name varchar (100) NOT NULL,
+text varchar NOT NULL
+);
+
+INSERT INTO messagetemplates(name, text) VALUES
+('Машина готова', '{customerName}, ваш автомобиль {carInfo} готов, его можно забрать. Стоимость работ: {cost} руб.'),
+('Согласование доп. работ', '{customerName}, при обслуживании {carInfo} обнаружены неисправности, требующие дополнительных работ. Пожалуйста, подтвердите их выполнение.');
@@ -0,0 +1,27 @@
+-- Настройки уведомлений пользователей и очередь уведомлений.
+
+ALTER TABLE orders ADD COLUMN appointmentNotified boolean NOT NULL DEFAULT FALSE;
+
+CREATE TABLE notificationprefs (
+userID integer REFERENCES users(id),
+channel varchar (10) NOT NULL,
+address varchar (255) NOT NULL,
+enabled boolean NOT NULL,
+PRIMARY KEY (userID, channel)
+);
+
+CREATE TABLE notifications (
+id serial PRIMARY KEY,
+userID integer REFERENCES users(id),
+channel varchar (10) NOT NULL,
+address varchar (255) NOT NULL,
+subject varchar NOT NULL,
+text varchar NOT NULL,
+created timestamp NOT NULL,
+attempts integer NOT NULL DEFAULT 0,
+nextattempt timestamp NOT NULL,
+sent timestamp,
+lasterror varchar
+);
+
+CREATE INDEX notifications_pending ON notifications(nextattempt) WHERE sent IS NULL;
@@ -0,0 +1,16 @@
+-- Телеграм-бот: привязка аккаунтов и сообщения бота по заказам.
+
+ALTER TABLE notifications ADD COLUMN orderID integer REFERENCES orders(id);
+
+CREATE TABLE telegramlinks (
+code varchar (36) PRIMARY KEY,
+userID integer REFERENCES users(id),
+created timestamp NOT NULL
+);
+
+CREATE TABLE telegrammessages (
+chatID bigint NOT NULL,
+messageID bigint NOT NULL,
+orderID integer REFERENCES orders(id),
+PRIMARY KEY (chatID, messageID)
+);
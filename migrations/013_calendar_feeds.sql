@@ -0,0 +1,7 @@
+-- Ссылки на календари записей.
+
+CREATE TABLE calendarfeeds (
+userID integer PRIMARY KEY REFERENCES users(id),
+token varchar (36) NOT NULL UNIQUE,
+created timestamp NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Язык, выбранный пользователем.
+
+ALTER TABLE users ADD COLUMN language varchar(2) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- Время последнего изменения заказа и номер ревизии для обновления событий в календарях.
+
+ALTER TABLE orders ADD COLUMN updated timestamp NOT NULL DEFAULT now();
+ALTER TABLE orders ADD COLUMN revision integer NOT NULL DEFAULT 0;
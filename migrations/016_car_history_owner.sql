@@ -0,0 +1,9 @@
+-- Показания одометра и заметки сервиса привязаны к машине, а не только к VIN,
+-- чтобы владелец, добавивший машину с тем же VIN, не видел историю предыдущего владельца.
+
+ALTER TABLE odometer ADD COLUMN carID integer REFERENCES cars(id);
+ALTER TABLE carnotes ADD COLUMN carID integer REFERENCES cars(id);
+
+UPDATE odometer SET carID = o.carID FROM orders o WHERE o.id = odometer.orderID;
+UPDATE odometer SET carID = (SELECT max(c.id) FROM cars c WHERE upper(c.vin) = odometer.vin) WHERE carID IS NULL;
+UPDATE carnotes SET carID = (SELECT max(c.id) FROM cars c WHERE upper(c.vin) = carnotes.vin);
@@ -0,0 +1,10 @@
+-- Коды перевода названий регламентов из начальных данных, чтобы напоминания приходили на языке владельца.
+
+ALTER TABLE maintenanceschedules ADD COLUMN code varchar(50);
+
+UPDATE maintenanceschedules SET code = 'schedule_oil_change' WHERE brand IS NULL AND name = 'Замена моторного масла и масляного фильтра';
+UPDATE maintenanceschedules SET code = 'schedule_air_filter' WHERE brand IS NULL AND name = 'Замена воздушного фильтра';
+UPDATE maintenanceschedules SET code = 'schedule_cabin_filter' WHERE brand IS NULL AND name = 'Замена салонного фильтра';
+UPDATE maintenanceschedules SET code = 'schedule_brake_fluid' WHERE brand IS NULL AND name = 'Замена тормозной жидкости';
+UPDATE maintenanceschedules SET code = 'schedule_spark_plugs' WHERE brand IS NULL AND name = 'Замена свечей зажигания';
+UPDATE maintenanceschedules SET code = 'schedule_coolant' WHERE brand IS NULL AND name = 'Замена охлаждающей жидкости';
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// TestLoadMigrations - миграции читаются, идут подряд, а последняя совпадает с версией схемы, которую ждет код.
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+
+	if len(migrations) != schemaVersion {
+		t.Fatalf("последняя миграция %d, а schemaVersion = %d", len(migrations), schemaVersion)
+	}
+	for _, migration := range migrations {
+		if migration.query == "" {
+			t.Errorf("пустая миграция %s", migration.name)
+		}
+	}
+}
+
+// TestSchemaFileVersion - bd.sql создает схему той же версии, что и миграции, иначе новая база
+// после создания из bd.sql получила бы миграции повторно или не получила бы их вовсе.
+func TestSchemaFileVersion(t *testing.T) {
+	data, err := os.ReadFile("bd.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match := regexp.MustCompile(`INSERT INTO schemaversion\(version\) VALUES \((\d+)\);`).FindSubmatch(data)
+	if match == nil {
+		t.Fatal("в bd.sql не записывается версия схемы")
+	}
+	version, _ := strconv.Atoi(string(match[1]))
+	if version != schemaVersion {
+		t.Fatalf("bd.sql создает схему версии %d, а последняя миграция %d", version, schemaVersion)
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// notificationChannels - все каналы уведомлений в порядке отображения пользователю.
+var notificationChannels = []string{ChannelEmail, ChannelSMS, ChannelWebhook, ChannelTelegram}
+
+// enqueueNotificationsQuery - начало запроса, который ставит уведомления в очередь по всем включенным
+// каналам получателей. Запрос должен выбрать из таблиц notificationprefs p и users u
+// ид пользователя, канал, адрес, а следом ид заказа, тему, текст и дату создания.
+// Для sms без указанного номера используется телефон из профиля.
+const enqueueNotificationsQuery = `INSERT INTO notifications(userid, channel, address, orderid, subject, text, created, nextattempt)
+	SELECT p.userid, p.channel, CASE WHEN p.address = '' THEN u.phone ELSE p.address END`
+
+// getNotificationPreferencesHandler - отдает пользователю настройки всех каналов уведомлений.
+func getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	rows, err := db.Query(`SELECT channel, address, enabled FROM notificationprefs WHERE userid = $1`, id)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД настроек уведомлений пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	defer rows.Close()
+
+	saved := make(map[string]*NotificationPreference)
+	for rows.Next() {
+		preference := NotificationPreference{}
+		err = rows.Scan(&preference.Channel, &preference.Address, &preference.Enabled)
+		if err != nil {
+			log.Printf("Ошибка. При выборке из БД настроек уведомлений пользователя(ид =  %s): %s\n", id, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+		saved[preference.Channel] = &preference
+	}
+
+	result := make([]*NotificationPreference, 0, len(notificationChannels))
+	for _, channel := range notificationChannels {
+		preference, ok := saved[channel]
+		if !ok {
+			preference = &NotificationPreference{Channel: channel}
+		}
+		_, preference.Available = notifiers[channel]
+		result = append(result, preference)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// setNotificationPreferenceHandler - включает или выключает канал уведомлений пользователя
+// и сохраняет адрес доставки: почту, номер телефона или url вебхука.
+func setNotificationPreferenceHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	preference := &NotificationPreference{
+		Channel: r.FormValue("channel"),
+		Address: strings.TrimSpace(r.FormValue("address")),
+		Enabled: r.FormValue("enabled") == "true",
+	}
+
+	resultOfValidation := ValidateNotificationPreference(preference)
+	if len(resultOfValidation) != 0 {
+		writeValidationErrors(w, resultOfValidation)
+		return
+	}
+
+	if _, ok := notifiers[preference.Channel]; !ok && preference.Enabled {
+		writeFieldError(w, "channel", CodeChannelDisabled)
+		return
+	}
+
+	_, err := db.Exec(`INSERT INTO notificationprefs(userid, channel, address, enabled) VALUES($1, $2, $3, $4)
+	ON CONFLICT (userid, channel) DO UPDATE SET address = EXCLUDED.address, enabled = EXCLUDED.enabled`,
+		id, preference.Channel, preference.Address, preference.Enabled)
+	if err != nil {
+		log.Printf("Ошибка. При сохранении в БД настройки уведомлений пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	log.Printf("Инфо. Пользователь (ид = %s) изменил настройку уведомлений %s (включено = %v)", id, preference.Channel, preference.Enabled)
+	writeMessage(w, MsgPreferenceSaved)
+}
+
+// ValidateNotificationPreference - проверяет настройку канала уведомлений на бизнес правила
+func ValidateNotificationPreference(preference *NotificationPreference) ValidationErrors {
+	resultOfValidation := ValidationErrors{}
+
+	if len(preference.Address) > 255 {
+		resultOfValidation.add("address", CodeAddressTooLong, 255)
+	}
+
+	switch preference.Channel {
+	case ChannelEmail:
+		if address, err := mail.ParseAddress(preference.Address); err != nil || address.Address != preference.Address {
+			resultOfValidation.add("address", CodeInvalidEmail)
+		}
+	case ChannelSMS:
+		// если номер не указан, то используется телефон из профиля
+	case ChannelWebhook:
+		address, err := url.Parse(preference.Address)
+		if err != nil || (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" {
+			resultOfValidation.add("address", CodeInvalidWebhook)
+		} else if ip := net.ParseIP(address.Hostname()); ip != nil && !isPublicIP(ip) {
+			resultOfValidation.add("address", CodeInvalidWebhook)
+		}
+	case ChannelTelegram:
+		resultOfValidation.add("channel", CodeTelegramViaBot)
+	default:
+		resultOfValidation.add("channel", CodeUnknownChannel)
+	}
+
+	return resultOfValidation
+}
+
+// localizedText - текст уведомления, который переводится на язык получателя при постановке в очередь.
+type localizedText struct {
+	code string
+	args []interface{}
+}
+
+// newLocalizedText - конструктор текста уведомления по коду из каталога и подстановкам.
+func newLocalizedText(code string, args ...interface{}) localizedText {
+	return localizedText{code: code, args: args}
+}
+
+// sqlExecutor - общие методы *sql.DB и *sql.Tx, чтобы уведомления можно было ставить в очередь в транзакции.
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// notifyUser - ставит уведомление в очередь по всем включенным каналам пользователя
+// на языке из его настроек. Если уведомление относится к заказу, то передается ид заказа, иначе пустая строка.
+func notifyUser(exec sqlExecutor, userID string, orderID string, subject localizedText, text localizedText) error {
+	var lang string
+	err := exec.QueryRow(`SELECT language FROM users WHERE id = $1`, userID).Scan(&lang)
+	if err != nil {
+		return err
+	}
+	if lang == "" {
+		lang = defaultLanguage
+	}
+
+	now := time.Now()
+	_, err = exec.Exec(enqueueNotificationsQuery+`, $2::integer, $3, $4, $5, $5
+	FROM notificationprefs p JOIN users u ON u.id = p.userid WHERE p.userid = $1 AND p.enabled`,
+		userID, sql.NullString{String: orderID, Valid: orderID != ""},
+		localize(lang, subject.code, subject.args...), localize(lang, text.code, text.args...), now)
+	return err
+}
+
+// notifyOrderParticipants - ставит уведомление в очередь всем, кто видит заказ.
+// Ошибки только логируются, так как уведомление не должно мешать основному действию.
+func notifyOrderParticipants(orderID string, subject localizedText, text localizedText) {
+	userIDs, err := getOrderParticipants(orderID)
+	if err != nil {
+		log.Printf("Ошибка. При поиске участников заказа(ид = %s) для уведомления: %s\n", orderID, err.Error())
+		return
+	}
+
+	for _, userID := range userIDs {
+		err = notifyUser(db, userID, orderID, subject, text)
+		if err != nil {
+			log.Printf("Ошибка. При постановке в очередь уведомления пользователю(ид = %s): %s\n", userID, err.Error())
+		}
+	}
+}
+
+// notifyReminders - ставит в очередь уведомления о напоминаниях об обслуживании, которые еще не отправлялись.
+// Текст напоминания уже переведен на язык владельца при его создании.
+func notifyReminders() {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Ошибка. При постановке в очередь уведомлений о напоминаниях: " + err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`UPDATE reminders SET sent = TRUE WHERE sent = FALSE RETURNING userid, text`)
+	if err != nil {
+		log.Println("Ошибка. При постановке в очередь уведомлений о напоминаниях: " + err.Error())
+		return
+	}
+
+	type dueReminder struct{ userID, text string }
+	due := make([]dueReminder, 0)
+	for rows.Next() {
+		reminder := dueReminder{}
+		err = rows.Scan(&reminder.userID, &reminder.text)
+		if err != nil {
+			rows.Close()
+			log.Println("Ошибка. При постановке в очередь уведомлений о напоминаниях: " + err.Error())
+			return
+		}
+		due = append(due, reminder)
+	}
+	rows.Close()
+
+	for _, reminder := range due {
+		err = notifyUser(tx, reminder.userID, "", newLocalizedText(NotifyReminderSubject), newLocalizedText(NotifyMessageText, reminder.text))
+		if err != nil {
+			log.Println("Ошибка. При постановке в очередь уведомлений о напоминаниях: " + err.Error())
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Println("Ошибка. При постановке в очередь уведомлений о напоминаниях: " + err.Error())
+	}
+}
+
+// notifyUpcomingAppointments - ставит в очередь уведомления о записях на обслуживание,
+// до которых осталось не больше appointmentLeadDays дней. О каждой записи уведомляется один раз.
+func notifyUpcomingAppointments() {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Ошибка. При постановке в очередь уведомлений о записях на обслуживание: " + err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`UPDATE orders o SET appointmentnotified = TRUE FROM cars c
+	WHERE c.id = o.carid AND o.appointmentnotified = FALSE AND o.status NOT IN ($1, $2) AND o.date BETWEEN $3 AND $4
+	RETURNING o.id, o.userid, o.date, c.brand || ' ' || c.model`,
+		StatusClosed, StatusCancelled, today, today.AddDate(0, 0, appointmentLeadDays))
+	if err != nil {
+		log.Println("Ошибка. При постановке в очередь уведомлений о записях на обслуживание: " + err.Error())
+		return
+	}
+
+	type dueAppointment struct {
+		orderID, userID, car string
+		date                 time.Time
+	}
+	due := make([]dueAppointment, 0)
+	for rows.Next() {
+		appointment := dueAppointment{}
+		err = rows.Scan(&appointment.orderID, &appointment.userID, &appointment.date, &appointment.car)
+		if err != nil {
+			rows.Close()
+			log.Println("Ошибка. При постановке в очередь уведомлений о записях на обслуживание: " + err.Error())
+			return
+		}
+		due = append(due, appointment)
+	}
+	rows.Close()
+
+	for _, appointment := range due {
+		err = notifyUser(tx, appointment.userID, appointment.orderID, newLocalizedText(NotifyAppointmentSubject),
+			newLocalizedText(NotifyAppointmentText, appointment.date.Format("02.01.2006"), appointment.car, appointment.orderID))
+		if err != nil {
+			log.Println("Ошибка. При постановке в очередь уведомлений о записях на обслуживание: " + err.Error())
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Println("Ошибка. При постановке в очередь уведомлений о записях на обслуживание: " + err.Error())
+	}
+}
+
+// notificationsWorker - фоновая задача, которая периодически отправляет уведомления из очереди.
+// Завершается, когда отменяется ctx.
+func notificationsWorker(ctx context.Context) {
+	ticker := time.NewTicker(notificationsInterval)
+	defer ticker.Stop()
+
+	for {
+		for sendNotifications() == notificationsBatchSize && ctx.Err() == nil { // очередь не разобрана до конца
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendNotifications - резервирует пачку уведомлений, которым пора отправляться, и отправляет их.
+// Резерв на notificationLease не дает другим экземплярам сервиса отправить те же уведомления,
+// а если экземпляр упадет во время отправки, уведомления будут отправлены после истечения резерва.
+// Возвращает количество обработанных уведомлений.
+func sendNotifications() int {
+	now := time.Now()
+	rows, err := db.Query(`UPDATE notifications SET attempts = attempts + 1, nextattempt = $1
+	WHERE id IN (SELECT id FROM notifications WHERE sent IS NULL AND attempts < $2 AND nextattempt <= $3
+		ORDER BY nextattempt LIMIT $4 FOR UPDATE SKIP LOCKED)
+	RETURNING id, userid, channel, address, COALESCE(orderid::text, ''), subject, text, created, attempts`,
+		now.Add(notificationLease), notificationMaxAttempts, now, notificationsBatchSize)
+	if err != nil {
+		log.Println("Ошибка. При выборке из БД уведомлений для отправки: " + err.Error())
+		return 0
+	}
+
+	batch := make([]*Notification, 0, notificationsBatchSize)
+	for rows.Next() {
+		notification := Notification{}
+		err = rows.Scan(&notification.ID, &notification.UserID, &notification.Channel, &notification.Address, &notification.OrderID,
+			&notification.Subject, &notification.Text, &notification.Created, &notification.Attempts)
+		if err != nil {
+			log.Println("Ошибка. При выборке из БД уведомлений для отправки: " + err.Error())
+			break
+		}
+		batch = append(batch, &notification)
+	}
+	rows.Close()
+
+	for _, notification := range batch {
+		sendNotification(notification)
+	}
+
+	return len(batch)
+}
+
+// sendNotification - отправляет уведомление и сохраняет результат отправки.
+// При ошибке следующая попытка откладывается, каждый раз вдвое дольше.
+func sendNotification(notification *Notification) {
+	notifier, ok := notifiers[notification.Channel]
+
+	var err error
+	if ok {
+		err = notifier.Send(notification)
+	} else {
+		err = fmt.Errorf("канал %s не настроен на сервере", notification.Channel)
+	}
+
+	if err == nil {
+		_, err = db.Exec(`UPDATE notifications SET sent = $1, lasterror = NULL WHERE id = $2`, time.Now(), notification.ID)
+		if err != nil {
+			log.Printf("Ошибка. При отметке уведомления(ид = %s) отправленным: %s\n", notification.ID, err.Error())
+		}
+		return
+	}
+
+	log.Printf("Ошибка. При отправке уведомления(ид = %s, канал = %s, попытка %d): %s\n",
+		notification.ID, notification.Channel, notification.Attempts, err.Error())
+	if notification.Attempts >= notificationMaxAttempts {
+		log.Printf("Инфо. Уведомление (ид = %s) не будет доставлено, исчерпаны попытки отправки", notification.ID)
+	}
+
+	delay := notificationRetryDelay << uint(notification.Attempts-1)
+	_, err = db.Exec(`UPDATE notifications SET nextattempt = $1, lasterror = $2 WHERE id = $3`,
+		time.Now().Add(delay), err.Error(), notification.ID)
+	if err != nil {
+		log.Printf("Ошибка. При сохранении результата отправки уведомления(ид = %s): %s\n", notification.ID, err.Error())
+	}
+}
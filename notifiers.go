@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/STEJLS/ServiceStation/XMLconfig"
+)
+
+// Notifier - канал доставки уведомлений пользователю.
+type Notifier interface {
+	Send(notification *Notification) error
+}
+
+// notifiers - доступные каналы уведомлений, ключ - название канала.
+var notifiers = map[string]Notifier{}
+
+// initNotifiers - создает каналы уведомлений, настроенные в конфигурации.
+// Вебхуки доступны всегда, почта и sms - только если указан сервер.
+func initNotifiers(config XMLconfig.Notifications) {
+	client := &http.Client{Timeout: notifierTimeout}
+
+	notifiers[ChannelWebhook] = &webhookNotifier{client: newWebhookClient()}
+
+	if config.SMTP.Host != "" {
+		notifiers[ChannelEmail] = &emailNotifier{config: config.SMTP}
+	}
+
+	if config.SMS.URL != "" {
+		notifiers[ChannelSMS] = &smsNotifier{config: config.SMS, client: client}
+	}
+}
+
+// emailNotifier - отправляет уведомления письмом через smtp сервер.
+type emailNotifier struct {
+	config XMLconfig.SMTP
+}
+
+// Send - отправляет уведомление письмом на адрес пользователя.
+func (notifier *emailNotifier) Send(notification *Notification) error {
+	var auth smtp.Auth
+	if notifier.config.User != "" {
+		auth = smtp.PlainAuth("", notifier.config.User, notifier.config.Password, notifier.config.Host)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", notifier.config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", notification.Address)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notification.Subject))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	message.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	body := base64.StdEncoding.EncodeToString([]byte(notification.Text))
+	for len(body) > 76 {
+		message.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	message.WriteString(body + "\r\n")
+
+	addr := notifier.config.Host + ":" + strconv.Itoa(notifier.config.Port)
+	return smtp.SendMail(addr, auth, notifier.config.From, []string{notification.Address}, message.Bytes())
+}
+
+// smsNotifier - отправляет уведомления через http шлюз sms рассылок.
+// Шлюз принимает POST запрос с полями формы to, sender и text,
+// ключ доступа передается в заголовке Authorization.
+type smsNotifier struct {
+	config XMLconfig.SMS
+	client *http.Client
+}
+
+// Send - отправляет уведомление по sms на номер пользователя.
+func (notifier *smsNotifier) Send(notification *Notification) error {
+	form := url.Values{
+		"to":     {notification.Address},
+		"sender": {notifier.config.Sender},
+		"text":   {notification.Subject + ". " + notification.Text},
+	}
+
+	request, err := http.NewRequest(http.MethodPost, notifier.config.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if notifier.config.APIKey != "" {
+		request.Header.Set("Authorization", "Bearer "+notifier.config.APIKey)
+	}
+
+	return doNotifierRequest(notifier.client, request)
+}
+
+// webhookNotifier - отправляет уведомления POST запросом с json телом на адрес, указанный пользователем.
+type webhookNotifier struct {
+	client *http.Client
+}
+
+// newWebhookClient - http клиент для вебхуков. Адрес вебхука задает пользователь, поэтому клиент
+// не ходит через прокси, не следует перенаправлениям и не соединяется с адресами внутренней сети:
+// адрес проверяется при соединении, после разрешения имени, чтобы его нельзя было подменить через DNS.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: notifierTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("адрес %s не из внешней сети", host)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout:   notifierTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: notifierTimeout},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// sharedAddressSpace - адреса операторов связи за NAT (RFC 6598), тоже недоступны из интернета.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP - адрес из внешней сети: не локальный, не из частных диапазонов и не групповой.
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() && !sharedAddressSpace.Contains(ip)
+}
+
+// Send - отправляет уведомление на вебхук пользователя.
+func (notifier *webhookNotifier) Send(notification *Notification) error {
+	data, err := json.Marshal(struct {
+		ID      string
+		OrderID string
+		Subject string
+		Text    string
+		Created string
+	}{notification.ID, notification.OrderID, notification.Subject, notification.Text, notification.Created.Format("2006-01-02T15:04:05Z07:00")})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, notification.Address, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Notification-ID", notification.ID)
+
+	return doNotifierRequest(notifier.client, request)
+}
+
+// doNotifierRequest - выполняет запрос к внешнему сервису и считает ошибкой любой ответ кроме 2xx.
+func doNotifierRequest(client *http.Client, request *http.Request) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 200))
+		return fmt.Errorf("сервис ответил %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestIsPublicIP - адреса внутренней сети не считаются внешними.
+func TestIsPublicIP(t *testing.T) {
+	for address, public := range map[string]bool{
+		"8.8.8.8":          true,
+		"2001:4860::8888":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::ffff:127.0.0.1": false,
+		"224.0.0.1":        false,
+	} {
+		if isPublicIP(net.ParseIP(address)) != public {
+			t.Errorf("isPublicIP(%s) != %v", address, public)
+		}
+	}
+}
+
+// TestWebhookRejectsInternalAddress - вебхук не отправляется на адрес внутренней сети.
+func TestWebhookRejectsInternalAddress(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+	defer server.Close()
+
+	notifier := &webhookNotifier{client: newWebhookClient()}
+	err := notifier.Send(&Notification{ID: "1", Address: server.URL, Created: time.Now()})
+	if err == nil || called {
+		t.Fatalf("вебхук на %s отправлен, ошибка: %v", server.URL, err)
+	}
+}
+
+// TestWebhookDoesNotFollowRedirects - перенаправление не выполняется и считается ошибкой доставки.
+func TestWebhookDoesNotFollowRedirects(t *testing.T) {
+	followed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			followed = true
+			return
+		}
+		http.Redirect(w, r, "/internal", http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	client := newWebhookClient()
+	client.Transport = server.Client().Transport
+	notifier := &webhookNotifier{client: client}
+	err := notifier.Send(&Notification{ID: "1", Address: server.URL, Created: time.Now()})
+	if err == nil || followed {
+		t.Fatalf("перенаправление выполнено, ошибка: %v", err)
+	}
+}
+
+// TestStatusNotifications - для каждого статуса, в который может перейти заказ, есть уведомление на всех языках.
+func TestStatusNotifications(t *testing.T) {
+	for _, statuses := range orderTransitions {
+		for _, status := range statuses {
+			notification, ok := statusNotifications[status]
+			if !ok {
+				t.Errorf("нет уведомления о переходе в статус %d", status)
+				continue
+			}
+			for _, lang := range supportedLanguages {
+				for _, code := range notification {
+					if _, ok := catalogue[lang][code]; !ok {
+						t.Errorf("нет текста %s на языке %s", code, lang)
+					}
+				}
+			}
+		}
+	}
+}
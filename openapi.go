@@ -0,0 +1,630 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// openAPIPath - путь, по которому отдается спецификация API.
+const openAPIPath = "/openapi.json"
+
+// Уровни доступа к операциям API.
+const (
+	accessPublic = "public" // без авторизации
+	accessUser   = "user"   // авторизованный пользователь
+	accessStaff  = "staff"  // сотрудник сервиса
+)
+
+// apiParam - описание параметра операции API. Параметры пути определяются по шаблону маршрута,
+// остальные передаются в строке запроса для GET и DELETE и в теле запроса для остальных методов.
+type apiParam struct {
+	name     string
+	kind     string // string, integer, boolean или file
+	required bool
+	about    string
+}
+
+// requiredParam - конструктор обязательного параметра.
+func requiredParam(name string, kind string, about string) apiParam {
+	return apiParam{name: name, kind: kind, required: true, about: about}
+}
+
+// optionalParam - конструктор необязательного параметра.
+func optionalParam(name string, kind string, about string) apiParam {
+	return apiParam{name: name, kind: kind, about: about}
+}
+
+// apiOperation - описание операции API для спецификации OpenAPI.
+// Если response не nil, то ответ - json этого типа, если задан mediaType - файл или поток этого типа,
+// если message - текст об успешном выполнении на языке ответа, иначе ответ пустой.
+type apiOperation struct {
+	summary   string
+	tag       string
+	params    []apiParam
+	response  interface{}
+	mediaType string
+	message   bool
+	jsonBody  bool // тело запроса принимается только json объектом
+}
+
+// apiOperations - описания всех операций API по ключу "МЕТОД шаблон".
+// Маршрут без описания не дает запустить сервер, см. buildOpenAPIDocument.
+var apiOperations = map[string]*apiOperation{
+	"GET " + openAPIPath: {summary: "Спецификация API в формате OpenAPI 3", tag: "Служебное", response: map[string]interface{}{}},
+	"GET /health/live":   {summary: "Сервис жив и отвечает на запросы", tag: "Служебное", response: &struct{ Status string }{}},
+	"GET /health/ready": {summary: "Готовность сервиса: база данных, хранилище файлов и версия схемы БД. Если не готов, то ответ 503",
+		tag: "Служебное", response: &Readiness{}},
+	"GET /version": {summary: "Коммит сборки и версии схемы БД", tag: "Служебное", response: &BuildInfo{}},
+
+	"POST /users": {summary: "Регистрация пользователя", tag: "Пользователи", message: true,
+		params: []apiParam{
+			requiredParam("login", "string", "Логин, не короче 6 символов"),
+			requiredParam("password", "string", "Пароль, не короче 6 символов"),
+			requiredParam("name", "string", "Имя"),
+			requiredParam("lastName", "string", "Фамилия"),
+			requiredParam("phone", "string", "Телефон"),
+			optionalParam("language", "string", "Язык интерфейса: ru, en или kk"),
+			optionalParam("profileImage", "file", "Аватарка"),
+		}},
+	"POST /sessions": {summary: "Вход, устанавливает cookie token", tag: "Пользователи", message: true,
+		params: []apiParam{
+			requiredParam("login", "string", "Логин"),
+			requiredParam("password", "string", "Пароль"),
+		}},
+	"DELETE /sessions":   {summary: "Выход", tag: "Пользователи", message: true},
+	"GET /profile":       {summary: "Профиль текущего пользователя", tag: "Пользователи", response: &User{}},
+	"GET /profile/image": {summary: "Аватарка текущего пользователя", tag: "Пользователи", mediaType: "image/*"},
+	"PUT /profile/language": {summary: "Язык интерфейса пользователя", tag: "Пользователи", message: true,
+		params: []apiParam{
+			optionalParam("language", "string", "ru, en или kk. Пустое значение - язык по заголовку Accept-Language"),
+		}},
+
+	"GET /cars": {summary: "Машины пользователя и его организаций", tag: "Машины", response: []*Car{}},
+	"POST /cars": {summary: "Добавление машины", tag: "Машины", message: true,
+		params: append(carParams(), optionalParam("orgID", "integer", "Организация, в автопарк которой добавляется машина"))},
+	"PUT /cars/{id}": {summary: "Изменение данных машины", tag: "Машины", message: true,
+		params: append([]apiParam{requiredParam("id", "integer", "Ид машины")}, carParams()...)},
+	"DELETE /cars/{id}": {summary: "Удаление машины", tag: "Машины", message: true,
+		params: []apiParam{requiredParam("id", "integer", "Ид машины")}},
+	"GET /cars/{id}/edits": {summary: "История изменений данных машины", tag: "Машины", response: []*CarEdit{},
+		params: []apiParam{requiredParam("id", "integer", "Ид машины")}},
+	"POST /cars/{carID}/odometer": {summary: "Показание одометра", tag: "Машины", message: true,
+		params: []apiParam{
+			requiredParam("carID", "integer", "Ид машины"),
+			requiredParam("mileage", "integer", "Пробег в км, не меньше последнего показания"),
+		}},
+	"POST /cars/{carID}/transfers": {summary: "Запрос на передачу машины другому пользователю", tag: "Машины", message: true,
+		params: []apiParam{
+			requiredParam("carID", "integer", "Ид машины"),
+			requiredParam("login", "string", "Логин получателя"),
+		}},
+	"GET /transfers": {summary: "Входящие и исходящие запросы на передачу машин", tag: "Машины", response: []*CarTransfer{}},
+	"POST /transfers/{id}/accept": {summary: "Принять машину", tag: "Машины", message: true,
+		params: []apiParam{requiredParam("id", "integer", "Ид запроса на передачу")}},
+	"POST /transfers/{id}/decline": {summary: "Отклонить или отменить передачу машины", tag: "Машины", message: true,
+		params: []apiParam{requiredParam("id", "integer", "Ид запроса на передачу")}},
+
+	"GET /vin/{vin}": {summary: "Расшифровка VIN", tag: "VIN", response: &VINInfo{},
+		params: []apiParam{requiredParam("vin", "string", "VIN")}},
+	"GET /vin/{vin}/history": {summary: "История обслуживания машины", tag: "VIN", response: &CarHistory{},
+		params: []apiParam{requiredParam("vin", "string", "VIN")}},
+	"GET /vin/{vin}/history.pdf": {summary: "История обслуживания машины в pdf", tag: "VIN",
+		mediaType: "application/pdf", params: []apiParam{requiredParam("vin", "string", "VIN")}},
+
+	"GET /orders": {summary: "Заказы пользователя", tag: "Заказы", response: []*Order{},
+		params: []apiParam{optionalParam("isclosed", "boolean", "true - только закрытые, иначе только открытые")}},
+	"POST /orders": {summary: "Запись на обслуживание", tag: "Заказы", message: true,
+		params: []apiParam{
+			requiredParam("carID", "integer", "Ид машины"),
+			requiredParam("textInfo", "string", "Описание работ"),
+			requiredParam("day", "integer", "День записи"),
+			requiredParam("month", "integer", "Месяц записи"),
+			requiredParam("year", "integer", "Год записи"),
+			optionalParam("cost", "string", "Стоимость"),
+			optionalParam("mileage", "integer", "Пробег в км"),
+		}},
+	"GET /orders/{orderID}/messages": {summary: "Переписка по заказу", tag: "Заказы", response: []*Message{},
+		params: []apiParam{requiredParam("orderID", "integer", "Ид заказа")}},
+	"POST /orders/{orderID}/messages": {summary: "Сообщение по заказу", tag: "Заказы", params: messageParams()},
+	"POST /orders/{orderID}/read": {summary: "Отметить сообщения заказа прочитанными", tag: "Заказы",
+		params: []apiParam{
+			requiredParam("orderID", "integer", "Ид заказа"),
+			optionalParam("messageID", "integer", "Последнее прочитанное сообщение, по умолчанию все"),
+		}},
+	"GET /orders/events": {summary: "Поток событий заказов (Server-Sent Events, OrderEvent в data)", tag: "Заказы",
+		mediaType: "text/event-stream"},
+	"GET /unread": {summary: "Количество непрочитанных сообщений", tag: "Заказы", response: &UnreadCounts{}},
+	"GET /attachments/{id}": {summary: "Вложение сообщения", tag: "Заказы", mediaType: "application/octet-stream",
+		params: []apiParam{
+			requiredParam("id", "integer", "Ид вложения"),
+			optionalParam("thumbnail", "boolean", "true - миниатюра изображения"),
+		}},
+	"GET /reminders": {summary: "Напоминания об обслуживании", tag: "Заказы", response: []*Reminder{}},
+
+	"GET /notifications/preferences": {summary: "Настройки каналов уведомлений", tag: "Уведомления", response: []*NotificationPreference{}},
+	"PUT /notifications/preferences/{channel}": {summary: "Настройка канала уведомлений", tag: "Уведомления", message: true,
+		params: []apiParam{
+			requiredParam("channel", "string", "email, sms или webhook"),
+			optionalParam("address", "string", "Адрес доставки, для sms по умолчанию телефон из профиля"),
+			optionalParam("enabled", "boolean", "Включен ли канал"),
+		}},
+	"POST /telegram/link":   {summary: "Код привязки telegram", tag: "Уведомления", response: &struct{ Code, Link string }{}},
+	"DELETE /telegram/link": {summary: "Отвязать telegram", tag: "Уведомления", message: true},
+	"GET /calendar/feed":    {summary: "Ссылка на календарь записей", tag: "Уведомления", response: &struct{ URL string }{}},
+	"POST /calendar/feed": {summary: "Новая ссылка на календарь, старая перестает работать", tag: "Уведомления",
+		response: &struct{ URL string }{}},
+
+	"GET /organisations": {summary: "Организации пользователя", tag: "Организации", response: []*Organisation{}},
+	"POST /organisations": {summary: "Создание организации", tag: "Организации", message: true,
+		params: []apiParam{requiredParam("name", "string", "Название")}},
+	"POST /organisations/{orgID}/members": {summary: "Добавление участника", tag: "Организации", message: true,
+		params: []apiParam{
+			requiredParam("orgID", "integer", "Ид организации"),
+			requiredParam("login", "string", "Логин пользователя"),
+			requiredParam("role", "integer", "1 - менеджер автопарка, 2 - водитель"),
+		}},
+	"DELETE /organisations/{orgID}/members/{userID}": {summary: "Удаление участника", tag: "Организации", message: true,
+		params: []apiParam{
+			requiredParam("orgID", "integer", "Ид организации"),
+			requiredParam("userID", "integer", "Ид пользователя"),
+		}},
+
+	"GET /admin/inbox": {summary: "Входящие переписки", tag: "Сотрудники", response: []*InboxConversation{},
+		params: []apiParam{
+			optionalParam("status", "integer", "Статус заказа"),
+			optionalParam("assignee", "string", "none, me или ид сотрудника"),
+			optionalParam("unanswered", "boolean", "true - только без ответа сотрудника"),
+			optionalParam("query", "string", "Поиск по тексту сообщений"),
+			optionalParam("offset", "integer", "Смещение страницы"),
+		}},
+	"GET /admin/orders/{orderID}/messages": {summary: "Переписка по заказу", tag: "Сотрудники",
+		response: []*Message{}, params: []apiParam{requiredParam("orderID", "integer", "Ид заказа")}},
+	"POST /admin/orders/{orderID}/messages": {summary: "Сообщение сотрудника по заказу", tag: "Сотрудники",
+		params: append(messageParams(), optionalParam("templateID", "integer", "Шаблон, которым заполняется текст"))},
+	"PUT /admin/orders/{orderID}/assignee": {summary: "Назначение ответственного", tag: "Сотрудники", message: true,
+		params: []apiParam{
+			requiredParam("orderID", "integer", "Ид заказа"),
+			optionalParam("assigneeID", "integer", "Ид сотрудника, пустое значение снимает назначение"),
+		}},
+	"POST /admin/orders/{orderID}/close": {summary: "Закрытие заказа", tag: "Сотрудники",
+		params: []apiParam{
+			requiredParam("orderID", "integer", "Ид заказа"),
+			optionalParam("mileage", "integer", "Пробег при закрытии в км"),
+		}},
+	"POST /admin/orders/{orderID}/cancel": {summary: "Отмена заказа", tag: "Сотрудники", message: true,
+		params: []apiParam{
+			requiredParam("orderID", "integer", "Ид заказа"),
+		}},
+	"PUT /admin/orders/{orderID}/date": {summary: "Перенос записи по заказу", tag: "Сотрудники", message: true,
+		params: []apiParam{
+			requiredParam("orderID", "integer", "Ид заказа"),
+			requiredParam("day", "integer", "Новый день записи"),
+			requiredParam("month", "integer", "Новый месяц записи"),
+			requiredParam("year", "integer", "Новый год записи"),
+		}},
+	"POST /admin/orders/{orderID}/items": {summary: "Позиция заказа", tag: "Сотрудники",
+		params: []apiParam{
+			requiredParam("orderID", "integer", "Ид заказа"),
+			requiredParam("name", "string", "Наименование работы или запчасти"),
+			requiredParam("quantity", "string", "Количество"),
+			requiredParam("cost", "string", "Стоимость"),
+			optionalParam("scheduleID", "integer", "Регламент обслуживания, который закрывает работа"),
+		}},
+	"POST /admin/vin/{vin}/notes": {summary: "Заметка о машине", tag: "Сотрудники",
+		params: []apiParam{
+			requiredParam("vin", "string", "VIN"),
+			requiredParam("text", "string", "Текст заметки"),
+		}},
+	"GET /admin/templates": {summary: "Шаблоны сообщений", tag: "Сотрудники", response: []*MessageTemplate{}},
+	"POST /admin/templates": {summary: "Создание шаблона", tag: "Сотрудники", message: true,
+		params: templateParams()},
+	"PUT /admin/templates/{id}": {summary: "Изменение шаблона", tag: "Сотрудники", message: true,
+		params: append([]apiParam{requiredParam("id", "integer", "Ид шаблона")}, templateParams()...)},
+	"DELETE /admin/templates/{id}": {summary: "Удаление шаблона", tag: "Сотрудники", message: true,
+		params: []apiParam{requiredParam("id", "integer", "Ид шаблона")}},
+	"GET /admin/templates/{templateID}/preview": {summary: "Текст шаблона с подстановками по заказу", tag: "Сотрудники",
+		response: &TemplatePreview{},
+		params: []apiParam{
+			requiredParam("templateID", "integer", "Ид шаблона"),
+			requiredParam("orderID", "integer", "Ид заказа"),
+		}},
+}
+
+// graphqlOperation - описание запросов GraphQL. Схема данных отдается самим GraphQL по запросу интроспекции.
+var graphqlOperation = &apiOperation{summary: "Запрос GraphQL к данным личного кабинета. Методом POST - json объектом, " +
+	"методом GET - в строке запроса", tag: "Служебное", jsonBody: true, response: map[string]interface{}{},
+	params: []apiParam{
+		requiredParam("query", "string", "Текст запроса"),
+		optionalParam("operationName", "string", "Операция, если в запросе их несколько"),
+		optionalParam("variables", "string", "Значения переменных запроса: json объект, в строке запроса - json строкой"),
+	}}
+
+// calendarFeedOperation - описание календаря записей по секретной ссылке, см. getCalendarFeedHandler.
+var calendarFeedOperation = &apiOperation{summary: "Календарь записей в формате iCalendar по секретной ссылке, " +
+	"к токену можно добавить .ics", tag: "Уведомления", mediaType: "text/calendar",
+	params: []apiParam{requiredParam("token", "string", "Токен из ссылки на календарь")}}
+
+// carParams - параметры формы машины, см. getAndCheckCar.
+func carParams() []apiParam {
+	return []apiParam{
+		requiredParam("brand", "string", "Марка"),
+		requiredParam("model", "string", "Модель"),
+		requiredParam("vin", "string", "VIN"),
+		requiredParam("year", "integer", "Год выпуска"),
+		optionalParam("plate", "string", "Номерной знак"),
+		optionalParam("plateCountry", "string", "Страна регистрации номерного знака, ISO 3166-1 alpha-2"),
+		optionalParam("color", "string", "Цвет"),
+		optionalParam("engine", "string", "Двигатель"),
+		optionalParam("transmission", "string", "manual, automatic, robot или cvt"),
+	}
+}
+
+// messageParams - параметры формы сообщения, см. getAndCheckMessage.
+func messageParams() []apiParam {
+	return []apiParam{
+		requiredParam("orderID", "integer", "Ид заказа"),
+		optionalParam("text", "string", "Текст, обязателен без вложений"),
+		optionalParam(formAttachmentName, "file", fmt.Sprintf("Вложения, не более %d", maxAttachmentsPerMessage)),
+	}
+}
+
+// templateParams - параметры формы шаблона сообщения.
+func templateParams() []apiParam {
+	return []apiParam{
+		requiredParam("name", "string", "Название"),
+		requiredParam("text", "string", "Текст с подстановками"),
+	}
+}
+
+// operationIDReplacer - убирает из шаблона маршрута символы, которые генераторы клиентов не принимают в operationId.
+var operationIDReplacer = strings.NewReplacer("{", "", "}", "", ".", "_")
+
+// openAPIDocument - спецификация API, собранная при запуске сервера.
+var openAPIDocument []byte
+
+// openAPIHandler - отдает спецификацию API.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err := w.Write(openAPIDocument)
+	if err != nil {
+		log.Println("Ошибка. При отдачи спецификации API: " + err.Error())
+	}
+}
+
+// buildOpenAPIDocument - собирает спецификацию OpenAPI 3 по таблице маршрутов: маршруты API описываются
+// по apiOperations, остальные пути - описаниями, с которыми они зарегистрированы.
+// Возвращает ошибку, если у маршрута нет описания или описание не соответствует ни одному маршруту,
+// чтобы спецификация не расходилась с тем, что на самом деле обслуживает сервер.
+func buildOpenAPIDocument(routes *routeTable) ([]byte, error) {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]map[string]interface{})
+	servers := make(map[string][]string)
+	documented := make(map[string]bool)
+	missing := make([]string, 0)
+
+	for _, route := range routes.api.routes {
+		pattern := "/" + strings.Join(route.segments, "/")
+		key := route.key()
+		servers[pattern] = []string{apiPrefix}
+
+		operation, ok := apiOperations[key]
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		documented[key] = true
+
+		if paths[pattern] == nil {
+			paths[pattern] = make(map[string]interface{})
+		}
+		paths[pattern][strings.ToLower(route.method)] = operation.document(route, schemas)
+	}
+
+	for key := range apiOperations {
+		if !documented[key] {
+			missing = append(missing, key+" (нет маршрута)")
+		}
+	}
+
+	// Пути вне версии API описываются от корня сервера, а пути с префиксом - от сервера API,
+	// поэтому путь, который есть и там, и там, описывается один раз с двумя серверами.
+	for _, route := range routes.mux {
+		if route.operation == nil {
+			missing = append(missing, route.path+" (нет описания)")
+			continue
+		}
+
+		server, pattern := "/", route.path
+		if strings.HasPrefix(route.path, apiPrefix+"/") {
+			server, pattern = apiPrefix, strings.TrimPrefix(route.path, apiPrefix)
+		}
+		if !containsString(servers[pattern], server) {
+			servers[pattern] = append(servers[pattern], server)
+		}
+		if paths[pattern] == nil {
+			paths[pattern] = make(map[string]interface{})
+		}
+
+		for _, method := range route.methods {
+			if _, ok := paths[pattern][strings.ToLower(method)]; ok {
+				continue
+			}
+
+			apiRoute := &apiRoute{method: method, segments: strings.Split(strings.Trim(pattern, "/"), "/"), access: route.access}
+			operation := route.operation.document(apiRoute, schemas)
+			if route.replacement != "" {
+				operation["deprecated"] = true
+				description, _ := operation["description"].(string)
+				operation["description"] = strings.TrimSpace(fmt.Sprintf("Устаревший маршрут, то же, что %s. Принимает любой метод, "+
+					"параметры пути передаются как остальные параметры. %s", route.replacement, description))
+			}
+			paths[pattern][strings.ToLower(method)] = operation
+		}
+	}
+
+	for pattern, urls := range servers {
+		if len(urls) == 1 && urls[0] == apiPrefix {
+			continue
+		}
+		list := make([]interface{}, 0, len(urls))
+		for _, url := range urls {
+			list = append(list, map[string]interface{}{"url": url})
+		}
+		paths[pattern]["servers"] = list
+	}
+
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("маршруты API и их описания не совпадают: %s", strings.Join(missing, ", "))
+	}
+
+	schemas["APIError"] = openAPISchema(reflect.TypeOf(APIError{}), schemas)
+	schemas["ErrorResponse"] = map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"Error": schemaRef("APIError")},
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "ServiceStation API",
+			"version": strings.TrimPrefix(apiPrefix, "/api/"),
+			"description": "Параметры можно передавать json объектом, формой или multipart формой. " +
+				"Старые маршруты без префикса " + apiPrefix + " описаны как устаревшие. " +
+				"Тексты сообщений и ошибок переводятся по заголовку Accept-Language или языку из профиля.",
+		},
+		"servers":  []interface{}{map[string]interface{}{"url": apiPrefix}},
+		"security": []interface{}{map[string]interface{}{"cookieAuth": []string{}}},
+		"paths":    paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"cookieAuth": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": "token"},
+			},
+		},
+	}, "", "  ")
+}
+
+// document - описание операции в формате OpenAPI.
+func (operation *apiOperation) document(route *apiRoute, schemas map[string]interface{}) map[string]interface{} {
+	pathParams := make(map[string]bool)
+	for _, segment := range route.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			pathParams[segment[1:len(segment)-1]] = true
+		}
+	}
+
+	parameters := make([]interface{}, 0)
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+	withFiles := false
+
+	for _, param := range operation.params {
+		switch {
+		case pathParams[param.name]:
+			parameters = append(parameters, param.document("path"))
+		case route.method == http.MethodGet || route.method == http.MethodDelete:
+			parameters = append(parameters, param.document("query"))
+		default:
+			properties[param.name] = param.schema()
+			if param.required {
+				required = append(required, param.name)
+			}
+			withFiles = withFiles || param.kind == "file"
+		}
+	}
+
+	result := map[string]interface{}{
+		"summary":     operation.summary,
+		"tags":        []string{operation.tag},
+		"operationId": strings.ToLower(route.method) + "_" + operationIDReplacer.Replace(strings.Join(route.segments, "_")),
+		"parameters":  parameters,
+		"responses":   operation.responses(route.access, schemas),
+	}
+
+	if len(properties) != 0 {
+		body := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) != 0 {
+			body["required"] = required
+		}
+
+		content := map[string]interface{}{"multipart/form-data": map[string]interface{}{"schema": body}}
+		if operation.jsonBody {
+			content = map[string]interface{}{"application/json": map[string]interface{}{"schema": body}}
+		} else if !withFiles {
+			content["application/json"] = map[string]interface{}{"schema": body}
+			content["application/x-www-form-urlencoded"] = map[string]interface{}{"schema": body}
+		}
+		result["requestBody"] = map[string]interface{}{"required": len(required) != 0, "content": content}
+	}
+
+	switch route.access {
+	case accessPublic:
+		result["security"] = []interface{}{}
+	case accessStaff:
+		result["description"] = "Только для сотрудников сервиса."
+	}
+
+	return result
+}
+
+// responses - описание ответов операции: успешного и ошибок.
+func (operation *apiOperation) responses(access string, schemas map[string]interface{}) map[string]interface{} {
+	success := map[string]interface{}{"description": "Успешно"}
+
+	switch {
+	case operation.response != nil:
+		success["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": openAPISchema(reflect.TypeOf(operation.response), schemas)},
+		}
+	case operation.mediaType != "":
+		schema := map[string]interface{}{"type": "string"}
+		if !strings.HasPrefix(operation.mediaType, "text/") {
+			schema["format"] = "binary"
+		}
+		success["content"] = map[string]interface{}{operation.mediaType: map[string]interface{}{"schema": schema}}
+	case operation.message:
+		success["description"] = "Текст об успешном выполнении"
+		success["content"] = map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	default:
+		success["description"] = "Успешно, пустой ответ"
+	}
+
+	errorResponse := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaRef("ErrorResponse")}},
+		}
+	}
+
+	result := map[string]interface{}{
+		"200":     success,
+		"400":     errorResponse("Ошибка в параметрах запроса"),
+		"default": errorResponse("Ошибка"),
+	}
+	if access != accessPublic {
+		result["401"] = errorResponse("Не выполнен вход или срок авторизации истек")
+	}
+	if access == accessStaff {
+		result["403"] = errorResponse("Недостаточно прав")
+	}
+
+	return result
+}
+
+// document - описание параметра пути или строки запроса в формате OpenAPI.
+func (param apiParam) document(in string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        param.name,
+		"in":          in,
+		"required":    param.required || in == "path",
+		"description": param.about,
+		"schema":      param.schema(),
+	}
+}
+
+// schema - схема значения параметра.
+func (param apiParam) schema() map[string]interface{} {
+	var schema map[string]interface{}
+	switch param.kind {
+	case "file":
+		schema = map[string]interface{}{"type": "string", "format": "binary"}
+	default:
+		schema = map[string]interface{}{"type": param.kind}
+	}
+	schema["description"] = param.about
+
+	return schema
+}
+
+// containsString - есть ли value в values.
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// schemaRef - ссылка на схему из components.
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// openAPISchema - схема json представления типа. Именованные структуры попадают в schemas
+// и подставляются ссылкой, встроенные структуры раскрываются, как это делает encoding/json.
+func openAPISchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": openAPISchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object"}
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		if _, ok := schemas[t.Name()]; !ok {
+			schemas[t.Name()] = nil // защита от бесконечной рекурсии на ссылающихся друг на друга типах
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return schemaRef(t.Name())
+	}
+
+	return map[string]interface{}{}
+}
+
+// structSchema - схема объекта по экспортируемым полям структуры с учетом тегов json.
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	addStructProperties(t, properties, schemas)
+
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// addStructProperties - добавляет в properties поля структуры, раскрывая встроенные структуры.
+func addStructProperties(t reflect.Type, properties map[string]interface{}, schemas map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addStructProperties(field.Type, properties, schemas)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+
+		properties[name] = openAPISchema(field.Type, schemas)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/STEJLS/ServiceStation/XMLconfig"
+	"github.com/lib/pq"
+)
+
+// orderEventsChannel - канал postgres LISTEN/NOTIFY для рассылки событий заказов между экземплярами сервиса.
+const orderEventsChannel = "order_events"
+
+// instanceID - идентификатор текущего экземпляра сервиса, чтобы не доставлять свои же уведомления дважды.
+var instanceID = generateToken()
+
+// events - хаб событий заказов текущего экземпляра сервиса.
+var events = newOrderEventsHub()
+
+// orderEventsHub - хаб, который рассылает события заказов подписанным пользователям.
+type orderEventsHub struct {
+	lock        sync.RWMutex
+	subscribers map[string]map[chan *OrderEvent]bool // ключ - ид пользователя
+	closing     chan struct{}                        // закрывается при остановке сервиса
+	closeOnce   sync.Once
+}
+
+// maxNotifyPayload - ограничение postgres на размер данных в NOTIFY.
+const maxNotifyPayload = 8000
+
+// orderEventNotification - событие заказа в том виде, в котором оно передается через NOTIFY.
+// Передаются только идентификаторы: сообщение любой длины другие экземпляры загружают из БД сами.
+type orderEventNotification struct {
+	Instance          string
+	UserIDs           []string `json:",omitempty"` // если не влезли в NOTIFY, то получатели ищутся заново
+	Type              string
+	OrderID           string
+	Status            int
+	MessageID         string `json:",omitempty"`
+	ReadByStaff       bool
+	LastReadMessageID string `json:",omitempty"`
+}
+
+// newOrderEventsHub - конструктор для хаба событий заказов.
+func newOrderEventsHub() *orderEventsHub {
+	return &orderEventsHub{
+		subscribers: make(map[string]map[chan *OrderEvent]bool),
+		closing:     make(chan struct{}),
+	}
+}
+
+// done - канал, который закрывается при остановке сервиса. Потоки событий по нему завершаются,
+// чтобы не задерживать остановку до таймаута.
+func (hub *orderEventsHub) done() <-chan struct{} {
+	return hub.closing
+}
+
+// shutdown - завершает все потоки событий.
+func (hub *orderEventsHub) shutdown() {
+	hub.closeOnce.Do(func() {
+		close(hub.closing)
+	})
+}
+
+// subscribe - подписывает пользователя на события его заказов.
+func (hub *orderEventsHub) subscribe(userID string) chan *OrderEvent {
+	ch := make(chan *OrderEvent, 16)
+
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+
+	if hub.subscribers[userID] == nil {
+		hub.subscribers[userID] = make(map[chan *OrderEvent]bool)
+	}
+	hub.subscribers[userID][ch] = true
+
+	return ch
+}
+
+// unsubscribe - отписывает канал от событий.
+func (hub *orderEventsHub) unsubscribe(userID string, ch chan *OrderEvent) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+
+	delete(hub.subscribers[userID], ch)
+	if len(hub.subscribers[userID]) == 0 {
+		delete(hub.subscribers, userID)
+	}
+}
+
+// dispatch - доставляет событие подписчикам текущего экземпляра.
+// Если подписчик не успевает читать события, то событие для него отбрасывается.
+func (hub *orderEventsHub) dispatch(userIDs []string, event *OrderEvent) {
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+
+	for _, userID := range userIDs {
+		for ch := range hub.subscribers[userID] {
+			select {
+			case ch <- event:
+			default:
+				log.Printf("Инфо. Подписчик (ид пользователя = %s) не успевает читать события, событие отброшено", userID)
+			}
+		}
+	}
+}
+
+// publishOrderEvent - рассылает событие заказа всем, кто может видеть заказ:
+// локальным подписчикам напрямую, а другим экземплярам сервиса через postgres NOTIFY.
+func publishOrderEvent(event *OrderEvent) {
+	userIDs, err := getOrderParticipants(event.OrderID)
+	if err != nil {
+		log.Printf("Ошибка. При поиске участников заказа(ид = %s) для рассылки события: %s\n", event.OrderID, err.Error())
+		return
+	}
+
+	events.dispatch(userIDs, event)
+
+	payload, err := notificationPayload(event, userIDs)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json события заказа: " + err.Error())
+		return
+	}
+
+	_, err = db.Exec(`SELECT pg_notify($1, $2)`, orderEventsChannel, string(payload))
+	if err != nil {
+		log.Println("Ошибка. При отправке события заказа через NOTIFY: " + err.Error())
+	}
+}
+
+// notificationPayload - данные NOTIFY для события заказа. Всегда меньше maxNotifyPayload:
+// если не влезают получатели, то они не передаются.
+func notificationPayload(event *OrderEvent, userIDs []string) ([]byte, error) {
+	notification := orderEventNotification{
+		Instance:          instanceID,
+		UserIDs:           userIDs,
+		Type:              event.Type,
+		OrderID:           event.OrderID,
+		Status:            event.Status,
+		ReadByStaff:       event.ReadByStaff,
+		LastReadMessageID: event.LastReadMessageID,
+	}
+	if event.Message != nil {
+		notification.MessageID = event.Message.ID
+	}
+
+	payload, err := json.Marshal(notification)
+	if err == nil && len(payload) >= maxNotifyPayload {
+		notification.UserIDs = nil
+		payload, err = json.Marshal(notification)
+	}
+
+	return payload, err
+}
+
+// getOrderParticipants - возвращает ид пользователей, которые видят заказ:
+// автора заказа и менеджеров автопарка организации, которой принадлежит машина.
+func getOrderParticipants(orderID string) ([]string, error) {
+	rows, err := db.Query(`SELECT userid FROM orders WHERE id = $1
+	UNION SELECT m.userid FROM orders o JOIN cars c ON c.id = o.carid JOIN orgmembers m ON m.orgid = c.orgid
+	WHERE o.id = $1 AND m.role = $2`, orderID, RoleFleetManager)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]string, 0)
+	for rows.Next() {
+		var userID string
+		err = rows.Scan(&userID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, userID)
+	}
+
+	return result, rows.Err()
+}
+
+// listenOrderEvents - слушает postgres NOTIFY и доставляет события заказов,
+// опубликованные другими экземплярами сервиса, локальным подписчикам. Завершается, когда отменяется ctx.
+func listenOrderEvents(ctx context.Context, dbinfo XMLconfig.DataBase) {
+	listener := pq.NewListener(connectionString(dbinfo), time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("Ошибка. В соединении для прослушивания событий заказов: " + err.Error())
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(orderEventsChannel)
+	if err != nil {
+		log.Println("Ошибка. При подписке на события заказов в БД, события других экземпляров не будут доставляться: " + err.Error())
+		return
+	}
+
+	for {
+		var notification *pq.Notification
+		select {
+		case <-ctx.Done():
+			return
+		case notification = <-listener.Notify:
+		}
+
+		if notification == nil { // соединение было восстановлено, часть событий могла потеряться
+			continue
+		}
+
+		var message orderEventNotification
+		err = json.Unmarshal([]byte(notification.Extra), &message)
+		if err != nil {
+			log.Println("Ошибка. При анмаршалинге события заказа из NOTIFY: " + err.Error())
+			continue
+		}
+
+		if message.Instance == instanceID {
+			continue
+		}
+
+		event, userIDs, err := message.load()
+		if err != nil {
+			log.Printf("Ошибка. При загрузке события заказа(ид = %s) из NOTIFY: %s\n", message.OrderID, err.Error())
+			continue
+		}
+		events.dispatch(userIDs, event)
+	}
+}
+
+// load - восстанавливает событие заказа из уведомления: загружает сообщение
+// и, если их не было в уведомлении, получателей.
+func (notification *orderEventNotification) load() (*OrderEvent, []string, error) {
+	event := &OrderEvent{
+		Type:              notification.Type,
+		OrderID:           notification.OrderID,
+		Status:            notification.Status,
+		ReadByStaff:       notification.ReadByStaff,
+		LastReadMessageID: notification.LastReadMessageID,
+	}
+
+	var err error
+	if notification.MessageID != "" {
+		event.Message, err = loadMessage(notification.MessageID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("сообщение(ид = %s): %s", notification.MessageID, err.Error())
+		}
+	}
+
+	userIDs := notification.UserIDs
+	if userIDs == nil {
+		userIDs, err = getOrderParticipants(notification.OrderID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("участники заказа: %s", err.Error())
+		}
+	}
+
+	return event, userIDs, nil
+}
+
+// orderEventsHandler - отдает поток событий по заказам пользователя (новые сообщения и смена статуса)
+// в формате Server-Sent Events.
+func orderEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Println("Ошибка. ResponseWriter не поддерживает потоковую передачу.")
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	ch := events.subscribe(id)
+	defer events.unsubscribe(id, ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Поток живет дольше таймаута записи сервера.
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil {
+		log.Println("Ошибка. При снятии таймаута записи для потока событий: " + err.Error())
+	}
+
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	log.Printf("Инфо. Пользователь (ид = %s) подписался на события заказов", id)
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("Инфо. Пользователь (ид = %s) отписался от событий заказов", id)
+			return
+		case <-events.done():
+			return
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": ping\n\n")
+			if err != nil {
+				return
+			}
+		case event := <-ch:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Println("Ошибка. При маршалинге в json события заказа: " + err.Error())
+				continue
+			}
+
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
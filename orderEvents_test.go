@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestNotificationPayloadFitsNotify - событие с длинным сообщением и большим числом получателей
+// помещается в NOTIFY и несет ид сообщения, а не его текст.
+func TestNotificationPayloadFitsNotify(t *testing.T) {
+	userIDs := make([]string, 0, 5000)
+	for i := 0; i < cap(userIDs); i++ {
+		userIDs = append(userIDs, strconv.Itoa(i))
+	}
+	event := &OrderEvent{Type: EventMessage, OrderID: "7", Status: StatusOpen,
+		Message: &Message{ID: "42", OrderID: "7", Text: strings.Repeat("текст ", 20000)}}
+
+	payload, err := notificationPayload(event, userIDs)
+	if err != nil {
+		t.Fatalf("notificationPayload: %v", err)
+	}
+	if len(payload) >= maxNotifyPayload {
+		t.Fatalf("размер данных NOTIFY %d, должен быть меньше %d", len(payload), maxNotifyPayload)
+	}
+
+	var notification orderEventNotification
+	err = json.Unmarshal(payload, &notification)
+	if err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if notification.MessageID != "42" || notification.OrderID != "7" || notification.Type != EventMessage || notification.UserIDs != nil {
+		t.Fatalf("неожиданное уведомление: %+v", notification)
+	}
+
+	payload, err = notificationPayload(event, userIDs[:3])
+	if err != nil {
+		t.Fatalf("notificationPayload: %v", err)
+	}
+	err = json.Unmarshal(payload, &notification)
+	if err != nil || len(notification.UserIDs) != 3 {
+		t.Fatalf("получатели должны передаваться, если помещаются: %s", payload)
+	}
+}
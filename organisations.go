@@ -0,0 +1,254 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// visibleOrdersCondition - условие для выборки заказов, доступных пользователю с ид $1:
+// свои заказы, а для менеджера автопарка еще и все заказы по машинам организации.
+var visibleOrdersCondition = fmt.Sprintf(`(orders.userid = $1 OR orders.carid IN
+	(SELECT cars.id FROM cars JOIN orgmembers ON orgmembers.orgid = cars.orgid WHERE orgmembers.userid = $1 AND orgmembers.role = %d))`, RoleFleetManager)
+
+// ownedCarCondition - условие, что машина из таблицы cars сейчас принадлежит пользователю с ид $1
+// лично или через организацию. После передачи машины прежнему владельцу его заказы доступны только для чтения.
+const ownedCarCondition = `(cars.orgid IS NULL AND cars.userid = $1 OR cars.orgid IN (SELECT orgid FROM orgmembers WHERE userid = $1))`
+
+// createOrganisationHandler - создает организацию, создатель становится ее менеджером автопарка.
+func createOrganisationHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > 100 {
+		writeFieldError(w, "name", CodeOrgName, 100)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Ошибка. При открытии транзакции: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	defer tx.Rollback()
+
+	var orgID string
+	err = tx.QueryRow(`INSERT INTO organisations(name) VALUES($1) RETURNING id`, name).Scan(&orgID)
+	if err == nil {
+		_, err = tx.Exec(`INSERT INTO orgmembers(orgid, userid, role) VALUES($1, $2, $3)`, orgID, id, RoleFleetManager)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Ошибка. При создании организации пользователем(ид = %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	log.Printf("Инфо. Пользователь (ид = %s) создал организацию(ид = %s)", id, orgID)
+	writeMessage(w, MsgOrgCreated)
+}
+
+// getOrganisationsHandler - отдает организации пользователя вместе с их участниками.
+func getOrganisationsHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	rows, err := db.Query(`SELECT o.id, o.name, m.role FROM organisations o
+	JOIN orgmembers m ON m.orgid = o.id WHERE m.userid = $1 ORDER BY o.name`, id)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД организаций пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	result := make([]*Organisation, 0)
+	for rows.Next() {
+		org := Organisation{Members: make([]*OrgMember, 0)}
+		err = rows.Scan(&org.ID, &org.Name, &org.Role)
+		if err != nil {
+			rows.Close()
+			log.Printf("Ошибка. При выборке из БД организаций пользователя(ид =  %s): %s\n", id, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+		result = append(result, &org)
+	}
+	rows.Close()
+
+	for _, org := range result {
+		memberRows, err := db.Query(`SELECT u.id, u.login, u.name, u.lastname, m.role FROM orgmembers m
+		JOIN users u ON u.id = m.userid WHERE m.orgid = $1 ORDER BY m.role, u.lastname`, org.ID)
+		if err != nil {
+			log.Printf("Ошибка. При выборке из БД участников организации(ид =  %s): %s\n", org.ID, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+
+		for memberRows.Next() {
+			member := OrgMember{}
+			err = memberRows.Scan(&member.UserID, &member.Login, &member.Name, &member.LastName, &member.Role)
+			if err != nil {
+				memberRows.Close()
+				log.Printf("Ошибка. При выборке из БД участников организации(ид =  %s): %s\n", org.ID, err.Error())
+				writeError(w, http.StatusInternalServerError, CodeInternal)
+				return
+			}
+			org.Members = append(org.Members, &member)
+		}
+		memberRows.Close()
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// addOrgMemberHandler - добавляет пользователя в организацию или меняет его роль.
+// Доступно только менеджеру автопарка.
+func addOrgMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	orgID := r.FormValue("orgID")
+	if _, err := strconv.Atoi(orgID); err != nil {
+		writeFieldError(w, "orgID", CodeInvalidOrgID)
+		return
+	}
+
+	login := strings.ToLower(r.FormValue("login"))
+	role, err := strconv.Atoi(r.FormValue("role"))
+	if err != nil || (role != RoleFleetManager && role != RoleDriver) {
+		writeFieldError(w, "role", CodeOrgRole)
+		return
+	}
+
+	if !checkOrgRole(w, id, orgID, RoleFleetManager) {
+		return
+	}
+
+	var memberID string
+	err = db.QueryRow(`SELECT id FROM users WHERE login = $1`, login).Scan(&memberID)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusBadRequest, CodeLoginNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД пользователя(логин - " + login + " ): " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	_, err = db.Exec(`INSERT INTO orgmembers(orgid, userid, role) VALUES($1, $2, $3)
+	ON CONFLICT (orgid, userid) DO UPDATE SET role = EXCLUDED.role`, orgID, memberID, role)
+	if err != nil {
+		log.Printf("Ошибка. При добавлении участника в организацию(ид = %s): %s\n", orgID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	log.Printf("Инфо. В организацию (ид = %s) добавлен пользователь(ид = %s) с ролью %d", orgID, memberID, role)
+	writeMessage(w, MsgMemberAdded)
+}
+
+// removeOrgMemberHandler - удаляет пользователя из организации. Доступно только менеджеру автопарка.
+func removeOrgMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	orgID := r.FormValue("orgID")
+	if _, err := strconv.Atoi(orgID); err != nil {
+		writeFieldError(w, "orgID", CodeInvalidOrgID)
+		return
+	}
+
+	memberID := r.FormValue("userID")
+	if _, err := strconv.Atoi(memberID); err != nil {
+		writeFieldError(w, "userID", CodeInvalidUserID)
+		return
+	}
+
+	if memberID == id {
+		writeError(w, http.StatusBadRequest, CodeRemoveSelf)
+		return
+	}
+
+	if !checkOrgRole(w, id, orgID, RoleFleetManager) {
+		return
+	}
+
+	_, err := db.Exec(`DELETE FROM orgmembers WHERE orgid = $1 AND userid = $2`, orgID, memberID)
+	if err != nil {
+		log.Printf("Ошибка. При удалении участника из организации(ид = %s): %s\n", orgID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	writeMessage(w, MsgMemberRemoved)
+}
+
+// checkOrgRole - проверяет, что пользователь состоит в организации с указанной ролью.
+// Менеджер автопарка считается имеющим любую роль. В случае отказа сам отвечает клиенту.
+func checkOrgRole(w http.ResponseWriter, userID string, orgID string, role int) bool {
+	var memberRole int
+	err := db.QueryRow(`SELECT role FROM orgmembers WHERE orgid = $1 AND userid = $2`, orgID, userID).Scan(&memberRole)
+	if err == sql.ErrNoRows || (err == nil && memberRole != role && memberRole != RoleFleetManager) {
+		log.Printf("Инфо. Пользователь (ид = %s) без нужной роли обратился к организации(ид = %s)", userID, orgID)
+		writeError(w, http.StatusForbidden, CodeOrgForbidden)
+		return false
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД участника организации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return false
+	}
+
+	return true
+}
+
+// checkCarAccess - проверяет, может ли пользователь работать с машиной.
+// Личной машиной распоряжается владелец, машиной организации - ее участники,
+// а если manage == true, то только менеджеры автопарка. В случае отказа сам отвечает клиенту.
+// Ид машины должен быть предварительно проверен на число.
+func checkCarAccess(w http.ResponseWriter, userID string, carID string, manage bool) bool {
+	var ownerID, orgID string
+	err := db.QueryRow(`SELECT userid, COALESCE(orgid::text, '') FROM cars WHERE id = $1 AND deleted = FALSE`, carID).Scan(&ownerID, &orgID)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusBadRequest, CodeCarNotFound)
+		return false
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД машины: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return false
+	}
+
+	if orgID == "" {
+		if ownerID != userID {
+			log.Printf("Инфо. Пользователь (ид = %s) обратился к чужой машине(ид = %s)", userID, carID)
+			writeError(w, http.StatusBadRequest, CodeCarNotFound)
+			return false
+		}
+		return true
+	}
+
+	if manage {
+		return checkOrgRole(w, userID, orgID, RoleFleetManager)
+	}
+
+	return checkOrgRole(w, userID, orgID, RoleDriver)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// TestCheckCarAccess - личной машиной распоряжается только владелец, машиной организации - ее участники,
+// а менять машину организации может только менеджер автопарка.
+func TestCheckCarAccess(t *testing.T) {
+	tests := []struct {
+		name   string
+		owner  string
+		orgID  string
+		role   int // 0, если пользователь не состоит в организации
+		manage bool
+		status int // 0, если доступ разрешен
+		code   string
+	}{
+		{"владелец", "5", "", 0, true, 0, ""},
+		{"чужая машина", "6", "", 0, false, http.StatusBadRequest, CodeCarNotFound},
+		{"менеджер меняет", "6", "3", RoleFleetManager, true, 0, ""},
+		{"менеджер смотрит", "6", "3", RoleFleetManager, false, 0, ""},
+		{"водитель смотрит", "6", "3", RoleDriver, false, 0, ""},
+		{"водитель меняет", "6", "3", RoleDriver, true, http.StatusForbidden, CodeOrgForbidden},
+		{"не участник", "5", "3", 0, false, http.StatusForbidden, CodeOrgForbidden},
+	}
+
+	for _, test := range tests {
+		mock := useMockDB(t)
+		mock.ExpectQuery(`FROM cars WHERE id = \$1`).WithArgs("7").
+			WillReturnRows(sqlmock.NewRows([]string{"userid", "orgid"}).AddRow(test.owner, test.orgID))
+		if test.orgID != "" {
+			rows := sqlmock.NewRows([]string{"role"})
+			if test.role != 0 {
+				rows.AddRow(test.role)
+			}
+			mock.ExpectQuery(`SELECT role FROM orgmembers`).WithArgs(test.orgID, "5").WillReturnRows(rows)
+		}
+
+		recorder := httptest.NewRecorder()
+		allowed := checkCarAccess(recorder, "5", "7", test.manage)
+		if allowed != (test.status == 0) {
+			t.Errorf("%s: доступ %v", test.name, allowed)
+		}
+		if test.status != 0 && (recorder.Code != test.status || errorCode(recorder) != test.code) {
+			t.Errorf("%s: код %d, ответ %s", test.name, recorder.Code, recorder.Body.String())
+		}
+
+		err := mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+	}
+}
+
+// TestCheckCarAccessUnknownCar - удаленная или несуществующая машина не найдена.
+func TestCheckCarAccessUnknownCar(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery(`FROM cars WHERE id = \$1`).WithArgs("7").WillReturnRows(sqlmock.NewRows([]string{"userid", "orgid"}))
+
+	recorder := httptest.NewRecorder()
+	if checkCarAccess(recorder, "5", "7", false) || recorder.Code != http.StatusBadRequest || errorCode(recorder) != CodeCarNotFound {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+// TestOrgMemberHandlersValidateIDs - нечисловые ид организации и участника отклоняются до запросов к БД.
+func TestOrgMemberHandlersValidateIDs(t *testing.T) {
+	useMockDB(t)
+
+	tests := []struct {
+		handler http.HandlerFunc
+		form    url.Values
+		field   string
+		code    string
+	}{
+		{addOrgMemberHandler, url.Values{"orgID": {"abc"}, "login": {"driver"}, "role": {"2"}}, "orgID", CodeInvalidOrgID},
+		{removeOrgMemberHandler, url.Values{"orgID": {"abc"}, "userID": {"6"}}, "orgID", CodeInvalidOrgID},
+		{removeOrgMemberHandler, url.Values{"orgID": {"3"}, "userID": {"x"}}, "userID", CodeInvalidUserID},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		test.handler(recorder, userRequest("5", test.form))
+		if recorder.Code != http.StatusBadRequest || fieldCodes(recorder)[test.field] != test.code {
+			t.Errorf("%v: код %d, ответ %s", test.form, recorder.Code, recorder.Body.String())
+		}
+	}
+}
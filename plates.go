@@ -0,0 +1,61 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// platePatterns - форматы номерных знаков легковых машин по кодам стран (ISO 3166-1 alpha-2).
+var platePatterns = map[string]*regexp.Regexp{
+	"RU": regexp.MustCompile(`^[ABEKMHOPCTYX]\d{3}[ABEKMHOPCTYX]{2}\d{2,3}$`),
+	"KZ": regexp.MustCompile(`^(\d{3}[A-Z]{2,3}\d{2}|[A-Z]\d{3}[A-Z]{2,3})$`),
+	"BY": regexp.MustCompile(`^\d{4}[ABEIKMHOPCTX]{2}\d$`),
+	"UA": regexp.MustCompile(`^[A-Z]{2}\d{4}[A-Z]{2}$`),
+	"KG": regexp.MustCompile(`^\d{2}\d{3}[A-Z]{3}$`),
+	"UZ": regexp.MustCompile(`^\d{2}[A-Z]\d{3}[A-Z]{2}$`),
+}
+
+// plateCyrillicToLatin - кириллические буквы номерного знака и совпадающие с ними по написанию латинские.
+var plateCyrillicToLatin = strings.NewReplacer(
+	"А", "A", "В", "B", "Е", "E", "К", "K", "М", "M", "Н", "H", "О", "O",
+	"Р", "P", "С", "C", "Т", "T", "У", "Y", "Х", "X", "І", "I",
+)
+
+// transmissions - допустимые типы коробки передач.
+var transmissions = map[string]bool{
+	"":          true,
+	"manual":    true,
+	"automatic": true,
+	"robot":     true,
+	"cvt":       true,
+}
+
+// NormalizePlate - приводит номерной знак к единому виду: верхний регистр,
+// латинские буквы вместо кириллических, без пробелов и дефисов.
+func NormalizePlate(plate string) string {
+	plate = strings.ToUpper(plate)
+	plate = strings.NewReplacer(" ", "", "-", "").Replace(plate)
+	return plateCyrillicToLatin.Replace(plate)
+}
+
+// ValidatePlate - проверяет номерной знак на соответствие формату страны.
+// Номер и страна должны быть уже нормализованы.
+func ValidatePlate(plate string, country string) ValidationErrors {
+	resultOfValidation := ValidationErrors{}
+
+	if plate == "" {
+		return resultOfValidation
+	}
+
+	pattern, ok := platePatterns[country]
+	if !ok {
+		resultOfValidation.add("plateCountry", CodePlateCountry)
+		return resultOfValidation
+	}
+
+	if !pattern.MatchString(plate) {
+		resultOfValidation.add("plate", CodePlateFormat)
+	}
+
+	return resultOfValidation
+}
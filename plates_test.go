@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+// TestNormalizePlate - номер приводится к верхнему регистру и латинским буквам, пробелы и дефисы убираются.
+func TestNormalizePlate(t *testing.T) {
+	tests := map[string]string{
+		"а123вс 77":    "A123BC77",
+		"A 123 BC-777": "A123BC777",
+		"1234 ІК-7":    "1234IK7",
+		"aa1234bb":     "AA1234BB",
+	}
+
+	for plate, expected := range tests {
+		if got := NormalizePlate(plate); got != expected {
+			t.Errorf("NormalizePlate(%q) = %q, ожидалось %q", plate, got, expected)
+		}
+	}
+}
+
+// TestValidatePlate - форматы номеров по странам, пустой номер не проверяется.
+func TestValidatePlate(t *testing.T) {
+	tests := []struct {
+		plate   string
+		country string
+		field   string // пусто, если номер корректен
+		code    string
+	}{
+		{"", "", "", ""},
+		{"A123BC77", "RU", "", ""},
+		{"A123BC777", "RU", "", ""},
+		{"A123BC7", "RU", "plate", CodePlateFormat},
+		{"D123BC77", "RU", "plate", CodePlateFormat},
+		{"123ABC02", "KZ", "", ""},
+		{"A123BCD", "KZ", "", ""},
+		{"1234AB7", "BY", "", ""},
+		{"1234AD7", "BY", "plate", CodePlateFormat},
+		{"AA1234BB", "UA", "", ""},
+		{"01123ABC", "KG", "", ""},
+		{"01A123BC", "UZ", "", ""},
+		{"01A123BC", "KG", "plate", CodePlateFormat},
+		{"A123BC77", "DE", "plateCountry", CodePlateCountry},
+	}
+
+	for _, test := range tests {
+		errs := ValidatePlate(test.plate, test.country)
+		if test.code == "" {
+			if len(errs) != 0 {
+				t.Errorf("ValidatePlate(%q, %q) = %s", test.plate, test.country, errs.String())
+			}
+			continue
+		}
+		if len(errs) != 1 || errs[0].Field != test.field || errs[0].Code != test.code {
+			t.Errorf("ValidatePlate(%q, %q) = %v, ожидалась ошибка %s", test.plate, test.country, errs, test.code)
+		}
+	}
+}
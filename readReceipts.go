@@ -0,0 +1,263 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// unreadCountColumn - подзапрос с количеством сообщений сотрудников в заказе из таблицы orders,
+// не прочитанных пользователем с ид $1.
+const unreadCountColumn = `(SELECT COUNT(*) FROM messages m WHERE m.orderid = orders.id AND m.isadmin = TRUE
+	AND m.id > COALESCE((SELECT r.lastmessageid FROM messagereads r WHERE r.orderid = orders.id AND r.userid = $1), 0))`
+
+// markMessagesReadHandler - отмечает сообщения заказа прочитанными текущим участником
+// до сообщения с указанным ид включительно, а если ид не передан, то все сообщения заказа.
+// Доступно как клиентам (для видимых им заказов), так и сотрудникам сервиса.
+func markMessagesReadHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	orderID := r.FormValue("orderID")
+	messageID := r.FormValue("messageID")
+	if _, err := strconv.Atoi(orderID); err != nil {
+		writeFieldError(w, "orderID", CodeInvalidOrderID)
+		return
+	}
+	if _, err := strconv.Atoi(messageID); messageID != "" && err != nil {
+		writeFieldError(w, "messageID", CodeInvalidMessageID)
+		return
+	}
+
+	staff, err := isStaff(id)
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД роли пользователя: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	// Сотрудник видит все заказы, клиент - только свои и заказы по машинам своей организации.
+	if staff {
+		err = db.QueryRow(`SELECT id FROM orders WHERE id = $1`, orderID).Scan(&orderID)
+	} else {
+		err = db.QueryRow(`SELECT id FROM orders WHERE id = $2 AND `+visibleOrdersCondition, id, orderID).Scan(&orderID)
+	}
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, CodeOrderNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске записи в БД о заказе: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	if messageID == "" {
+		err = db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM messages WHERE orderid = $1`, orderID).Scan(&messageID)
+		if err != nil {
+			log.Println("Ошибка. При поиске в БД последнего сообщения заказа: " + err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+	}
+
+	err = markMessagesRead(db, orderID, id, messageID)
+	if err != nil {
+		log.Printf("Ошибка. При отметке сообщений заказа(ид = %s) прочитанными: %s\n", orderID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	publishOrderEvent(&OrderEvent{Type: EventRead, OrderID: orderID, ReadByStaff: staff, LastReadMessageID: messageID})
+}
+
+// getUnreadCountsHandler - отдает количество непрочитанных сообщений по заказам и всего.
+// Для клиента считаются сообщения сотрудников в видимых ему заказах,
+// для сотрудника - сообщения клиентов во всех заказах.
+func getUnreadCountsHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	staff, err := isStaff(id)
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД роли пользователя: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	var rows *sql.Rows
+	if staff {
+		rows, err = db.Query(`SELECT m.orderid, COUNT(*) FROM messages m
+		LEFT JOIN messagereads r ON r.orderid = m.orderid AND r.userid = $1
+		WHERE m.isadmin = FALSE AND m.id > COALESCE(r.lastmessageid, 0) GROUP BY m.orderid ORDER BY m.orderid`, id)
+	} else {
+		rows, err = db.Query(`SELECT orders.id, COUNT(*) FROM orders JOIN messages m ON m.orderid = orders.id
+		LEFT JOIN messagereads r ON r.orderid = orders.id AND r.userid = $1
+		WHERE `+visibleOrdersCondition+` AND m.isadmin = TRUE AND m.id > COALESCE(r.lastmessageid, 0) GROUP BY orders.id ORDER BY orders.id`, id)
+	}
+	if err != nil {
+		log.Printf("Ошибка. При подсчете непрочитанных сообщений пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	defer rows.Close()
+
+	result := UnreadCounts{Orders: make([]*OrderUnread, 0)}
+
+	for rows.Next() {
+		unread := OrderUnread{}
+		err = rows.Scan(&unread.OrderID, &unread.Unread)
+		if err != nil {
+			log.Printf("Ошибка. При подсчете непрочитанных сообщений пользователя(ид =  %s): %s\n", id, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+		result.Total += unread.Unread
+		result.Orders = append(result.Orders, &unread)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// getAdminMessagesHandler - отдает сотруднику сервиса все сообщения указанного заказа.
+func getAdminMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	orderID := r.FormValue("orderID")
+	if _, err := strconv.Atoi(orderID); err != nil {
+		writeFieldError(w, "orderID", CodeInvalidOrderID)
+		return
+	}
+
+	result := getOrderMessages(w, orderID)
+	if result == nil {
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// getOrderMessages - возвращает сообщения заказа вместе с отметками о прочтении.
+// В случае ошибки сам отвечает клиенту и возвращает nil.
+func getOrderMessages(w http.ResponseWriter, orderID string) []*Message {
+	result, err := loadOrderMessages(orderID)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД информации о сообщениях заказа(ид =  %s): %s\n", orderID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return nil
+	}
+
+	return result
+}
+
+// loadOrderMessages - возвращает сообщения заказа с отметками о прочтении и вложениями.
+func loadOrderMessages(orderID string) ([]*Message, error) {
+	result, err := loadOrdersMessages([]string{orderID})
+	if err != nil {
+		return nil, err
+	}
+
+	return result[orderID], nil
+}
+
+// loadOrdersMessages - возвращает сообщения нескольких заказов по ид заказа одним запросом к БД.
+// Для заказа без сообщений в результате пустой список.
+func loadOrdersMessages(orderIDs []string) (map[string][]*Message, error) {
+	result := make(map[string][]*Message)
+	for _, orderID := range orderIDs {
+		result[orderID] = make([]*Message, 0)
+	}
+
+	messages, err := queryMessages(`m.orderid = ANY($1::int[])`, pq.Array(orderIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, message := range messages {
+		result[message.OrderID] = append(result[message.OrderID], message)
+	}
+
+	return result, nil
+}
+
+// loadMessage - возвращает сообщение по ид вместе с отметками о прочтении и вложениями.
+func loadMessage(messageID string) (*Message, error) {
+	messages, err := queryMessages(`m.id = $1`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return messages[0], nil
+}
+
+// queryMessages - выбирает сообщения по условию condition на таблицу messages m
+// вместе с отметками о прочтении и вложениями, в порядке отправки.
+func queryMessages(condition string, args ...interface{}) ([]*Message, error) {
+	rows, err := db.Query(`SELECT m.id, m.isadmin, m.date, m.text, m.orderid,
+	EXISTS(SELECT 1 FROM messagereads r JOIN users u ON u.id = r.userid WHERE r.orderid = m.orderid AND u.isstaff = FALSE AND r.lastmessageid >= m.id),
+	EXISTS(SELECT 1 FROM messagereads r JOIN users u ON u.id = r.userid WHERE r.orderid = m.orderid AND u.isstaff = TRUE AND r.lastmessageid >= m.id)
+	FROM messages m WHERE `+condition+` ORDER BY m.date, m.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]*Message, 0)
+
+	for rows.Next() {
+		message := Message{}
+		err = rows.Scan(&message.ID, &message.IsAdmin, &message.Date, &message.Text, &message.OrderID, &message.ReadByCustomer, &message.ReadByStaff)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, &message)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = getMessagesAttachments(messages)
+	if err != nil {
+		return nil, fmt.Errorf("вложения сообщений: %s", err.Error())
+	}
+
+	return messages, nil
+}
+
+// markMessagesRead - сдвигает отметку о прочтении участником сообщений заказа вперед до messageID.
+func markMessagesRead(exec sqlExecutor, orderID string, userID string, messageID string) error {
+	_, err := exec.Exec(`INSERT INTO messagereads(orderid, userid, lastmessageid) VALUES($1, $2, $3)
+	ON CONFLICT (orderid, userid) DO UPDATE SET lastmessageid = GREATEST(messagereads.lastmessageid, EXCLUDED.lastmessageid)`,
+		orderID, userID, messageID)
+	return err
+}
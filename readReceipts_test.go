@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// TestMarkMessagesReadUnknownOrder - отметка прочитанными в несуществующем заказе дает 404
+// и сотруднику, и клиенту, которому заказ не виден.
+func TestMarkMessagesReadUnknownOrder(t *testing.T) {
+	for _, staff := range []bool{true, false} {
+		mock := useMockDB(t)
+		mock.ExpectQuery(`SELECT isstaff FROM users`).WithArgs("5").WillReturnRows(sqlmock.NewRows([]string{"isstaff"}).AddRow(staff))
+		if staff {
+			mock.ExpectQuery(`SELECT id FROM orders WHERE id = \$1$`).WithArgs("9").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		} else {
+			mock.ExpectQuery(`SELECT id FROM orders WHERE id = \$2 AND`).WithArgs("5", "9").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		}
+
+		recorder := httptest.NewRecorder()
+		markMessagesReadHandler(recorder, userRequest("5", url.Values{"orderID": {"9"}}))
+		if recorder.Code != http.StatusNotFound || errorCode(recorder) != CodeOrderNotFound {
+			t.Errorf("сотрудник %v: код %d, ответ %s", staff, recorder.Code, recorder.Body.String())
+		}
+
+		err := mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("сотрудник %v: %s", staff, err)
+		}
+	}
+}
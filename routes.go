@@ -0,0 +1,184 @@
+package main
+
+import "net/http"
+
+// routeMux - то, в чем регистрируются маршруты: http.ServeMux сервера или его обертка в тестах.
+type routeMux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// muxRoute - маршрут, зарегистрированный в mux мимо маршрутизатора версии API, и его описание в спецификации.
+// Путь указывается от корня сервера, параметры пути - в фигурных скобках, как у маршрутов API.
+type muxRoute struct {
+	methods     []string // методы в спецификации
+	path        string
+	access      string
+	operation   *apiOperation
+	replacement string // для старого маршрута - операция API "МЕТОД путь", которую он повторяет
+}
+
+// routeTable - все маршруты сервиса: версия API и пути, зарегистрированные прямо в mux.
+// По ней собирается спецификация, поэтому маршрут без описания не попадет на сервер незамеченным.
+type routeTable struct {
+	api *apiRouter
+	mux []*muxRoute
+}
+
+// registerRoutes - регистрирует в mux все маршруты сервиса: версию API, спецификацию, GraphQL, календари
+// и старые маршруты. Уровень доступа указывается у каждого маршрута, см. protect.
+// Возвращает таблицу маршрутов для сборки спецификации.
+func registerRoutes(mux routeMux) *routeTable {
+	api := newAPIRouter(apiPrefix)
+	api.handle(http.MethodPost, "/users", accessPublic, registrationHandler)
+	api.handle(http.MethodPost, "/sessions", accessPublic, authorizationHandler)
+	api.handle(http.MethodDelete, "/sessions", accessUser, logOutHandler)
+	api.handle(http.MethodGet, "/profile", accessUser, profileInfoHandler)
+	api.handle(http.MethodGet, "/profile/image", accessUser, profileImageHandler)
+	api.handle(http.MethodPut, "/profile/language", accessUser, setLanguageHandler)
+	api.handle(http.MethodGet, "/cars", accessUser, GetCarsHandler)
+	api.handle(http.MethodPost, "/cars", accessUser, addCarHandler)
+	api.handle(http.MethodPut, "/cars/{id}", accessUser, updateCarHandler)
+	api.handle(http.MethodDelete, "/cars/{id}", accessUser, removeCarHandler)
+	api.handle(http.MethodGet, "/cars/{id}/edits", accessUser, getCarEditsHandler)
+	api.handle(http.MethodPost, "/cars/{carID}/odometer", accessUser, addOdometerReadingHandler)
+	api.handle(http.MethodPost, "/cars/{carID}/transfers", accessUser, transferCarHandler)
+	api.handle(http.MethodGet, "/transfers", accessUser, getCarTransfersHandler)
+	api.handle(http.MethodPost, "/transfers/{id}/accept", accessUser, acceptCarTransferHandler)
+	api.handle(http.MethodPost, "/transfers/{id}/decline", accessUser, declineCarTransferHandler)
+	api.handle(http.MethodGet, "/vin/{vin}", accessUser, decodeVINHandler)
+	api.handle(http.MethodGet, "/vin/{vin}/history", accessUser, carHistoryHandler)
+	api.handle(http.MethodGet, "/vin/{vin}/history.pdf", accessUser, carHistoryPDFHandler)
+	api.handle(http.MethodGet, "/orders", accessUser, getOrdersHandler)
+	api.handle(http.MethodPost, "/orders", accessUser, addOrderHandler)
+	api.handle(http.MethodGet, "/orders/{orderID}/messages", accessUser, getMessagesHandler)
+	api.handle(http.MethodPost, "/orders/{orderID}/messages", accessUser, addMessageToOrderHandler)
+	api.handle(http.MethodPost, "/orders/{orderID}/read", accessUser, markMessagesReadHandler)
+	api.handle(http.MethodGet, "/orders/events", accessUser, orderEventsHandler)
+	api.handle(http.MethodGet, "/unread", accessUser, getUnreadCountsHandler)
+	api.handle(http.MethodGet, "/attachments/{id}", accessUser, getAttachmentHandler)
+	api.handle(http.MethodGet, "/reminders", accessUser, getRemindersHandler)
+	api.handle(http.MethodGet, "/notifications/preferences", accessUser, getNotificationPreferencesHandler)
+	api.handle(http.MethodPut, "/notifications/preferences/{channel}", accessUser, setNotificationPreferenceHandler)
+	api.handle(http.MethodPost, "/telegram/link", accessUser, linkTelegramHandler)
+	api.handle(http.MethodDelete, "/telegram/link", accessUser, unlinkTelegramHandler)
+	api.handle(http.MethodGet, "/calendar/feed", accessUser, getCalendarFeedHandler)
+	api.handle(http.MethodPost, "/calendar/feed", accessUser, resetCalendarFeedHandler)
+	api.handle(http.MethodGet, "/organisations", accessUser, getOrganisationsHandler)
+	api.handle(http.MethodPost, "/organisations", accessUser, createOrganisationHandler)
+	api.handle(http.MethodPost, "/organisations/{orgID}/members", accessUser, addOrgMemberHandler)
+	api.handle(http.MethodDelete, "/organisations/{orgID}/members/{userID}", accessUser, removeOrgMemberHandler)
+	api.handle(http.MethodGet, "/admin/inbox", accessStaff, getAdminInboxHandler)
+	api.handle(http.MethodGet, "/admin/orders/{orderID}/messages", accessStaff, getAdminMessagesHandler)
+	api.handle(http.MethodPost, "/admin/orders/{orderID}/messages", accessStaff, addAdminMeassageHandler)
+	api.handle(http.MethodPut, "/admin/orders/{orderID}/assignee", accessStaff, assignAdminOrderHandler)
+	api.handle(http.MethodPost, "/admin/orders/{orderID}/close", accessStaff, closeAdminOrderHandler)
+	api.handle(http.MethodPost, "/admin/orders/{orderID}/cancel", accessStaff, cancelAdminOrderHandler)
+	api.handle(http.MethodPut, "/admin/orders/{orderID}/date", accessStaff, rescheduleAdminOrderHandler)
+	api.handle(http.MethodPost, "/admin/orders/{orderID}/items", accessStaff, addAdminOrderItemHandler)
+	api.handle(http.MethodPost, "/admin/vin/{vin}/notes", accessStaff, addAdminCarNoteHandler)
+	api.handle(http.MethodGet, "/admin/templates", accessStaff, getAdminTemplatesHandler)
+	api.handle(http.MethodPost, "/admin/templates", accessStaff, addAdminTemplateHandler)
+	api.handle(http.MethodPut, "/admin/templates/{id}", accessStaff, updateAdminTemplateHandler)
+	api.handle(http.MethodDelete, "/admin/templates/{id}", accessStaff, removeAdminTemplateHandler)
+	api.handle(http.MethodGet, "/admin/templates/{templateID}/preview", accessStaff, previewAdminTemplateHandler)
+	api.handle(http.MethodGet, openAPIPath, accessPublic, openAPIHandler)
+	api.handle(http.MethodGet, "/health/live", accessPublic, liveHandler)
+	api.handle(http.MethodGet, "/health/ready", accessPublic, readyHandler)
+	api.handle(http.MethodGet, "/version", accessPublic, versionHandler)
+	mux.Handle(apiPrefix+"/", api)
+
+	routes := &routeTable{api: api}
+	routes.mirror(mux, openAPIPath, "GET "+openAPIPath)
+	for _, path := range []string{apiPrefix + graphqlPath, graphqlPath} {
+		routes.handle(mux, path, &muxRoute{methods: []string{http.MethodGet, http.MethodPost}, path: path,
+			access: accessUser, operation: graphqlOperation}, graphqlHandler)
+	}
+	routes.handle(mux, calendarFeedPath, &muxRoute{methods: []string{http.MethodGet}, path: calendarFeedPath + "{token}",
+		access: accessPublic, operation: calendarFeedOperation}, calendarFeedHandler)
+
+	// Старые маршруты, которыми пользуется текущий фронтенд. Обслуживаются теми же обработчиками, что и API.
+	routes.legacy(mux, "/registration", "POST /users")
+	routes.legacy(mux, "/authorization", "POST /sessions")
+	routes.legacy(mux, "/profileInfo", "GET /profile")
+	routes.legacy(mux, "/profileImage", "GET /profile/image")
+	routes.legacy(mux, "/setLanguage", "PUT /profile/language")
+	routes.legacy(mux, "/addCar", "POST /cars")
+	routes.legacy(mux, "/removeCar", "DELETE /cars/{id}")
+	routes.legacy(mux, "/updateCar", "PUT /cars/{id}")
+	routes.legacy(mux, "/getCarEdits", "GET /cars/{id}/edits")
+	routes.legacy(mux, "/logOut", "DELETE /sessions")
+	routes.legacy(mux, "/getCars", "GET /cars")
+	routes.legacy(mux, "/addOrder", "POST /orders")
+	routes.legacy(mux, "/getOrders", "GET /orders")
+	routes.legacy(mux, "/addMessageToOrder", "POST /orders/{orderID}/messages")
+	routes.legacy(mux, "/getMessages", "GET /orders/{orderID}/messages")
+	routes.legacy(mux, "/orderEvents", "GET /orders/events")
+	routes.legacy(mux, "/markMessagesRead", "POST /orders/{orderID}/read")
+	routes.legacy(mux, "/getUnreadCounts", "GET /unread")
+	routes.legacy(mux, "/getAdminMessages", "GET /admin/orders/{orderID}/messages")
+	routes.legacy(mux, "/getAttachment", "GET /attachments/{id}")
+	routes.legacy(mux, "/getAdminInbox", "GET /admin/inbox")
+	routes.legacy(mux, "/assignAdminOrder", "PUT /admin/orders/{orderID}/assignee")
+	routes.legacy(mux, "/getNotificationPreferences", "GET /notifications/preferences")
+	routes.legacy(mux, "/setNotificationPreference", "PUT /notifications/preferences/{channel}")
+	routes.legacy(mux, "/linkTelegram", "POST /telegram/link")
+	routes.legacy(mux, "/unlinkTelegram", "DELETE /telegram/link")
+	routes.legacy(mux, "/getCalendarFeed", "GET /calendar/feed")
+	routes.legacy(mux, "/resetCalendarFeed", "POST /calendar/feed")
+	routes.legacy(mux, "/getAdminTemplates", "GET /admin/templates")
+	routes.legacy(mux, "/addAdminTemplate", "POST /admin/templates")
+	routes.legacy(mux, "/updateAdminTemplate", "PUT /admin/templates/{id}")
+	routes.legacy(mux, "/removeAdminTemplate", "DELETE /admin/templates/{id}")
+	routes.legacy(mux, "/previewAdminTemplate", "GET /admin/templates/{templateID}/preview")
+	routes.legacy(mux, "/addAdminMessage", "POST /admin/orders/{orderID}/messages")
+	routes.legacy(mux, "/carHistory", "GET /vin/{vin}/history")
+	routes.legacy(mux, "/carHistoryPDF", "GET /vin/{vin}/history.pdf")
+	routes.legacy(mux, "/addAdminOrderItem", "POST /admin/orders/{orderID}/items")
+	routes.legacy(mux, "/addAdminCarNote", "POST /admin/vin/{vin}/notes")
+	routes.legacy(mux, "/decodeVIN", "GET /vin/{vin}")
+	routes.legacy(mux, "/addOdometerReading", "POST /cars/{carID}/odometer")
+	routes.legacy(mux, "/getReminders", "GET /reminders")
+	routes.legacy(mux, "/closeAdminOrder", "POST /admin/orders/{orderID}/close")
+	routes.legacy(mux, "/cancelAdminOrder", "POST /admin/orders/{orderID}/cancel")
+	routes.legacy(mux, "/rescheduleAdminOrder", "PUT /admin/orders/{orderID}/date")
+	routes.legacy(mux, "/createOrganisation", "POST /organisations")
+	routes.legacy(mux, "/getOrganisations", "GET /organisations")
+	routes.legacy(mux, "/addOrgMember", "POST /organisations/{orgID}/members")
+	routes.legacy(mux, "/removeOrgMember", "DELETE /organisations/{orgID}/members/{userID}")
+	routes.legacy(mux, "/transferCar", "POST /cars/{carID}/transfers")
+	routes.legacy(mux, "/getCarTransfers", "GET /transfers")
+	routes.legacy(mux, "/acceptCarTransfer", "POST /transfers/{id}/accept")
+	routes.legacy(mux, "/declineCarTransfer", "POST /transfers/{id}/decline")
+
+	return routes
+}
+
+// handle - регистрирует обработчик пути pattern с уровнем доступа и описанием из route.
+// Путь в route - pattern с параметрами в фигурных скобках.
+func (table *routeTable) handle(mux routeMux, pattern string, route *muxRoute, handler http.HandlerFunc) {
+	mux.Handle(pattern, protect(route.access, handler))
+	table.mux = append(table.mux, route)
+}
+
+// mirror - регистрирует путь path, который обслуживается так же, как операция API key ("МЕТОД шаблон").
+func (table *routeTable) mirror(mux routeMux, path string, key string) {
+	route := table.api.route(key)
+	mux.Handle(path, route.handler)
+	table.mux = append(table.mux, &muxRoute{methods: []string{route.method}, path: path, access: route.access,
+		operation: apiOperations[key]})
+}
+
+// legacy - регистрирует старый маршрут path, который обслуживается тем же обработчиком с тем же уровнем
+// доступа, что и операция API key ("МЕТОД шаблон"). Старые маршруты принимают любой метод,
+// в спецификации чтение описывается методом GET, остальное - POST.
+func (table *routeTable) legacy(mux routeMux, path string, key string) {
+	route := table.api.route(key)
+	mux.Handle(path, route.handler)
+
+	method := http.MethodPost
+	if route.method == http.MethodGet {
+		method = http.MethodGet
+	}
+	table.mux = append(table.mux, &muxRoute{methods: []string{method}, path: path, access: route.access,
+		operation: apiOperations[key], replacement: route.method + " " + route.pattern})
+}
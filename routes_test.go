@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// staffRoutes - служебные маршруты, которые должны быть доступны только сотрудникам.
+var staffRoutes = []struct {
+	method string
+	path   string
+}{
+	{http.MethodPost, apiPrefix + "/admin/orders/1/items"},
+	{http.MethodPost, apiPrefix + "/admin/vin/XTA210990Y2766389/notes"},
+	{http.MethodPost, "/addAdminOrderItem"},
+	{http.MethodPost, "/addAdminCarNote"},
+	{http.MethodPost, apiPrefix + "/admin/orders/1/close"},
+	{http.MethodPost, "/closeAdminOrder"},
+	{http.MethodPost, apiPrefix + "/admin/orders/1/cancel"},
+	{http.MethodPost, "/cancelAdminOrder"},
+	{http.MethodPut, apiPrefix + "/admin/orders/1/date"},
+	{http.MethodPost, "/rescheduleAdminOrder"},
+	{http.MethodPost, apiPrefix + "/admin/orders/1/messages"},
+	{http.MethodPost, "/addAdminMessage"},
+	{http.MethodGet, apiPrefix + "/admin/orders/1/messages"},
+	{http.MethodGet, "/getAdminMessages"},
+	{http.MethodPut, apiPrefix + "/admin/templates/1"},
+	{http.MethodPost, "/updateAdminTemplate"},
+}
+
+// useMockDB - подменяет базу данных на sqlmock до конца теста.
+func useMockDB(t *testing.T) sqlmock.Sqlmock {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+
+	previous := db
+	db = mockDB
+	t.Cleanup(func() {
+		db = previous
+		mockDB.Close()
+	})
+
+	return mock
+}
+
+// errorCode - код ошибки из json ответа.
+func errorCode(recorder *httptest.ResponseRecorder) string {
+	var response struct{ Error *APIError }
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil || response.Error == nil {
+		return ""
+	}
+
+	return response.Error.Code
+}
+
+// fieldCodes - коды ошибок валидации из json ответа по полям.
+func fieldCodes(recorder *httptest.ResponseRecorder) map[string]string {
+	var response struct{ Error *APIError }
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil || response.Error == nil {
+		return nil
+	}
+
+	codes := make(map[string]string)
+	for _, field := range response.Error.Fields {
+		codes[field.Field] = field.Code
+	}
+
+	return codes
+}
+
+// TestStaffRoutesRejectAnonymous - служебные маршруты, зарегистрированные в registerRoutes,
+// не пускают запросы без авторизации. Обработчик при этом не вызывается, поэтому база данных не нужна.
+func TestStaffRoutesRejectAnonymous(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+
+	for _, route := range staffRoutes {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(route.method, route.path, nil))
+
+		if recorder.Code != http.StatusUnauthorized || errorCode(recorder) != CodeUnauthorized {
+			t.Errorf("%s %s без авторизации: код %d, ответ %s", route.method, route.path, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+// TestExpiredTokenRejected - недействительный токен дает 401, чтобы клиент снова выполнил вход.
+func TestExpiredTokenRejected(t *testing.T) {
+	mock := useMockDB(t)
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+
+	mock.ExpectQuery(`FROM authorizations`).WithArgs("expired-token").WillReturnRows(sqlmock.NewRows([]string{"userid", "language"}))
+
+	request := httptest.NewRequest(http.MethodGet, apiPrefix+"/reminders", nil)
+	request.AddCookie(&http.Cookie{Name: "token", Value: "expired-token"})
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusUnauthorized || errorCode(recorder) != CodeTokenExpired {
+		t.Errorf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestStaffRoutesRejectCustomers - служебные маршруты не пускают авторизованного пользователя без прав сотрудника.
+func TestStaffRoutesRejectCustomers(t *testing.T) {
+	mock := useMockDB(t)
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+
+	for _, route := range staffRoutes {
+		mock.ExpectQuery(`FROM authorizations`).WithArgs("customer-token").
+			WillReturnRows(sqlmock.NewRows([]string{"userid", "language"}).AddRow("5", ""))
+		mock.ExpectQuery(`SELECT isstaff FROM users`).WithArgs("5").
+			WillReturnRows(sqlmock.NewRows([]string{"isstaff"}).AddRow(false))
+
+		request := httptest.NewRequest(route.method, route.path, nil)
+		request.AddCookie(&http.Cookie{Name: "token", Value: "customer-token"})
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusForbidden || errorCode(recorder) != CodeForbidden {
+			t.Errorf("%s %s клиентом: код %d, ответ %s", route.method, route.path, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestMetricsNotPublic - метрики отдаются только служебным сервером, а не маршрутами API.
+func TestMetricsNotPublic(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("%s на публичном сервере: код %d", metricsPath, recorder.Code)
+	}
+}
+
+// recordingMux - ServeMux, который запоминает зарегистрированные пути.
+type recordingMux struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func (mux *recordingMux) Handle(pattern string, handler http.Handler) {
+	mux.patterns = append(mux.patterns, pattern)
+	mux.ServeMux.Handle(pattern, handler)
+}
+
+// TestRoutesDocumented - каждый путь, который регистрирует registerRoutes, включая старые маршруты,
+// GraphQL и календари, описан в спецификации, и каждый описанный путь обслуживается сервером.
+func TestRoutesDocumented(t *testing.T) {
+	mux := &recordingMux{ServeMux: http.NewServeMux()}
+	data, err := buildOpenAPIDocument(registerRoutes(mux))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var document struct {
+		Servers []struct{ URL string }
+		Paths   map[string]map[string]json.RawMessage
+	}
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := make([]string, 0)
+	for pattern, item := range document.Paths {
+		servers := document.Servers
+		if raw, ok := item["servers"]; ok {
+			servers = nil
+			err = json.Unmarshal(raw, &servers)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, server := range servers {
+			documented = append(documented, strings.TrimSuffix(server.URL, "/")+pattern)
+		}
+	}
+
+	for _, pattern := range mux.patterns {
+		found := false
+		for _, path := range documented {
+			found = found || path == pattern || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern))
+		}
+		if !found {
+			t.Errorf("путь %s зарегистрирован, но не описан в спецификации", pattern)
+		}
+	}
+
+	for _, path := range documented {
+		request := httptest.NewRequest(http.MethodGet, pathParam.ReplaceAllString(path, "1"), nil)
+		if _, pattern := mux.Handler(request); pattern == "" {
+			t.Errorf("путь %s описан в спецификации, но не обслуживается", path)
+		}
+	}
+}
+
+// pathParam - параметр пути в шаблоне спецификации.
+var pathParam = regexp.MustCompile(`\{[^}]+\}`)
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/STEJLS/ServiceStation/XMLconfig"
+)
+
+// newHTTPServer - создает http сервер с таймаутами и ограничением размера заголовков из конфигурации.
+func newHTTPServer(config XMLconfig.Http, handler http.Handler) *http.Server {
+	maxHeaderBytes := config.MaxHeaderBytes
+	if maxHeaderBytes == 0 {
+		maxHeaderBytes = defaultMaxHeaderBytes
+	}
+
+	return &http.Server{
+		Addr:              fmt.Sprintf("%v:%v", config.Host, config.Port),
+		Handler:           handler,
+		ReadTimeout:       configSeconds(config.ReadTimeout, defaultReadTimeout),
+		ReadHeaderTimeout: configSeconds(config.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		WriteTimeout:      configSeconds(config.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       configSeconds(config.IdleTimeout, defaultIdleTimeout),
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
+}
+
+// configSeconds - время из конфигурации в секундах, 0 - значение по умолчанию.
+func configSeconds(seconds int, defaultValue time.Duration) time.Duration {
+	if seconds == 0 {
+		return defaultValue
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// startWorker - запускает фоновую задачу, которая должна завершиться после отмены ctx.
+// По workers остановка сервиса дожидается ее завершения.
+func startWorker(ctx context.Context, workers *sync.WaitGroup, worker func(ctx context.Context)) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		worker(ctx)
+	}()
+}
+
+// shutdown - плавно останавливает сервис: http сервер перестает принимать соединения,
+// потоки событий завершаются, текущие запросы и фоновые задачи дорабатывают, но не дольше timeout.
+// Фоновые задачи к этому моменту уже должны получить отмену своего контекста.
+func shutdown(server *http.Server, workers *sync.WaitGroup, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	events.shutdown()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		log.Println("Ошибка. Не все http запросы завершились за отведенное время: " + err.Error())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("Инфо. Сервис остановлен.")
+	case <-ctx.Done():
+		log.Println("Ошибка. Не все фоновые задачи завершились за отведенное время.")
+	}
+}
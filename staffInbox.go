@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// getAdminInboxHandler - отдает сотруднику список переписок по заказам,
+// отсортированный по дате последнего сообщения клиента.
+// Параметры фильтрации: status - статус заказа, assignee - ид ответственного сотрудника,
+// "me" или "none", unanswered=true - только переписки без ответа сотрудника,
+// query - поиск по тексту сообщений. Для постраничного вывода - offset.
+func getAdminInboxHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	args := []interface{}{id}
+	conditions := make([]string, 0)
+	addArg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if status := r.FormValue("status"); status != "" {
+		if _, err := strconv.Atoi(status); err != nil {
+			writeFieldError(w, "status", CodeInvalidStatus)
+			return
+		}
+		conditions = append(conditions, "o.status = "+addArg(status))
+	}
+
+	switch assignee := r.FormValue("assignee"); assignee {
+	case "":
+	case "none":
+		conditions = append(conditions, "o.assigneeid IS NULL")
+	case "me":
+		conditions = append(conditions, "o.assigneeid = $1")
+	default:
+		if _, err := strconv.Atoi(assignee); err != nil {
+			writeFieldError(w, "assignee", CodeInvalidAssignee)
+			return
+		}
+		conditions = append(conditions, "o.assigneeid = "+addArg(assignee))
+	}
+
+	if r.FormValue("unanswered") == "true" {
+		conditions = append(conditions, "lm.isadmin = FALSE")
+	}
+
+	if query := strings.TrimSpace(r.FormValue("query")); query != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+		conditions = append(conditions, "EXISTS(SELECT 1 FROM messages s WHERE s.orderid = o.id AND s.text ILIKE "+addArg(pattern)+")")
+	}
+
+	offset, err := strconv.Atoi(r.FormValue("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	where := ""
+	if len(conditions) != 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := db.Query(`SELECT o.id, o.status, c.brand || ' ' || c.model || '(' || c.year || ')', u.name || ' ' || u.lastname,
+	COALESCE(o.assigneeid::text, ''), lc.text, lc.date, NOT lm.isadmin,
+	(SELECT COUNT(*) FROM messages m WHERE m.orderid = o.id AND m.isadmin = FALSE
+		AND m.id > COALESCE((SELECT r.lastmessageid FROM messagereads r WHERE r.orderid = o.id AND r.userid = $1), 0))
+	FROM orders o JOIN cars c ON c.id = o.carid JOIN users u ON u.id = o.userid
+	JOIN LATERAL (SELECT text, date FROM messages WHERE orderid = o.id AND isadmin = FALSE ORDER BY date DESC, id DESC LIMIT 1) lc ON TRUE
+	JOIN LATERAL (SELECT isadmin FROM messages WHERE orderid = o.id ORDER BY date DESC, id DESC LIMIT 1) lm ON TRUE
+	`+where+` ORDER BY lc.date DESC LIMIT `+strconv.Itoa(inboxPageSize)+` OFFSET `+addArg(offset), args...)
+	if err != nil {
+		log.Printf("Ошибка. При выборке из БД переписок для сотрудника(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+	defer rows.Close()
+
+	result := make([]*InboxConversation, 0)
+
+	for rows.Next() {
+		conversation := InboxConversation{}
+		err = rows.Scan(&conversation.OrderID, &conversation.Status, &conversation.CarInfo, &conversation.CustomerName,
+			&conversation.AssigneeID, &conversation.LastCustomerMessage, &conversation.LastCustomerMessageDate,
+			&conversation.Unanswered, &conversation.Unread)
+		if err != nil {
+			log.Printf("Ошибка. При выборке из БД переписок для сотрудника(ид =  %s): %s\n", id, err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+		result = append(result, &conversation)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// assignAdminOrderHandler - назначает сотрудника ответственным за заказ.
+// Если ид сотрудника не передан, то заказ остается без ответственного.
+func assignAdminOrderHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	orderID := r.FormValue("orderID")
+	assigneeID := r.FormValue("assigneeID")
+	if _, err := strconv.Atoi(orderID); err != nil {
+		writeFieldError(w, "orderID", CodeInvalidOrderID)
+		return
+	}
+	if _, err := strconv.Atoi(assigneeID); assigneeID != "" && err != nil {
+		writeFieldError(w, "assigneeID", CodeInvalidAssignee)
+		return
+	}
+
+	if assigneeID != "" {
+		staff, err := isStaff(assigneeID)
+		if err != nil {
+			log.Println("Ошибка. При поиске в БД роли пользователя: " + err.Error())
+			writeError(w, http.StatusInternalServerError, CodeInternal)
+			return
+		}
+		if !staff {
+			writeFieldError(w, "assigneeID", CodeAssigneeNotStaff)
+			return
+		}
+	}
+
+	result, err := db.Exec(`UPDATE orders SET assigneeid = $1, `+orderRevised+` WHERE id = $2`, sql.NullString{String: assigneeID, Valid: assigneeID != ""}, orderID)
+	if err != nil {
+		log.Printf("Ошибка. При назначении ответственного за заказ(ид = %s): %s\n", orderID, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		writeError(w, http.StatusBadRequest, CodeOrderNotFound)
+		return
+	}
+
+	log.Printf("Инфо. Сотрудник (ид = %s) назначил ответственным за заказ(ид = %s) сотрудника(ид = %s)", id, orderID, assigneeID)
+	writeMessage(w, MsgAssigneeSaved)
+}
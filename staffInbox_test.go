@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// inboxColumns - колонки выборки переписок для сотрудника.
+var inboxColumns = []string{"id", "status", "car", "customer", "assigneeid", "text", "date", "unanswered", "unread"}
+
+// TestAdminInboxFilters - фильтры превращаются в условия запроса с параметрами,
+// спецсимволы LIKE в поисковом запросе экранируются.
+func TestAdminInboxFilters(t *testing.T) {
+	mock := useMockDB(t)
+	date := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	mock.ExpectQuery(`WHERE o.status = \$2 AND o.assigneeid = \$1 AND lm.isadmin = FALSE AND EXISTS\(.* ILIKE \$3\) ORDER BY lc.date DESC LIMIT \d+ OFFSET \$4`).
+		WithArgs("5", "2", `%50\%\_off%`, 20).
+		WillReturnRows(sqlmock.NewRows(inboxColumns).AddRow("9", StatusСonfirmed, "Lada Vesta(2020)", "Иван Петров", "5", "Скидка 50%_off?", date, true, 2))
+
+	recorder := httptest.NewRecorder()
+	getAdminInboxHandler(recorder, userRequest("5", url.Values{
+		"status": {"2"}, "assignee": {"me"}, "unanswered": {"true"}, "query": {" 50%_off "}, "offset": {"20"},
+	}))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	conversations := make([]*InboxConversation, 0)
+	err := json.Unmarshal(recorder.Body.Bytes(), &conversations)
+	if err != nil || len(conversations) != 1 || conversations[0].OrderID != "9" || !conversations[0].Unanswered || conversations[0].Unread != 2 {
+		t.Errorf("ответ %s", recorder.Body.String())
+	}
+
+	mock.ExpectQuery(`WHERE o.assigneeid IS NULL ORDER BY`).WithArgs("5", 0).WillReturnRows(sqlmock.NewRows(inboxColumns))
+	recorder = httptest.NewRecorder()
+	getAdminInboxHandler(recorder, userRequest("5", url.Values{"assignee": {"none"}, "offset": {"-1"}}))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "[]" {
+		t.Errorf("без ответственного: код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestAdminInboxInvalidFilters - нечисловые статус и ответственный отклоняются.
+func TestAdminInboxInvalidFilters(t *testing.T) {
+	useMockDB(t)
+
+	tests := map[string]url.Values{
+		"status":   {"status": {"open"}},
+		"assignee": {"assignee": {"someone"}},
+	}
+	for field, form := range tests {
+		recorder := httptest.NewRecorder()
+		getAdminInboxHandler(recorder, userRequest("5", form))
+		if recorder.Code != http.StatusBadRequest || fieldCodes(recorder)[field] == "" {
+			t.Errorf("%s: код %d, ответ %s", field, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+// TestAssignAdminOrder - ответственным можно назначить только сотрудника, назначение увеличивает ревизию заказа,
+// пустой ид снимает назначение.
+func TestAssignAdminOrder(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery(`SELECT isstaff FROM users`).WithArgs("6").WillReturnRows(sqlmock.NewRows([]string{"isstaff"}).AddRow(false))
+
+	recorder := httptest.NewRecorder()
+	assignAdminOrderHandler(recorder, userRequest("5", url.Values{"orderID": {"9"}, "assigneeID": {"6"}}))
+	if recorder.Code != http.StatusBadRequest || fieldCodes(recorder)["assigneeID"] != CodeAssigneeNotStaff {
+		t.Errorf("не сотрудник: код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	mock.ExpectQuery(`SELECT isstaff FROM users`).WithArgs("7").WillReturnRows(sqlmock.NewRows([]string{"isstaff"}).AddRow(true))
+	mock.ExpectExec(`UPDATE orders SET assigneeid = \$1, updated = now\(\), revision = revision \+ 1 WHERE id = \$2`).
+		WithArgs("7", "9").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	recorder = httptest.NewRecorder()
+	assignAdminOrderHandler(recorder, userRequest("5", url.Values{"orderID": {"9"}, "assigneeID": {"7"}}))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != localize(defaultLanguage, MsgAssigneeSaved) {
+		t.Errorf("назначение: код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	mock.ExpectExec(`UPDATE orders SET assigneeid`).WithArgs(nil, "10").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	recorder = httptest.NewRecorder()
+	assignAdminOrderHandler(recorder, userRequest("5", url.Values{"orderID": {"10"}}))
+	if recorder.Code != http.StatusBadRequest || errorCode(recorder) != CodeOrderNotFound {
+		t.Errorf("несуществующий заказ: код %d, ответ %s", recorder.Code, recorder.Body.String())
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
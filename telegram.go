@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/STEJLS/ServiceStation/XMLconfig"
+)
+
+// telegram - бот, через который пользователи получают уведомления и отвечают по заказам.
+// Если бот не настроен, то nil.
+var telegram *telegramBot
+
+// telegramBot - клиент Telegram Bot API.
+type telegramBot struct {
+	apiURL   string
+	token    string
+	username string
+	client   *http.Client
+}
+
+// telegramResponse - общий формат ответа Bot API.
+type telegramResponse struct {
+	OK          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+// telegramUpdate - входящее обновление бота.
+type telegramUpdate struct {
+	UpdateID int              `json:"update_id"`
+	Message  *telegramMessage `json:"message"`
+}
+
+// telegramMessage - сообщение в чате с ботом.
+type telegramMessage struct {
+	MessageID      int64            `json:"message_id"`
+	Chat           telegramChat     `json:"chat"`
+	From           *telegramUser    `json:"from"`
+	Text           string           `json:"text"`
+	ReplyToMessage *telegramMessage `json:"reply_to_message"`
+}
+
+// telegramChat - чат с ботом.
+type telegramChat struct {
+	ID int64 `json:"id"`
+}
+
+// telegramUser - пользователь или бот (метод getMe). Язык есть только у пользователей.
+type telegramUser struct {
+	Username     string `json:"username"`
+	LanguageCode string `json:"language_code"`
+}
+
+// initTelegram - создает бота, если в конфигурации указан его токен,
+// и регистрирует его как канал уведомлений.
+func initTelegram(config XMLconfig.Telegram) {
+	if config.Token == "" {
+		return
+	}
+
+	apiURL := strings.TrimRight(config.APIURL, "/")
+	if apiURL == "" {
+		apiURL = telegramDefaultAPIURL
+	}
+
+	bot := &telegramBot{
+		apiURL: apiURL,
+		token:  config.Token,
+		client: &http.Client{Timeout: (telegramPollTimeout + 10) * time.Second},
+	}
+
+	me := telegramUser{}
+	err := bot.call(context.Background(), "getMe", nil, &me)
+	if err != nil {
+		log.Println("Ошибка. При подключении к telegram боту, бот не будет работать: " + err.Error())
+		return
+	}
+	bot.username = me.Username
+
+	telegram = bot
+	notifiers[ChannelTelegram] = bot
+	log.Printf("Инфо. Подключен telegram бот @%s", bot.username)
+}
+
+// call - вызывает метод Bot API и раскладывает результат в result.
+func (bot *telegramBot) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	data := []byte("{}")
+	if params != nil {
+		var err error
+		data, err = json.Marshal(params)
+		if err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, bot.apiURL+"/bot"+bot.token+"/"+method, bytes.NewReader(data))
+	if err != nil {
+		return withoutURL(method, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := bot.client.Do(request)
+	if err != nil {
+		return withoutURL(method, err)
+	}
+	defer response.Body.Close()
+
+	answer := telegramResponse{}
+	err = json.NewDecoder(response.Body).Decode(&answer)
+	if err != nil {
+		return fmt.Errorf("некорректный ответ Bot API(%s): %s", response.Status, err.Error())
+	}
+	if !answer.OK {
+		return fmt.Errorf("Bot API ответил %s: %s", response.Status, answer.Description)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(answer.Result, result)
+}
+
+// withoutURL - ошибка http клиента без адреса запроса: в адресе Bot API есть токен бота,
+// который не должен попасть в логи.
+func withoutURL(method string, err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s %s: %w", urlErr.Op, method, urlErr.Err)
+	}
+
+	return err
+}
+
+// sendMessage - отправляет текст в чат и возвращает ид отправленного сообщения.
+func (bot *telegramBot) sendMessage(chatID int64, text string) (int64, error) {
+	message := telegramMessage{}
+	err := bot.call(context.Background(), "sendMessage", map[string]interface{}{"chat_id": chatID, "text": text}, &message)
+	return message.MessageID, err
+}
+
+// reply - отвечает пользователю в чат, ошибки только логируются.
+func (bot *telegramBot) reply(chatID int64, text string) {
+	_, err := bot.sendMessage(chatID, text)
+	if err != nil {
+		log.Printf("Ошибка. При отправке ответа в telegram чат(ид = %d): %s\n", chatID, err.Error())
+	}
+}
+
+// Send - отправляет уведомление в привязанный чат. Если уведомление относится к заказу,
+// то запоминается, к какому заказу относится сообщение бота, чтобы принимать на него ответы.
+func (bot *telegramBot) Send(notification *Notification) error {
+	chatID, err := strconv.ParseInt(notification.Address, 10, 64)
+	if err != nil {
+		return fmt.Errorf("некорректный ид telegram чата %q", notification.Address)
+	}
+
+	text := notification.Subject + "\n\n" + notification.Text
+	if notification.OrderID != "" {
+		text += "\n\n" + localize(userLanguage(notification.UserID), NotifyReplyHint)
+	}
+
+	messageID, err := bot.sendMessage(chatID, text)
+	if err != nil {
+		return err
+	}
+
+	if notification.OrderID != "" {
+		_, err = db.Exec(`INSERT INTO telegrammessages(chatid, messageid, orderid) VALUES($1, $2, $3)`,
+			chatID, messageID, notification.OrderID)
+		if err != nil {
+			log.Printf("Ошибка. При сохранении в БД сообщения telegram бота(ид уведомления = %s): %s\n", notification.ID, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// telegramWorker - фоновая задача, которая получает сообщения боту через long polling и обрабатывает их.
+// Bot API не допускает одновременный long polling, поэтому бот должен быть настроен только на одном экземпляре сервиса.
+func telegramWorker(ctx context.Context) {
+	if telegram == nil {
+		return
+	}
+
+	offset := 0
+	for ctx.Err() == nil {
+		updates := make([]*telegramUpdate, 0)
+		err := telegram.call(ctx, "getUpdates", map[string]interface{}{
+			"offset":          offset,
+			"timeout":         telegramPollTimeout,
+			"allowed_updates": []string{"message"},
+		}, &updates)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Println("Ошибка. При получении сообщений telegram бота: " + err.Error())
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message != nil {
+				telegram.handleMessage(update.Message)
+			}
+		}
+	}
+}
+
+// handleMessage - обрабатывает сообщение пользователя боту: команды привязки и отвязки аккаунта
+// и ответы на уведомления по заказам.
+func (bot *telegramBot) handleMessage(message *telegramMessage) {
+	chatID := message.Chat.ID
+	text := strings.TrimSpace(message.Text)
+
+	lang := defaultLanguage
+	if message.From != nil {
+		lang = negotiateLanguage(message.From.LanguageCode)
+	}
+
+	switch {
+	case strings.HasPrefix(text, "/start"):
+		code := strings.TrimSpace(strings.TrimPrefix(text, "/start"))
+		if code == "" {
+			bot.reply(chatID, localize(lang, BotStartHelp))
+			return
+		}
+		bot.reply(chatID, linkTelegramChat(chatID, code, lang))
+	case text == "/stop":
+		bot.reply(chatID, unlinkTelegramChat(chatID, lang))
+	case message.ReplyToMessage != nil:
+		bot.reply(chatID, addTelegramReply(chatID, message.ReplyToMessage.MessageID, message.Text, lang))
+	default:
+		bot.reply(chatID, localize(lang, BotHelp))
+	}
+}
+
+// linkTelegramChat - привязывает чат к аккаунту по одноразовому коду и включает уведомления в telegram.
+// Возвращает текст ответа пользователю на языке lang.
+func linkTelegramChat(chatID int64, code string, lang string) string {
+	var userID string
+	err := db.QueryRow(`DELETE FROM telegramlinks WHERE code = $1 AND created > $2 RETURNING userid`,
+		code, time.Now().Add(-telegramLinkTTL)).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return localize(lang, BotLinkInvalid)
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД кода привязки telegram: " + err.Error())
+		return localize(lang, CodeInternal)
+	}
+
+	address := strconv.FormatInt(chatID, 10)
+	_, err = db.Exec(`DELETE FROM notificationprefs WHERE channel = $1 AND address = $2 AND userid <> $3`, ChannelTelegram, address, userID)
+	if err == nil {
+		_, err = db.Exec(`INSERT INTO notificationprefs(userid, channel, address, enabled) VALUES($1, $2, $3, TRUE)
+		ON CONFLICT (userid, channel) DO UPDATE SET address = EXCLUDED.address, enabled = TRUE`, userID, ChannelTelegram, address)
+	}
+	if err != nil {
+		log.Printf("Ошибка. При привязке telegram к пользователю(ид = %s): %s\n", userID, err.Error())
+		return localize(lang, CodeInternal)
+	}
+
+	log.Printf("Инфо. Пользователь (ид = %s) привязал telegram", userID)
+	return localize(lang, BotLinked)
+}
+
+// unlinkTelegramChat - отвязывает чат от аккаунта. Возвращает текст ответа пользователю на языке lang.
+func unlinkTelegramChat(chatID int64, lang string) string {
+	_, err := db.Exec(`DELETE FROM notificationprefs WHERE channel = $1 AND address = $2`, ChannelTelegram, strconv.FormatInt(chatID, 10))
+	if err != nil {
+		log.Println("Ошибка. При отвязке telegram чата: " + err.Error())
+		return localize(lang, CodeInternal)
+	}
+
+	return localize(lang, BotUnlinked)
+}
+
+// addTelegramReply - добавляет ответ пользователя на уведомление бота в переписку по заказу.
+// Возвращает текст ответа пользователю на языке lang.
+func addTelegramReply(chatID int64, replyToID int64, text string, lang string) string {
+	var userID, orderID string
+	err := db.QueryRow(`SELECT p.userid, t.orderid FROM telegrammessages t
+	JOIN notificationprefs p ON p.channel = $1 AND p.address = t.chatid::text
+	WHERE t.chatid = $2 AND t.messageid = $3`, ChannelTelegram, chatID, replyToID).Scan(&userID, &orderID)
+	if err == sql.ErrNoRows {
+		return localize(lang, BotOrderUnknown)
+	}
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД заказа для ответа из telegram: " + err.Error())
+		return localize(lang, CodeInternal)
+	}
+
+	message := &Message{
+		IsAdmin:     false,
+		Date:        time.Now(),
+		Text:        text,
+		OrderID:     orderID,
+		Attachments: make([]*Attachment, 0),
+	}
+
+	resultOfValidation := ValidateMessage(message)
+	if len(resultOfValidation) != 0 {
+		log.Println("Инфо. Попытка добавить сообщение из telegram с невалидными данными: " + resultOfValidation.String())
+		return resultOfValidation.text(lang)
+	}
+
+	code, err := saveCustomerMessage(userID, message)
+	if err != nil {
+		log.Printf("Ошибка. При добавлении сообщения из telegram к заказу(ид пользователя =  %s,ид заказа =  %s ): %s\n", userID, orderID, err.Error())
+		return localize(lang, CodeInternal)
+	}
+	if code != "" {
+		return localize(lang, code)
+	}
+
+	return localize(lang, BotMessageAdded, orderID)
+}
+
+// linkTelegramHandler - выдает пользователю одноразовый код для привязки telegram
+// и ссылку, по которой бот сразу получит этот код.
+func linkTelegramHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	if telegram == nil {
+		writeError(w, http.StatusBadRequest, CodeTelegramDisabled)
+		return
+	}
+
+	code := generateToken()
+	_, err := db.Exec(`INSERT INTO telegramlinks(code, userid, created) VALUES($1, $2, $3)`, code, id, time.Now())
+	if err != nil {
+		log.Printf("Ошибка. При сохранении в БД кода привязки telegram пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	data, err := json.Marshal(struct {
+		Code string
+		Link string
+	}{code, "https://t.me/" + telegram.username + "?start=" + code})
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// unlinkTelegramHandler - отвязывает telegram от аккаунта пользователя.
+func unlinkTelegramHandler(w http.ResponseWriter, r *http.Request) {
+	id := currentUserID(r)
+
+	_, err := db.Exec(`DELETE FROM notificationprefs WHERE userid = $1 AND channel = $2`, id, ChannelTelegram)
+	if err != nil {
+		log.Printf("Ошибка. При отвязке telegram пользователя(ид =  %s): %s\n", id, err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	log.Printf("Инфо. Пользователь (ид = %s) отвязал telegram", id)
+	writeMessage(w, MsgTelegramUnlinked)
+}
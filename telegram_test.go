@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/STEJLS/ServiceStation/XMLconfig"
+)
+
+// TestTelegramCallHidesToken - ошибка соединения с Bot API не содержит токен бота.
+func TestTelegramCallHidesToken(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	bot := &telegramBot{apiURL: server.URL, token: "123456:secret-token", client: server.Client()}
+	err := bot.call(context.Background(), "getMe", nil, nil)
+	if err == nil {
+		t.Fatal("ожидалась ошибка соединения")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("токен в тексте ошибки: %s", err.Error())
+	}
+	if !strings.Contains(err.Error(), "getMe") {
+		t.Errorf("в ошибке нет метода Bot API: %s", err.Error())
+	}
+}
+
+// botCall - вызов метода Bot API, полученный фейковым сервером.
+type botCall struct {
+	Method string
+	ChatID int64  `json:"chat_id"`
+	Text   string `json:"text"`
+	Offset int    `json:"offset"`
+}
+
+// fakeBotAPI - фейковый Bot API: запоминает вызовы, отдает заранее заданные пачки обновлений,
+// а когда обновления кончаются, вызывает stop, чтобы завершить long polling.
+type fakeBotAPI struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	calls   []botCall
+	updates [][]*telegramUpdate
+	stop    func()
+	lastID  int64
+}
+
+// newFakeBotAPI - запускает фейковый Bot API для бота с токеном token.
+func newFakeBotAPI(t *testing.T, token string, updates ...[]*telegramUpdate) *fakeBotAPI {
+	api := &fakeBotAPI{updates: updates, stop: func() {}}
+	api.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := strings.TrimPrefix(r.URL.Path, "/bot"+token+"/")
+		if method == r.URL.Path {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(telegramResponse{Description: "Unauthorized"})
+			return
+		}
+
+		call := botCall{}
+		json.NewDecoder(r.Body).Decode(&call)
+		call.Method = method
+
+		api.mu.Lock()
+		api.calls = append(api.calls, call)
+		var result interface{}
+		switch method {
+		case "getMe":
+			result = telegramUser{Username: "service_bot"}
+		case "getUpdates":
+			result = []*telegramUpdate{}
+			if len(api.updates) == 0 {
+				api.stop()
+			} else {
+				result, api.updates = api.updates[0], api.updates[1:]
+			}
+		case "sendMessage":
+			api.lastID++
+			result = telegramMessage{MessageID: api.lastID, Chat: telegramChat{ID: call.ChatID}, Text: call.Text}
+		}
+		api.mu.Unlock()
+
+		data, _ := json.Marshal(result)
+		json.NewEncoder(w).Encode(telegramResponse{OK: true, Result: data})
+	}))
+	t.Cleanup(api.server.Close)
+
+	return api
+}
+
+// useTelegram - подключает бота к фейковому Bot API на время теста.
+func useTelegram(t *testing.T, api *fakeBotAPI, token string) {
+	initTelegram(XMLconfig.Telegram{Token: token, APIURL: api.server.URL + "/"})
+	if telegram == nil {
+		t.Fatal("бот не подключен")
+	}
+	t.Cleanup(func() {
+		telegram = nil
+		delete(notifiers, ChannelTelegram)
+	})
+}
+
+// TestTelegramWorker - бот забирает обновления через getUpdates, привязывает аккаунт по команде /start,
+// сохраняет ответ на уведомление сообщением в заказе и отвечает пользователю через sendMessage.
+func TestTelegramWorker(t *testing.T) {
+	mock := useMockDB(t)
+	english := &telegramUser{LanguageCode: "en"}
+	api := newFakeBotAPI(t, "123:token", []*telegramUpdate{
+		{UpdateID: 10, Message: &telegramMessage{MessageID: 1, Chat: telegramChat{ID: 777}, From: english, Text: "/start link-code"}},
+		{UpdateID: 11, Message: &telegramMessage{MessageID: 2, Chat: telegramChat{ID: 777}, From: english, Text: "Когда будет готово?",
+			ReplyToMessage: &telegramMessage{MessageID: 42}}},
+	})
+	useTelegram(t, api, "123:token")
+
+	mock.ExpectQuery(`DELETE FROM telegramlinks`).WithArgs("link-code", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"userid"}).AddRow("5"))
+	mock.ExpectExec(`DELETE FROM notificationprefs`).WithArgs(ChannelTelegram, "777", "5").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO notificationprefs`).WithArgs("5", ChannelTelegram, "777").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(`FROM telegrammessages`).WithArgs(ChannelTelegram, int64(777), int64(42)).
+		WillReturnRows(sqlmock.NewRows([]string{"userid", "orderid"}).AddRow("5", "9"))
+	mock.ExpectQuery(`SELECT orders.status`).WithArgs("5", "9").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "writable"}).AddRow(StatusСonfirmed, true))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO messages`).WithArgs(false, sqlmock.AnyArg(), "Когда будет готово?", "9").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("31"))
+	mock.ExpectExec(`INSERT INTO messagereads`).WithArgs("9", "5", "31").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT userid FROM orders`).WillReturnRows(sqlmock.NewRows([]string{"userid"}).AddRow("5"))
+	mock.ExpectExec(`SELECT pg_notify`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	api.stop = cancel
+	telegramWorker(ctx)
+
+	expected := []botCall{
+		{Method: "getMe"},
+		{Method: "getUpdates", Offset: 0},
+		{Method: "sendMessage", ChatID: 777, Text: localize(LangEN, BotLinked)},
+		{Method: "sendMessage", ChatID: 777, Text: localize(LangEN, BotMessageAdded, "9")},
+		{Method: "getUpdates", Offset: 12},
+	}
+	if !reflect.DeepEqual(api.calls, expected) {
+		t.Errorf("вызовы Bot API:\n%+v\nожидалось:\n%+v", api.calls, expected)
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestTelegramStatusNotification - уведомление о смене статуса заказа уходит через sendMessage
+// с подсказкой об ответе, а сообщение бота запоминается, чтобы принимать на него ответы.
+func TestTelegramStatusNotification(t *testing.T) {
+	mock := useMockDB(t)
+	api := newFakeBotAPI(t, "123:token")
+	useTelegram(t, api, "123:token")
+
+	subject := localize(LangEN, NotifyConfirmedSubject, "9")
+	text := localize(LangEN, NotifyConfirmedText, "9")
+	columns := []string{"id", "userid", "channel", "address", "orderid", "subject", "text", "created", "attempts"}
+	mock.ExpectQuery(`UPDATE notifications SET attempts`).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("3", "5", ChannelTelegram, "777", "9", subject, text, time.Now(), 1))
+	mock.ExpectQuery(`SELECT language FROM users`).WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"language"}).AddRow(LangEN))
+	mock.ExpectExec(`INSERT INTO telegrammessages`).WithArgs(int64(777), int64(1), "9").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE notifications SET sent`).WithArgs(sqlmock.AnyArg(), "3").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if count := sendNotifications(); count != 1 {
+		t.Fatalf("отправлено %d уведомлений", count)
+	}
+
+	expected := []botCall{
+		{Method: "getMe"},
+		{Method: "sendMessage", ChatID: 777, Text: subject + "\n\n" + text + "\n\n" + localize(LangEN, NotifyReplyHint)},
+	}
+	if !reflect.DeepEqual(api.calls, expected) {
+		t.Errorf("вызовы Bot API:\n%+v\nожидалось:\n%+v", api.calls, expected)
+	}
+
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/STEJLS/ServiceStation/XMLconfig"
+)
+
+// staffTerminalsOnly - пускать сотрудников к служебным маршрутам только с проверенным клиентским сертификатом.
+// Включается, если в конфигурации указаны сертификаты УЦ терминалов сотрудников.
+var staffTerminalsOnly bool
+
+// certificateStore - текущий сертификат сервера. Перечитывается с диска по SIGHUP,
+// новые соединения сразу получают новый сертификат, перезапуск не нужен.
+type certificateStore struct {
+	certFile    string
+	keyFile     string
+	lock        sync.RWMutex
+	certificate *tls.Certificate
+}
+
+// load - читает сертификат и ключ с диска. Если прочитать не удалось, то остается прежний сертификат.
+func (store *certificateStore) load() error {
+	certificate, err := tls.LoadX509KeyPair(store.certFile, store.keyFile)
+	if err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	store.certificate = &certificate
+	store.lock.Unlock()
+
+	return nil
+}
+
+// getCertificate - отдает текущий сертификат при установке соединения.
+func (store *certificateStore) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	return store.certificate, nil
+}
+
+// reloadOnSIGHUP - фоновая задача, которая перечитывает сертификат по сигналу SIGHUP.
+func (store *certificateStore) reloadOnSIGHUP(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			err := store.load()
+			if err != nil {
+				log.Println("Ошибка. При перечитывании сертификата https, остается прежний: " + err.Error())
+				continue
+			}
+			log.Println("Инфо. Сертификат https перечитан.")
+		}
+	}
+}
+
+// newTLSConfig - настройки TLS для http и gRPC серверов. Если сертификат в конфигурации не указан,
+// то возвращает nil, и серверы работают без шифрования.
+func newTLSConfig(config XMLconfig.TLS) (*tls.Config, *certificateStore, error) {
+	if config.Cert == "" {
+		return nil, nil, nil
+	}
+
+	store := &certificateStore{certFile: config.Cert, keyFile: config.Key}
+	err := store.load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("сертификат https: %s", err.Error())
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: store.getCertificate,
+	}
+	if config.MinVersion == "1.3" {
+		tlsConfig.MinVersion = tls.VersionTLS13
+	}
+
+	if config.ClientCA != "" {
+		data, err := ioutil.ReadFile(config.ClientCA)
+		if err != nil {
+			return nil, nil, fmt.Errorf("сертификаты УЦ терминалов сотрудников: %s", err.Error())
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, nil, fmt.Errorf("в файле %q нет сертификатов УЦ терминалов сотрудников", config.ClientCA)
+		}
+
+		// Клиенты заходят без сертификата, сертификат требуется только на служебных маршрутах, см. checkStaffTerminal.
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		staffTerminalsOnly = true
+	}
+
+	return tlsConfig, store, nil
+}
+
+// checkStaffTerminal - проверяет, что запрос к служебному маршруту пришел с терминала сотрудника,
+// то есть с проверенным клиентским сертификатом. Если проверка терминалов не включена, то пропускает всех.
+// В случае отказа сам отвечает клиенту и возвращает false.
+func checkStaffTerminal(w http.ResponseWriter, r *http.Request) bool {
+	if !staffTerminalsOnly || r.TLS != nil && len(r.TLS.VerifiedChains) != 0 {
+		return true
+	}
+
+	log.Println("Инфо. Попытка доступа к служебным данным не с терминала сотрудника: " + r.RemoteAddr)
+	writeError(w, http.StatusForbidden, CodeClientCert)
+	return false
+}
+
+// redirectToHTTPS - фоновая задача, которая слушает http порт перенаправления
+// и отправляет все запросы на тот же адрес по https.
+func redirectToHTTPS(ctx context.Context, config XMLconfig.Http) {
+	server := &http.Server{
+		Addr:              fmt.Sprintf("%v:%v", config.Host, config.TLS.RedirectPort),
+		ReadHeaderTimeout: configSeconds(config.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		IdleTimeout:       configSeconds(config.IdleTimeout, defaultIdleTimeout),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				host = r.Host
+			}
+			if config.Port != 443 {
+				host = net.JoinHostPort(host, strconv.Itoa(config.Port))
+			}
+
+			// 308 сохраняет метод и тело запроса, 301 понятнее старым браузерам.
+			status := http.StatusPermanentRedirect
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				status = http.StatusMovedPermanently
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+		}),
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Инфо. Перенаправление с http порта %d на https", config.TLS.RedirectPort)
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Println("Ошибка. В работе сервера перенаправления на https: " + err.Error())
+	}
+}
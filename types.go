@@ -1,6 +1,7 @@
 package main
 
 import (
+	"mime/multipart"
 	"time"
 )
 
@@ -13,6 +14,7 @@ type User struct {
 	LastName     string
 	Phone        string
 	ProfileImage bool
+	Language     string // пустая строка - язык выбирается по заголовку Accept-Language
 }
 
 //NewUser - Конструктор для нового объекта пользователя.
@@ -30,12 +32,19 @@ func NewUser(login string, pass string, name string, lastName string, Phone stri
 
 //Car - структура, писывающая сущность автомобиля.
 type Car struct {
-	ID     string
-	Brand  string
-	Model  string
-	VIN    string
-	Year   string
-	UserID string
+	ID           string
+	Brand        string
+	Model        string
+	VIN          string
+	Year         string
+	UserID       string
+	Mileage      string
+	Plate        string
+	PlateCountry string
+	Color        string
+	Engine       string
+	Transmission string
+	OrgID        string
 }
 
 //Order - структура, писывающая сущность заказа.
@@ -51,6 +60,8 @@ type Order struct {
 	Info            string
 	UserID          string
 	IsNewMSGForUser bool
+	Mileage         string
+	UnreadCount     int
 }
 
 // GetFormarDate - возвращает дату в формате мм-дд-гггг
@@ -70,8 +81,204 @@ func (order *Order) GetFormatDate() string {
 
 //Message - структура, писывающая сущность сообщения в заказе.
 type Message struct {
-	IsAdmin bool
+	ID             string
+	IsAdmin        bool
+	Date           time.Time
+	Text           string
+	OrderID        string
+	ReadByCustomer bool
+	ReadByStaff    bool
+	Attachments    []*Attachment
+}
+
+//OrderItem - структура, описывающая позицию (работу или запчасть) в заказе.
+type OrderItem struct {
+	ID         string
+	OrderID    string
+	Name       string
+	Quantity   string
+	Cost       string
+	ScheduleID string
+}
+
+//OdometerReading - структура, описывающая показание одометра машины.
+type OdometerReading struct {
+	VIN     string
 	Date    time.Time
-	Text    string
+	Mileage int
 	OrderID string
 }
+
+//CarNote - структура, описывающая заметку сервиса о машине.
+type CarNote struct {
+	VIN  string
+	Date time.Time
+	Text string
+}
+
+//ServiceRecord - структура, описывающая заказ в истории обслуживания машины вместе с его позициями.
+type ServiceRecord struct {
+	Order
+	Items []*OrderItem
+}
+
+//CarHistory - структура, описывающая историю обслуживания машины по VIN.
+type CarHistory struct {
+	VIN      string
+	Brand    string
+	Model    string
+	Year     string
+	Orders   []*ServiceRecord
+	Readings []*OdometerReading
+	Notes    []*CarNote
+}
+
+//VINInfo - структура, описывающая расшифровку VIN.
+type VINInfo struct {
+	VIN          string
+	WMI          string
+	Manufacturer string
+	Region       string
+	ModelYear    string
+}
+
+//MaintenanceSchedule - структура, описывающая регламент обслуживания.
+//Пустая марка означает, что регламент подходит для всех машин.
+//Code - код перевода названия, есть только у регламентов из начальных данных БД.
+type MaintenanceSchedule struct {
+	ID             string
+	Brand          string
+	Name           string
+	Code           string
+	IntervalKm     int
+	IntervalMonths int
+}
+
+//Reminder - структура, описывающая напоминание владельцу о предстоящем обслуживании.
+type Reminder struct {
+	ID         string
+	CarID      string
+	CarInfo    string
+	ScheduleID string
+	Text       string
+	DueMileage string
+	DueDate    time.Time
+	Created    time.Time
+}
+
+//CarEdit - структура, описывающая изменение одного поля машины.
+type CarEdit struct {
+	CarID    string
+	Date     time.Time
+	Field    string
+	OldValue string
+	NewValue string
+}
+
+//Organisation - структура, описывающая организацию (корпоративного клиента с автопарком).
+//Role - роль текущего пользователя в организации.
+type Organisation struct {
+	ID      string
+	Name    string
+	Role    int
+	Members []*OrgMember
+}
+
+//OrgMember - структура, описывающая участника организации.
+type OrgMember struct {
+	UserID   string
+	Login    string
+	Name     string
+	LastName string
+	Role     int
+}
+
+//CarTransfer - структура, описывающая запрос на передачу машины другому пользователю.
+type CarTransfer struct {
+	ID        string
+	CarID     string
+	CarInfo   string
+	FromLogin string
+	ToLogin   string
+	Status    int
+	Created   time.Time
+}
+
+//OrderEvent - структура, описывающая событие заказа для потоковой рассылки.
+type OrderEvent struct {
+	Type              string
+	OrderID           string
+	Status            int
+	Message           *Message
+	ReadByStaff       bool
+	LastReadMessageID string
+}
+
+//OrderUnread - структура, описывающая количество непрочитанных сообщений в заказе.
+type OrderUnread struct {
+	OrderID string
+	Unread  int
+}
+
+//UnreadCounts - структура, описывающая количество непрочитанных сообщений всего и по заказам.
+type UnreadCounts struct {
+	Total  int
+	Orders []*OrderUnread
+}
+
+//Attachment - структура, описывающая файл, приложенный к сообщению.
+type Attachment struct {
+	ID           string
+	MessageID    string
+	FileName     string
+	ContentType  string
+	Size         int64
+	HasThumbnail bool
+	file         multipart.File // содержимое загружаемого файла, до сохранения в хранилище
+}
+
+//InboxConversation - структура, описывающая переписку по заказу во входящих сотрудника.
+type InboxConversation struct {
+	OrderID                 string
+	Status                  int
+	CarInfo                 string
+	CustomerName            string
+	AssigneeID              string
+	LastCustomerMessage     string
+	LastCustomerMessageDate time.Time
+	Unanswered              bool
+	Unread                  int
+}
+
+//Notification - структура, описывающая уведомление пользователя в очереди на отправку.
+type Notification struct {
+	ID       string
+	UserID   string
+	Channel  string
+	Address  string
+	OrderID  string
+	Subject  string
+	Text     string
+	Created  time.Time
+	Attempts int
+}
+
+//NotificationPreference - структура, описывающая настройку канала уведомлений пользователя.
+type NotificationPreference struct {
+	Channel   string
+	Address   string
+	Enabled   bool
+	Available bool // настроен ли канал на сервере
+}
+
+//MessageTemplate - структура, описывающая шаблон сообщения сотрудника.
+type MessageTemplate struct {
+	ID   string
+	Name string
+	Text string
+}
+
+//TemplatePreview - структура, описывающая текст шаблона сообщения, заполненный данными заказа.
+type TemplatePreview struct {
+	Text string
+}
@@ -32,7 +32,7 @@ func InitFlags() {
 func InitLogger() *os.File {
 	logfile, err := os.OpenFile(logSource, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
 	if err != nil {
-		log.Fatalln("Ошибка. Файл логов (%q) не открылся: ", logSource, err)
+		log.Fatalf("Ошибка. Файл логов (%q) не открылся: %s", logSource, err)
 	}
 
 	log.SetOutput(logfile)
@@ -41,13 +41,17 @@ func InitLogger() *os.File {
 	return logfile
 }
 
+// connectionString - формирует строку подключения к БД
+func connectionString(dbinfo XMLconfig.DataBase) string {
+	return "user=" + dbinfo.User + " password=" + dbinfo.Password + " dbname=" + dbinfo.DBname +
+		" host=" + dbinfo.Host + " port=" + strconv.Itoa(dbinfo.Port) + " sslmode=" + dbinfo.SSLmode
+}
+
 // connectToDB - устанавливет соединение с БД и инициализирует глобальные переменные
 func connectToDB(dbinfo XMLconfig.DataBase) {
 	var err error
-	connStr := "user=" + dbinfo.User + " password=" + dbinfo.Password + " dbname=" + dbinfo.DBname +
-		" host=" + dbinfo.Host + " port=" + strconv.Itoa(dbinfo.Port) + " sslmode=" + dbinfo.SSLmode
 	if db == nil {
-		db, err = sql.Open("postgres", connStr)
+		db, err = sql.Open("postgres", connectionString(dbinfo))
 		if err != nil {
 			log.Fatalln(fmt.Sprintf("Фатал. При подключении к серверу БД(%v:%v): ", dbinfo.Host, dbinfo.Port) + err.Error())
 		}
@@ -94,108 +98,190 @@ func removeFile(fileName string) {
 }
 
 //ValidateUser - проверяет поступившие данные о пользователе на бизнес правила
-func ValidateUser(u *User, regexpForPhone *regexp.Regexp) string {
+func ValidateUser(u *User, regexpForPhone *regexp.Regexp) ValidationErrors {
+	resultOfValidation := ValidationErrors{}
+
 	if len(u.Login) < 6 {
-		return "Ошибка. Длина логина меньше 6 символов."
+		resultOfValidation.add("login", CodeLoginTooShort, 6)
 	}
 	if len(u.Password) < 6 {
-		return "Ошибка. Длина пароля меньше 6 символов."
+		resultOfValidation.add("password", CodePasswordTooShort, 6)
 	}
 	if len(u.Name) == 0 {
-		return "Ошибка. Поле имя не может быть пустым."
+		resultOfValidation.add("name", CodeNameRequired)
 	}
 	if len(u.LastName) == 0 {
-		return "Ошибка. Поле фамилия не может быть пустым."
+		resultOfValidation.add("lastName", CodeLastNameRequired)
+	}
+
+	if u.Language != "" && supportedLanguage(u.Language) != u.Language {
+		resultOfValidation.add("language", CodeInvalidLanguage, strings.Join(supportedLanguages, ", "))
 	}
 
 	if regexpForPhone.MatchString(u.Phone) {
 		//return "Некорректный номер телефона"
 	}
 
-	return ""
+	return resultOfValidation
 }
 
 //ValidateMessage - проверяет поступившие данные о сообщения на бизнес правила
-func ValidateMessage(message *Message) string {
+func ValidateMessage(message *Message) ValidationErrors {
+	resultOfValidation := ValidationErrors{}
 
 	if _, err := strconv.Atoi(message.OrderID); err != nil {
-		return "Ошибка. Неверный id заказа."
+		resultOfValidation.add("orderID", CodeInvalidOrderID)
 	}
 
-	if message.Text == "" {
-		return "Ошибка. Пустой текст сообщения."
+	if message.Text == "" && len(message.Attachments) == 0 {
+		resultOfValidation.add("text", CodeEmptyMessage)
 	}
 
-	return ""
+	return resultOfValidation
 }
 
 //ValidateOrder - проверяет поступившие данные о заказе на бизнес правила
-func ValidateOrder(order *Order) string {
-	day, err := strconv.Atoi(order.Day)
-	if err != nil {
-		return "Ошибка. Неверная дата."
+func ValidateOrder(order *Order) ValidationErrors {
+	resultOfValidation := ValidateOrderDate(order)
+
+	if order.CarID == "" {
+		resultOfValidation.add("carID", CodeCarRequired)
+	} else if _, err := strconv.Atoi(order.CarID); err != nil {
+		resultOfValidation.add("carID", CodeInvalidCarID)
 	}
 
-	if day > 31 || day < 1 {
-		return "Ошибка. Неверная дата."
+	if order.Info == "" {
+		resultOfValidation.add("textInfo", CodeInfoRequired)
 	}
 
-	month, err := strconv.Atoi(order.Month)
-	if err != nil {
-		return "Ошибка. Неверная дата."
+	if order.Mileage != "" {
+		if mileage, err := strconv.Atoi(order.Mileage); err != nil || mileage < 0 {
+			resultOfValidation.add("mileage", CodeInvalidMileage)
+		}
 	}
 
-	if month > 12 || day < 1 {
-		return "Ошибка. Неверная дата."
+	return resultOfValidation
+}
+
+// ValidateOrderDate - проверяет дату записи по заказу: день, месяц и год, в том числе что такой день есть в месяце.
+func ValidateOrderDate(order *Order) ValidationErrors {
+	resultOfValidation := ValidationErrors{}
+
+	day, err := strconv.Atoi(order.Day)
+	if err != nil || day > 31 || day < 1 {
+		resultOfValidation.add("day", CodeInvalidDate)
+	}
+
+	month, err := strconv.Atoi(order.Month)
+	if err != nil || month > 12 || month < 1 {
+		resultOfValidation.add("month", CodeInvalidDate)
 	}
 
 	year, err := strconv.Atoi(order.Year)
-	if err != nil {
-		return "Ошибка. Неверная дата."
+	if err != nil || year > 2100 || year < 2018 {
+		resultOfValidation.add("year", CodeInvalidDate)
 	}
 
-	if year > 2100 || year < 2018 {
-		return "Ошибка. Неверная дата."
+	if len(resultOfValidation) == 0 && time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Day() != day {
+		resultOfValidation.add("day", CodeInvalidDate)
 	}
 
-	if order.CarID == "" {
-		return "Ошибка. Укажите машину"
+	return resultOfValidation
+}
+
+// ValidateOrderItem - проверяет поступившие данные о позиции заказа на бизнес правила
+func ValidateOrderItem(item *OrderItem) ValidationErrors {
+	resultOfValidation := ValidationErrors{}
+
+	if _, err := strconv.Atoi(item.OrderID); err != nil {
+		resultOfValidation.add("orderID", CodeInvalidOrderID)
 	}
 
-	if order.Info == "" {
-		return "Ошибка. Информацию по заказу"
+	if item.Name == "" {
+		resultOfValidation.add("name", CodeItemNameRequired)
+	}
+
+	if len(item.Name) > 100 {
+		resultOfValidation.add("name", CodeItemNameTooLong, 100)
+	}
+
+	if quantity, err := strconv.Atoi(item.Quantity); err != nil || quantity < 1 {
+		resultOfValidation.add("quantity", CodeInvalidQuantity)
+	}
+
+	if cost, err := strconv.Atoi(item.Cost); err != nil || cost < 0 {
+		resultOfValidation.add("cost", CodeInvalidCost)
+	}
+
+	if item.ScheduleID != "" {
+		if _, err := strconv.Atoi(item.ScheduleID); err != nil {
+			resultOfValidation.add("scheduleID", CodeInvalidScheduleID)
+		}
 	}
 
-	return ""
+	return resultOfValidation
 }
 
 // ValidateCar - проверяет поступившие данные о машине на бизнес правила
-func ValidateCar(car *Car) string {
+func ValidateCar(car *Car) ValidationErrors {
+	resultOfValidation := ValidationErrors{}
+
 	if car.Brand == "" {
-		return "Ошибка. Необходимо указать марку машины."
+		resultOfValidation.add("brand", CodeBrandRequired)
 	}
 
-	if len(car.Brand) > 50 {
-		return "Ошибка. Марка машины не может быть длиннее 20 символов."
+	if len(car.Brand) > 20 {
+		resultOfValidation.add("brand", CodeBrandTooLong, 20)
 	}
 
 	if car.Model == "" {
-		return "Ошибка. Необходимо указать модель машины."
+		resultOfValidation.add("model", CodeModelRequired)
+	}
+
+	if len(car.Model) > 50 {
+		resultOfValidation.add("model", CodeModelTooLong, 50)
+	}
+
+	vinErrors := ValidateVIN(car.VIN)
+	resultOfValidation = append(resultOfValidation, vinErrors...)
+
+	year, err := strconv.Atoi(car.Year)
+	if err != nil {
+		resultOfValidation.add("year", CodeInvalidYear)
+	}
+
+	resultOfValidation = append(resultOfValidation, ValidatePlate(car.Plate, car.PlateCountry)...)
+
+	if len(car.Color) > 30 {
+		resultOfValidation.add("color", CodeColorTooLong, 30)
 	}
 
-	if len(car.Model) > 20 {
-		return "Ошибка. Модель машины не может быть длиннее 50 символов."
+	if len(car.Engine) > 50 {
+		resultOfValidation.add("engine", CodeEngineTooLong, 50)
 	}
 
-	if len(car.VIN) != 17 {
-		return "Ошибка. Получен некорректный VIN код."
+	if !transmissions[car.Transmission] {
+		resultOfValidation.add("transmission", CodeTransmission)
 	}
 
-	if _, err := strconv.Atoi(car.Year); err != nil {
-		return "Ошибка. Получен некорректный год."
+	// сверка с VIN имеет смысл, только если сам VIN корректен
+	if len(vinErrors) != 0 {
+		return resultOfValidation
+	}
+
+	if !matchVINBrand(car.VIN, car.Brand) {
+		resultOfValidation.add("brand", CodeVINBrandMismatch)
+	}
+
+	// Модельный год на 10-й позиции обязателен только для VIN северноамериканского рынка,
+	// у остальных производителей там может быть что угодно, поэтому их год не сверяется.
+	if modelYear := vinModelYear(car.VIN); isNorthAmericanVIN(car.VIN) && modelYear != 0 && err == nil {
+		if year < modelYear-1 || year > modelYear {
+			resultOfValidation.add("year", CodeVINYearMismatch, strconv.Itoa(modelYear))
+		}
 	}
 
-	return ""
+	return resultOfValidation
 }
 
 // generateToken - генерирует уникальный токен для авторизации.
@@ -231,16 +317,17 @@ func generateMD5hash(password string) string {
 // а так же валидирует параметры и солит пароль.
 func getAndCheckUser(w http.ResponseWriter, r *http.Request) *User {
 	user := NewUser(strings.ToLower(r.FormValue("login")), r.FormValue("password"), r.FormValue("name"), r.FormValue("lastName"), r.FormValue("phone"))
+	user.Language = strings.ToLower(r.FormValue("language"))
 	re, err := regexp.Compile(`^((?:(?:\(?(?:|\+)([1-4]\d\d|[1-9]\d?)\)?)?[\-\.\\\/]?)?((?:\(?\d{1,}\)?[\-\.\\\/]?){0,})(\d+))$`)
 	if err != nil {
 		log.Printf("Ошибка. При компиляции регулярного выражения: %v\n", err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return nil
 	}
 
 	resultOfValidation := ValidateUser(user, re)
-	if resultOfValidation != "" {
-		http.Error(w, resultOfValidation, http.StatusBadRequest)
+	if len(resultOfValidation) != 0 {
+		writeValidationErrors(w, resultOfValidation)
 		return nil
 	}
 
@@ -249,20 +336,29 @@ func getAndCheckUser(w http.ResponseWriter, r *http.Request) *User {
 	return user
 }
 
-// getAndCheckUser - получает данные о новом пользователе из запроса,
+// getAndCheckCar - получает данные о машине из запроса,
 // а так же валидирует параметры.
 func getAndCheckCar(w http.ResponseWriter, r *http.Request) *Car {
 	car := &Car{
-		Brand: r.FormValue("brand"),
-		Model: r.FormValue("model"),
-		VIN:   r.FormValue("vin"),
-		Year:  r.FormValue("year"),
+		Brand:        r.FormValue("brand"),
+		Model:        r.FormValue("model"),
+		VIN:          strings.ToUpper(strings.TrimSpace(r.FormValue("vin"))),
+		Year:         r.FormValue("year"),
+		Plate:        NormalizePlate(r.FormValue("plate")),
+		PlateCountry: strings.ToUpper(r.FormValue("plateCountry")),
+		Color:        r.FormValue("color"),
+		Engine:       r.FormValue("engine"),
+		Transmission: strings.ToLower(r.FormValue("transmission")),
+	}
+
+	if car.Plate != "" && car.PlateCountry == "" {
+		car.PlateCountry = "RU"
 	}
 
 	resultOfValidation := ValidateCar(car)
-	if resultOfValidation != "" {
-		log.Println("Инфо. Попытка добавить машину с невалидными данными: " + resultOfValidation)
-		http.Error(w, resultOfValidation, http.StatusBadRequest)
+	if len(resultOfValidation) != 0 {
+		log.Println("Инфо. Попытка добавить машину с невалидными данными: " + resultOfValidation.String())
+		writeValidationErrors(w, resultOfValidation)
 		return nil
 	}
 
@@ -274,18 +370,19 @@ func getAndCheckCar(w http.ResponseWriter, r *http.Request) *Car {
 func getAndCheckOrder(w http.ResponseWriter, r *http.Request) *Order {
 
 	order := &Order{
-		Cost:  r.FormValue("cost"),
-		Info:  r.FormValue("textInfo"),
-		Month: r.FormValue("month"),
-		Day:   r.FormValue("day"),
-		Year:  r.FormValue("year"),
-		CarID: r.FormValue("carID"),
+		Cost:    r.FormValue("cost"),
+		Info:    r.FormValue("textInfo"),
+		Month:   r.FormValue("month"),
+		Day:     r.FormValue("day"),
+		Year:    r.FormValue("year"),
+		CarID:   r.FormValue("carID"),
+		Mileage: r.FormValue("mileage"),
 	}
 
 	resultOfValidation := ValidateOrder(order)
-	if resultOfValidation != "" {
-		log.Println("Инфо. Попытка добавить заказ с невалидными данными: " + resultOfValidation)
-		http.Error(w, resultOfValidation, http.StatusBadRequest)
+	if len(resultOfValidation) != 0 {
+		log.Println("Инфо. Попытка добавить заказ с невалидными данными: " + resultOfValidation.String())
+		writeValidationErrors(w, resultOfValidation)
 		return nil
 	}
 
@@ -293,7 +390,7 @@ func getAndCheckOrder(w http.ResponseWriter, r *http.Request) *Order {
 
 }
 
-// getAndCheckOrder - получает данные о новом заказе из запроса,
+// getAndCheckMessage - получает данные о новом сообщении и его вложениях из запроса,
 // а так же валидирует параметры.
 func getAndCheckMessage(w http.ResponseWriter, r *http.Request) *Message {
 	message := &Message{
@@ -303,10 +400,18 @@ func getAndCheckMessage(w http.ResponseWriter, r *http.Request) *Message {
 		OrderID: r.FormValue("orderID"),
 	}
 
-	resultOfValidation := ValidateMessage(message)
-	if resultOfValidation != "" {
-		log.Println("Инфо. Попытка добавить сообщение с невалидными данными: " + resultOfValidation)
-		http.Error(w, resultOfValidation, http.StatusBadRequest)
+	attachments, resultOfValidation := getAndCheckAttachments(r)
+	if len(resultOfValidation) != 0 {
+		log.Println("Инфо. Попытка добавить сообщение с невалидными вложениями: " + resultOfValidation.String())
+		writeValidationErrors(w, resultOfValidation)
+		return nil
+	}
+	message.Attachments = attachments
+
+	resultOfValidation = ValidateMessage(message)
+	if len(resultOfValidation) != 0 {
+		log.Println("Инфо. Попытка добавить сообщение с невалидными данными: " + resultOfValidation.String())
+		writeValidationErrors(w, resultOfValidation)
 		return nil
 	}
 
@@ -315,7 +420,8 @@ func getAndCheckMessage(w http.ResponseWriter, r *http.Request) *Message {
 }
 
 // checkAuthorization - проверяет cookie с токеном,
-// и в случае его наличия возвращает логин пользовател.
+// и в случае его наличия возвращает логин пользовател. Вызывается из requireUser,
+// обработчики получают ид пользователя через currentUserID.
 func checkAuthorization(w http.ResponseWriter, r *http.Request) string {
 	token := getTokenFromCookie(w, r)
 
@@ -323,41 +429,90 @@ func checkAuthorization(w http.ResponseWriter, r *http.Request) string {
 		return ""
 	}
 
-	var id string
-	err := db.QueryRow(`SELECT userid FROM authorizations WHERE token = $1`, token).Scan(&id)
+	id, lang, err := findAuthorization(token)
 
 	if err == sql.ErrNoRows {
 		log.Println("Инфо. Попытка доступа по недействительному токену: " + err.Error())
-		http.Error(w, "Устаревший токен авторизации.", http.StatusBadRequest)
+		writeError(w, http.StatusUnauthorized, CodeTokenExpired)
 		return ""
 	}
 
 	if err != nil {
 		log.Println("Ошибка. При поиске записи в БД об авторизации пользователя: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return ""
 	}
 
+	// Язык, выбранный пользователем, важнее языка из заголовка Accept-Language.
+	if lang != "" {
+		w.Header().Set("Content-Language", lang)
+	}
+
 	return id
 }
 
+// findAuthorization - ищет пользователя по токену авторизации и возвращает его ид и выбранный язык.
+// Если токен недействителен, то возвращает sql.ErrNoRows.
+func findAuthorization(token string) (string, string, error) {
+	var id, lang string
+	err := db.QueryRow(`SELECT a.userid, u.language FROM authorizations a
+	JOIN users u ON u.id = a.userid WHERE a.token = $1`, token).Scan(&id, &lang)
+	return id, lang, err
+}
+
+// checkStaffAuthorization - проверяет авторизацию пользователя и то, что он является сотрудником сервиса.
+// В случае успеха возвращает ид сотрудника.
+func checkStaffAuthorization(w http.ResponseWriter, r *http.Request) string {
+	id := checkAuthorization(w, r)
+
+	if id == "" {
+		return ""
+	}
+
+	staff, err := isStaff(id)
+	if err != nil {
+		log.Println("Ошибка. При поиске в БД роли пользователя: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return ""
+	}
+
+	if !staff {
+		log.Println("Инфо. Попытка доступа к служебным данным пользователем(ид = " + id + ") без прав сотрудника.")
+		writeError(w, http.StatusForbidden, CodeForbidden)
+		return ""
+	}
+
+	return id
+}
+
+// isStaff - проверяет, является ли пользователь сотрудником сервиса.
+func isStaff(userID string) (bool, error) {
+	var staff bool
+	err := db.QueryRow(`SELECT isstaff FROM users WHERE id = $1`, userID).Scan(&staff)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	return staff, err
+}
+
 // getTokenFromCookie - возвращает token авторизации из cookie.
 func getTokenFromCookie(w http.ResponseWriter, r *http.Request) string {
 	cookie, err := r.Cookie("token")
 
 	if err != nil && err == http.ErrNoCookie {
-		http.Error(w, "Для начала работы необходимо авторизоваться.", http.StatusBadRequest)
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized)
 		return ""
 	}
 
 	if err != nil {
 		log.Println("Ошибка. При чтении cookie: " + err.Error())
-		http.Error(w, "Неполадки на сервере, повторите попытку позже.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeInternal)
 		return ""
 	}
 
 	if cookie.Value == "" {
-		http.Error(w, "Для начала работы необходимо авторизоваться.", http.StatusBadRequest)
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized)
 		return ""
 	}
 
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vinManufacturer - производитель, определяемый по WMI (первые 3 символа VIN).
+type vinManufacturer struct {
+	Name   string
+	Brands []string // варианты написания марки, которые считаются совпадением
+}
+
+// vinManufacturers - известные WMI коды и соответствующие им производители.
+var vinManufacturers = map[string]vinManufacturer{
+	"1FA": {"Ford", []string{"ford", "форд"}},
+	"1FM": {"Ford", []string{"ford", "форд"}},
+	"1FT": {"Ford", []string{"ford", "форд"}},
+	"1G1": {"Chevrolet", []string{"chevrolet", "chevy", "шевроле"}},
+	"1GC": {"Chevrolet", []string{"chevrolet", "chevy", "шевроле"}},
+	"1HG": {"Honda", []string{"honda", "хонда"}},
+	"1N4": {"Nissan", []string{"nissan", "ниссан"}},
+	"2HG": {"Honda", []string{"honda", "хонда"}},
+	"2T1": {"Toyota", []string{"toyota", "тойота"}},
+	"3VW": {"Volkswagen", []string{"volkswagen", "vw", "фольксваген"}},
+	"4T1": {"Toyota", []string{"toyota", "тойота"}},
+	"5YJ": {"Tesla", []string{"tesla", "тесла"}},
+	"JF1": {"Subaru", []string{"subaru", "субару"}},
+	"JHM": {"Honda", []string{"honda", "хонда"}},
+	"JMZ": {"Mazda", []string{"mazda", "мазда"}},
+	"JN1": {"Nissan", []string{"nissan", "ниссан"}},
+	"JMB": {"Mitsubishi", []string{"mitsubishi", "мицубиси", "митсубиси"}},
+	"JTD": {"Toyota", []string{"toyota", "тойота"}},
+	"JTE": {"Toyota", []string{"toyota", "тойота"}},
+	"JTM": {"Toyota", []string{"toyota", "тойота"}},
+	"JTN": {"Toyota", []string{"toyota", "тойота"}},
+	"KL1": {"Chevrolet", []string{"chevrolet", "chevy", "шевроле"}},
+	"KMH": {"Hyundai", []string{"hyundai", "хендай", "хундай", "хёндэ"}},
+	"KNA": {"Kia", []string{"kia", "киа"}},
+	"KNE": {"Kia", []string{"kia", "киа"}},
+	"SAL": {"Land Rover", []string{"land rover", "landrover", "range rover", "ленд ровер"}},
+	"SJN": {"Nissan", []string{"nissan", "ниссан"}},
+	"TMB": {"Skoda", []string{"skoda", "škoda", "шкода"}},
+	"VF1": {"Renault", []string{"renault", "рено"}},
+	"VF3": {"Peugeot", []string{"peugeot", "пежо"}},
+	"VF7": {"Citroen", []string{"citroen", "citroën", "ситроен"}},
+	"W0L": {"Opel", []string{"opel", "опель"}},
+	"WAU": {"Audi", []string{"audi", "ауди"}},
+	"WBA": {"BMW", []string{"bmw", "бмв"}},
+	"WBS": {"BMW", []string{"bmw", "бмв"}},
+	"WDB": {"Mercedes-Benz", []string{"mercedes-benz", "mercedes", "мерседес"}},
+	"WDD": {"Mercedes-Benz", []string{"mercedes-benz", "mercedes", "мерседес"}},
+	"WF0": {"Ford", []string{"ford", "форд"}},
+	"WP0": {"Porsche", []string{"porsche", "порше"}},
+	"WVG": {"Volkswagen", []string{"volkswagen", "vw", "фольксваген"}},
+	"WVW": {"Volkswagen", []string{"volkswagen", "vw", "фольксваген"}},
+	"X4X": {"BMW", []string{"bmw", "бмв"}},
+	"X7L": {"Renault", []string{"renault", "рено"}},
+	"XTA": {"Lada", []string{"lada", "лада", "ваз"}},
+	"XW8": {"Volkswagen", []string{"volkswagen", "vw", "фольксваген"}},
+	"XWB": {"Daewoo", []string{"daewoo", "дэу", "деу"}},
+	"Y6D": {"ZAZ", []string{"zaz", "заз"}},
+	"YV1": {"Volvo", []string{"volvo", "вольво"}},
+	"Z8T": {"Peugeot", []string{"peugeot", "пежо"}},
+	"Z94": {"Hyundai", []string{"hyundai", "хендай", "хундай", "хёндэ"}},
+}
+
+// vinTransliteration - числовые значения символов VIN для вычисления контрольной цифры.
+var vinTransliteration = map[rune]int{
+	'A': 1, 'B': 2, 'C': 3, 'D': 4, 'E': 5, 'F': 6, 'G': 7, 'H': 8,
+	'J': 1, 'K': 2, 'L': 3, 'M': 4, 'N': 5, 'P': 7, 'R': 9,
+	'S': 2, 'T': 3, 'U': 4, 'V': 5, 'W': 6, 'X': 7, 'Y': 8, 'Z': 9,
+}
+
+// vinWeights - веса позиций VIN для вычисления контрольной цифры.
+var vinWeights = [17]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// vinYearCodes - коды модельного года (10-я позиция VIN), начиная с 1980 года. Цикл - 30 лет.
+const vinYearCodes = "ABCDEFGHJKLMNPRSTVWXY123456789"
+
+// ValidateVIN - проверяет VIN на соответствие ISO 3779,
+// а для машин северноамериканского рынка еще и контрольную цифру.
+// Все ошибки относятся к полю vin.
+func ValidateVIN(vin string) ValidationErrors {
+	resultOfValidation := ValidationErrors{}
+
+	if len(vin) != 17 {
+		resultOfValidation.add("vin", CodeInvalidVIN)
+		return resultOfValidation
+	}
+
+	for _, c := range vin {
+		if !isVINChar(c) {
+			resultOfValidation.add("vin", CodeVINChars)
+			return resultOfValidation
+		}
+	}
+
+	if isNorthAmericanVIN(vin) && vin[8] != vinCheckDigit(vin) {
+		resultOfValidation.add("vin", CodeVINChecksum)
+	}
+
+	return resultOfValidation
+}
+
+// DecodeVIN - расшифровывает производителя, регион и модельный год по VIN, регион называется на языке lang.
+// VIN должен быть предварительно проверен с помощью ValidateVIN.
+func DecodeVIN(vin string, lang string) *VINInfo {
+	info := &VINInfo{
+		VIN:    vin,
+		WMI:    vin[:3],
+		Region: vinRegion(vin[0], lang),
+	}
+
+	if manufacturer, ok := vinManufacturers[info.WMI]; ok {
+		info.Manufacturer = manufacturer.Name
+	}
+
+	if year := vinModelYear(vin); year != 0 {
+		info.ModelYear = strconv.Itoa(year)
+	}
+
+	return info
+}
+
+// decodeVINHandler - расшифровывает VIN, для предзаполнения формы добавления машины.
+func decodeVINHandler(w http.ResponseWriter, r *http.Request) {
+	vin := strings.ToUpper(strings.TrimSpace(r.FormValue("vin")))
+
+	resultOfValidation := ValidateVIN(vin)
+	if len(resultOfValidation) != 0 {
+		writeValidationErrors(w, resultOfValidation)
+		return
+	}
+
+	data, err := json.Marshal(DecodeVIN(vin, responseLanguage(w)))
+	if err != nil {
+		log.Println("Ошибка. При маршалинге в json результата: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+		return
+	}
+
+	w.Header().Add("Content-type", "application/json;")
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("Ошибка. При отдачи метоинформации: " + err.Error())
+		writeError(w, http.StatusInternalServerError, CodeInternal)
+	}
+}
+
+// matchVINBrand - проверяет, совпадает ли марка машины с производителем из VIN.
+// Если производитель по WMI неизвестен, то считается что марка совпадает.
+func matchVINBrand(vin string, brand string) bool {
+	manufacturer, ok := vinManufacturers[vin[:3]]
+	if !ok {
+		return true
+	}
+
+	brand = strings.ToLower(strings.TrimSpace(brand))
+	for _, item := range manufacturer.Brands {
+		if brand == item || strings.HasPrefix(brand, item+" ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isNorthAmericanVIN - проверяет, выпущена ли машина для северноамериканского рынка.
+// Только для таких VIN обязательны контрольная цифра и код модельного года.
+func isNorthAmericanVIN(vin string) bool {
+	return vin[0] >= '1' && vin[0] <= '5'
+}
+
+// isVINChar - проверяет, допустим ли символ в VIN.
+func isVINChar(c rune) bool {
+	if c >= '0' && c <= '9' {
+		return true
+	}
+
+	return c >= 'A' && c <= 'Z' && c != 'I' && c != 'O' && c != 'Q'
+}
+
+// vinCheckDigit - вычисляет контрольную цифру VIN (9-я позиция).
+func vinCheckDigit(vin string) byte {
+	sum := 0
+	for i, c := range vin {
+		value, ok := vinTransliteration[c]
+		if !ok {
+			value = int(c - '0')
+		}
+		sum += value * vinWeights[i]
+	}
+
+	if sum%11 == 10 {
+		return 'X'
+	}
+
+	return byte('0' + sum%11)
+}
+
+// vinRegion - определяет регион производства по первому символу VIN и возвращает его название на языке lang.
+func vinRegion(c byte, lang string) string {
+	switch {
+	case c >= 'A' && c <= 'H':
+		return localize(lang, RegionAfrica)
+	case c >= 'J' && c <= 'R':
+		return localize(lang, RegionAsia)
+	case c >= 'S' && c <= 'Z':
+		return localize(lang, RegionEurope)
+	case c >= '1' && c <= '5':
+		return localize(lang, RegionNorthAmerica)
+	case c == '6' || c == '7':
+		return localize(lang, RegionOceania)
+	case c == '8' || c == '9':
+		return localize(lang, RegionSouthAmerica)
+	}
+
+	return ""
+}
+
+// vinModelYear - определяет модельный год по 10-й позиции VIN.
+// Для северноамериканских VIN буква на 7-й позиции означает цикл с 2010 года,
+// для остальных выбирается самый поздний год, не превышающий следующий календарный.
+// Возвращает 0, если год определить не удалось.
+func vinModelYear(vin string) int {
+	index := strings.IndexByte(vinYearCodes, vin[9])
+	if index == -1 {
+		return 0
+	}
+
+	year := 1980 + index
+	if isNorthAmericanVIN(vin) {
+		if vin[6] >= 'A' && vin[6] <= 'Z' {
+			year += 30
+		}
+		return year
+	}
+
+	for year+30 <= time.Now().Year()+1 {
+		year += 30
+	}
+
+	return year
+}
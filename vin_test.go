@@ -0,0 +1,130 @@
+package main
+
+import "testing"
+
+// TestValidateVIN - длина, допустимые символы и контрольная цифра VIN.
+func TestValidateVIN(t *testing.T) {
+	tests := []struct {
+		vin  string
+		code string // пусто, если VIN корректен
+	}{
+		{"1M8GDM9AXKP042788", ""},
+		{"1HGCM82633A004352", ""},
+		{"5YJSA1E22MF123456", ""},
+		{"1M8GDM9A1KP042788", CodeVINChecksum},
+		{"1HGCM82643A004352", CodeVINChecksum},
+		{"XTA210990S1234567", ""}, // контрольная цифра проверяется только у североамериканских VIN
+		{"WDB2100551A123456", ""},
+		{"1M8GDM9AXKP04278", CodeInvalidVIN},
+		{"1M8GDM9AXKP0427880", CodeInvalidVIN},
+		{"", CodeInvalidVIN},
+		{"1M8GDM9AXKP04278O", CodeVINChars},
+		{"IM8GDM9AXKP042788", CodeVINChars},
+		{"1M8GDM9AXKQ042788", CodeVINChars},
+		{"1m8gdm9axkp042788", CodeVINChars},
+		{"1M8GDM9AXKP-42788", CodeVINChars},
+	}
+
+	for _, test := range tests {
+		errs := ValidateVIN(test.vin)
+		if test.code == "" {
+			if len(errs) != 0 {
+				t.Errorf("ValidateVIN(%q) = %s, ожидался корректный VIN", test.vin, errs.String())
+			}
+			continue
+		}
+		if len(errs) != 1 || errs[0].Field != "vin" || errs[0].Code != test.code {
+			t.Errorf("ValidateVIN(%q) = %v, ожидалась ошибка %s", test.vin, errs, test.code)
+		}
+	}
+}
+
+// TestVINCheckDigit - контрольная цифра, в том числе X при остатке 10.
+func TestVINCheckDigit(t *testing.T) {
+	tests := map[string]byte{
+		"1M8GDM9AXKP042788": 'X',
+		"1HGCM82633A004352": '3',
+		"5YJSA1E22MF123456": '2',
+	}
+
+	for vin, digit := range tests {
+		if got := vinCheckDigit(vin); got != digit {
+			t.Errorf("vinCheckDigit(%q) = %c, ожидалось %c", vin, got, digit)
+		}
+	}
+}
+
+// TestDecodeVIN - производитель по WMI, регион на языке ответа и модельный год.
+func TestDecodeVIN(t *testing.T) {
+	tests := []struct {
+		vin          string
+		wmi          string
+		manufacturer string
+		region       string
+		modelYear    string
+	}{
+		{"1M8GDM9AXKP042788", "1M8", "", "North America", "1989"},
+		{"1HGCM82633A004352", "1HG", "Honda", "North America", "2003"},
+		{"5YJSA1E22MF123456", "5YJ", "Tesla", "North America", "2021"}, // буква на 7-й позиции - цикл с 2010 года
+		{"WDB2100551A123456", "WDB", "Mercedes-Benz", "Europe", "2001"},
+		{"XTA210990Y2766389", "XTA", "Lada", "Europe", "2000"},
+		{"JTDKB20U093123456", "JTD", "Toyota", "Asia", "2009"},
+		{"1M8GDM9AXUP042788", "1M8", "", "North America", ""}, // U не код года
+	}
+
+	for _, test := range tests {
+		info := DecodeVIN(test.vin, LangEN)
+		if info.WMI != test.wmi || info.Manufacturer != test.manufacturer || info.Region != test.region || info.ModelYear != test.modelYear {
+			t.Errorf("DecodeVIN(%q) = %+v", test.vin, info)
+		}
+	}
+}
+
+// TestMatchVINBrand - марка сверяется с производителем, неизвестный WMI не мешает сохранить машину.
+func TestMatchVINBrand(t *testing.T) {
+	tests := []struct {
+		vin   string
+		brand string
+		match bool
+	}{
+		{"XTA210990Y2766389", "ВАЗ", true},
+		{"XTA210990Y2766389", " Lada Priora", true},
+		{"XTA210990Y2766389", "Toyota", false},
+		{"WDB2100551A123456", "Mercedes", true},
+		{"WDB2100551A123456", "Mercedesx", false},
+		{"1M8GDM9AXKP042788", "Motor Coach", true},
+	}
+
+	for _, test := range tests {
+		if got := matchVINBrand(test.vin, test.brand); got != test.match {
+			t.Errorf("matchVINBrand(%q, %q) = %v", test.vin, test.brand, got)
+		}
+	}
+}
+
+// TestValidateCarModelYear - год машины сверяется с VIN только для североамериканского рынка.
+func TestValidateCarModelYear(t *testing.T) {
+	tests := []struct {
+		vin   string
+		brand string
+		year  string
+		valid bool
+	}{
+		{"XTA210990S1234567", "Lada", "1995", true},
+		{"WDB2100551A123456", "Mercedes-Benz", "1999", true},
+		{"1HGCM82633A004352", "Honda", "2003", true},
+		{"1HGCM82633A004352", "Honda", "2002", true}, // модельный год может опережать календарный
+		{"1HGCM82633A004352", "Honda", "1999", false},
+		{"1HGCM82633A004352", "Honda", "2004", false},
+	}
+
+	for _, test := range tests {
+		errs := ValidateCar(&Car{Brand: test.brand, Model: "Model", VIN: test.vin, Year: test.year})
+		if test.valid && len(errs) != 0 {
+			t.Errorf("%s %s: %s", test.vin, test.year, errs.String())
+		}
+		if !test.valid && (len(errs) != 1 || errs[0].Field != "year" || errs[0].Code != CodeVINYearMismatch) {
+			t.Errorf("%s %s: %v, ожидалось несовпадение года", test.vin, test.year, errs)
+		}
+	}
+}